@@ -0,0 +1,152 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BundleSpec defines the desired state of Bundle
+type BundleSpec struct {
+	// Sources are the CA certificates of the bundle
+	// Certificates found in several sources are only added once
+	// +kubebuilder:validation:MinItems=1
+	Sources []BundleSource `json:"sources"`
+
+	// Target is the ConfigMap the bundle is written to in the selected namespaces
+	Target BundleTarget `json:"target"`
+}
+
+// BundleSource is a source of PEM encoded CA certificates, exactly one of its fields must be set
+type BundleSource struct {
+	// Secret reads the certificates from a key of a Secret in the cluster resource namespace
+	// +optional
+	Secret *SecretKeyRef `json:"secret,omitempty"`
+
+	// ConfigMap reads the certificates from a key of a ConfigMap in the cluster resource namespace
+	// +optional
+	ConfigMap *ConfigMapKeyRef `json:"configMap,omitempty"`
+
+	// InLine holds the PEM encoded certificates
+	// +optional
+	InLine string `json:"inLine,omitempty"`
+}
+
+// ConfigMapKeyRef is a reference to a key of a ConfigMap
+type ConfigMapKeyRef struct {
+	// Name is the name of the ConfigMap
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Key is the key in the data of the ConfigMap
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+}
+
+// BundleTarget configures the ConfigMap the bundle is written to
+// The ConfigMap is named like the Bundle and removed from namespaces that are no longer selected
+type BundleTarget struct {
+	// Key is the key of the ConfigMap the PEM encoded certificates are written to
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+
+	// NamespaceSelector selects the namespaces the ConfigMap is written to
+	// All namespaces are selected when it is not set
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// AdditionalFormats writes the bundle as truststores to the binary data of the ConfigMap as well
+	// +optional
+	AdditionalFormats *BundleFormats `json:"additionalFormats,omitempty"`
+}
+
+// BundleFormats configures the truststores a bundle is written to
+type BundleFormats struct {
+	// PKCS12 writes the certificates to a PKCS#12 truststore
+	// +optional
+	PKCS12 *BundleFormat `json:"pkcs12,omitempty"`
+
+	// JKS writes the certificates to a Java KeyStore
+	// +optional
+	JKS *BundleFormat `json:"jks,omitempty"`
+}
+
+// BundleFormat configures a truststore of the bundle
+type BundleFormat struct {
+	// Key is the key of the ConfigMap the truststore is written to
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+
+	// Password protects the integrity of the truststore, it holds no secrets
+	// +optional
+	// +kubebuilder:default=changeit
+	// +kubebuilder:validation:MinLength=1
+	Password string `json:"password,omitempty"`
+}
+
+// BundleStatus defines the observed state of Bundle
+type BundleStatus struct {
+	// Certificates is the number of distinct certificates in the bundle
+	// +optional
+	Certificates int `json:"certificates,omitempty"`
+
+	// Namespaces is the number of namespaces the bundle is written to
+	// +optional
+	Namespaces int `json:"namespaces,omitempty"`
+
+	// Conditions holds the Ready condition of the bundle
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=bundles,scope=Cluster
+// +kubebuilder:printcolumn:name="Key",type="string",JSONPath=`.spec.target.key`
+// +kubebuilder:printcolumn:name="Certificates",type="integer",JSONPath=`.status.certificates`
+// +kubebuilder:printcolumn:name="Namespaces",type="integer",JSONPath=`.status.namespaces`
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
+
+// Bundle is the Schema for the bundles API
+// A Bundle distributes CA certificates to a ConfigMap in every selected namespace
+type Bundle struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BundleSpec   `json:"spec,omitempty"`
+	Status BundleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// BundleList contains a list of Bundle
+type BundleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Bundle `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Bundle{}, &BundleList{})
+}
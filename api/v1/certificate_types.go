@@ -23,9 +23,25 @@ import (
 // CertificateSpec defines the desired state of Certificate
 type CertificateSpec struct {
 	// DNSName is the DNS name for which the certificate should be issued
-	// +kubebuilder:validation:Required
-	// +kubebuilder:validation:MinLength=1
-	DNSName string `json:"dnsName"`
+	// Kept for backwards compatibility, it is merged into DNSNames
+	// +optional
+	DNSName string `json:"dnsName,omitempty"`
+
+	// DNSNames are the DNS subject alternative names of the certificate
+	// +optional
+	DNSNames []string `json:"dnsNames,omitempty"`
+
+	// IPAddresses are the IP address subject alternative names of the certificate
+	// +optional
+	IPAddresses []string `json:"ipAddresses,omitempty"`
+
+	// URIs are the URI subject alternative names of the certificate, such as SPIFFE IDs
+	// +optional
+	URIs []string `json:"uris,omitempty"`
+
+	// EmailAddresses are the email subject alternative names of the certificate
+	// +optional
+	EmailAddresses []string `json:"emailAddresses,omitempty"`
 
 	// Validity the time until the certificate expires
 	// Valid time units are "s", "m", "h", "d" (seconds, minutes, hours, days)
@@ -33,15 +49,86 @@ type CertificateSpec struct {
 	// +kubebuilder:validation:Pattern="^([0-9]+)(s|m|h|d)$"
 	Validity string `json:"validity"`
 
+	// RenewBefore is how long before expiry the certificate is renewed when RotateOnExpiry is enabled
+	// Either a duration such as "720h" or "30d", or a percentage of the certificate lifetime such as "33%"
+	// Defaults to renewing on expiry
+	// +optional
+	// +kubebuilder:validation:Pattern="^([0-9]+(s|m|h|d)|[1-9][0-9]?%)$"
+	RenewBefore string `json:"renewBefore,omitempty"`
+
+	// Subject holds the subject fields of the certificate besides the common name
+	// The common name is always set to the first DNS name
+	// +optional
+	Subject *Subject `json:"subject,omitempty"`
+
+	// Usages are the key usages and extended key usages of the certificate
+	// Defaults to "digital signature", "key encipherment" and "server auth"
+	// +optional
+	// +listType=set
+	Usages []KeyUsage `json:"usages,omitempty"`
+
+	// IsCA marks the certificate as a CA certificate, which adds the "cert sign" usage
+	// +optional
+	IsCA bool `json:"isCA,omitempty"`
+
+	// MaxPathLen is the maximum number of intermediate CAs that may follow a CA certificate in a chain
+	// Unlimited when not set, it requires IsCA
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxPathLen *int `json:"maxPathLen,omitempty"`
+
 	// SecretRef is the reference to the secret where the certificate should be stored
 	// +kubebuilder:validation:Required
 	SecretRef SecretRef `json:"secretRef"`
 
+	// PrivateKey configures the private key generated for the certificate
+	// Defaults to a PKCS#1 encoded RSA 2048 key
+	// +optional
+	PrivateKey *PrivateKey `json:"privateKey,omitempty"`
+
+	// CombinedPEM writes the private key followed by the certificate chain to tls-combined.pem
+	// For consumers such as HAProxy that expect both in a single file
+	// +optional
+	CombinedPEM bool `json:"combinedPEM,omitempty"`
+
+	// Keystores configures keystores that are written to the secret next to tls.crt and tls.key
+	// They are regenerated whenever the certificate is rotated
+	// +optional
+	Keystores *Keystores `json:"keystores,omitempty"`
+
+	// SecretTemplate configures labels, annotations and key aliases that are set on the secret
+	// They are kept in sync on every reconcile, metadata added to the secret by others is left alone
+	// +optional
+	SecretTemplate *SecretTemplate `json:"secretTemplate,omitempty"`
+
+	// ReplicateTo copies the secret to other namespaces, for example to share a wildcard certificate
+	// The copies are kept in sync with the secret and removed from namespaces that are no longer selected
+	// +optional
+	ReplicateTo *SecretReplication `json:"replicateTo,omitempty"`
+
+	// IssuerRef is the reference to the Issuer or ClusterIssuer that signs the certificate
+	// The certificate is self-signed when no issuer is referenced
+	// +optional
+	IssuerRef *IssuerRef `json:"issuerRef,omitempty"`
+
 	// ReloadOnChange specifies if the deployment should be reloaded when the secret changes
 	// +optional
 	// +kubebuilder:default=false
 	ReloadOnChange bool `json:"reloadOnChange,omitempty"`
 
+	// ReloadMode is how workloads are restarted when ReloadOnChange is enabled
+	// Annotation sets a checksum of the certificate in a pod template annotation, so workloads only roll when it changes
+	// Env sets the resource version of the secret in the CERTIFICATE_RESOURCE_VERSION env of every container
+	// +optional
+	// +kubebuilder:default=Annotation
+	// +kubebuilder:validation:Enum=Annotation;Env
+	ReloadMode string `json:"reloadMode,omitempty"`
+
+	// ReloadStrategy configures how many workloads are restarted at the same time
+	// All workloads are restarted at once when it is not set
+	// +optional
+	ReloadStrategy *ReloadStrategy `json:"reloadStrategy,omitempty"`
+
 	// PurgeOnDelete specifies if the secret should be deleted when the certificate is deleted
 	// +optional
 	// +kubebuilder:default=false
@@ -61,6 +148,156 @@ type SecretRef struct {
 	Name string `json:"name"`
 }
 
+// SecretKeyRef is a reference to a key of a secret
+type SecretKeyRef struct {
+	// Name is the name of the secret
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Key is the key of the value in the secret
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+}
+
+// SecretTemplate configures the metadata and additional keys of the secret of a certificate
+type SecretTemplate struct {
+	// Labels are added to the secret
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to the secret
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// KeyAliases copies keys of the secret to additional keys, mapping each alias to its source key
+	// For example cert.pem: tls.crt and key.pem: tls.key for applications that expect those file names
+	// +optional
+	KeyAliases map[string]string `json:"keyAliases,omitempty"`
+}
+
+// SecretReplication selects the namespaces the secret of a certificate is copied to
+// A namespace is selected when it is listed or matches the selector, the namespace of the certificate is never selected
+type SecretReplication struct {
+	// Namespaces are the names of the namespaces the secret is copied to
+	// +optional
+	// +listType=set
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// NamespaceSelector selects the namespaces the secret is copied to by their labels
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// Keystores configures the keystores written to the secret of a certificate
+type Keystores struct {
+	// PKCS12 writes the private key and chain to keystore.p12 and the CA certificate to truststore.p12
+	// +optional
+	PKCS12 *Keystore `json:"pkcs12,omitempty"`
+
+	// JKS writes the private key and chain to keystore.jks and the CA certificate to truststore.jks
+	// +optional
+	JKS *Keystore `json:"jks,omitempty"`
+}
+
+// Keystore configures a keystore and its truststore
+// The truststore is only written when the secret contains a CA certificate in ca.crt
+type Keystore struct {
+	// PasswordSecretRef is the key of the secret holding the password of the keystore and the truststore
+	// The secret is read from the namespace of the certificate
+	// +kubebuilder:validation:Required
+	PasswordSecretRef SecretKeyRef `json:"passwordSecretRef"`
+}
+
+// ReloadStrategy configures the staggered restart of the workloads of a Certificate
+type ReloadStrategy struct {
+	// MaxConcurrent is the maximum number of workloads that are restarting at the same time
+	// Unlimited when not set
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxConcurrent *int `json:"maxConcurrent,omitempty"`
+
+	// WaitForAvailable keeps a restarted workload counting towards MaxConcurrent until its rollout
+	// completed and it is available again, otherwise the next workloads are restarted on the next reconcile
+	// +optional
+	WaitForAvailable bool `json:"waitForAvailable,omitempty"`
+}
+
+// KeyUsage is a key usage or extended key usage of a certificate, named after its x509 name
+// +kubebuilder:validation:Enum="digital signature";"content commitment";"key encipherment";"data encipherment";"key agreement";"cert sign";"crl sign";"encipher only";"decipher only";"any";"server auth";"client auth";"code signing";"email protection";"ipsec end system";"ipsec tunnel";"ipsec user";"timestamping";"ocsp signing"
+type KeyUsage string
+
+// Subject holds the x509 subject fields of a certificate
+type Subject struct {
+	// Organizations are the organization (O) names
+	// +optional
+	Organizations []string `json:"organizations,omitempty"`
+
+	// OrganizationalUnits are the organizational unit (OU) names
+	// +optional
+	OrganizationalUnits []string `json:"organizationalUnits,omitempty"`
+
+	// Countries are the country (C) codes
+	// +optional
+	Countries []string `json:"countries,omitempty"`
+
+	// Localities are the locality (L) names, such as cities
+	// +optional
+	Localities []string `json:"localities,omitempty"`
+
+	// Provinces are the state or province (ST) names
+	// +optional
+	Provinces []string `json:"provinces,omitempty"`
+
+	// StreetAddresses are the street addresses
+	// +optional
+	StreetAddresses []string `json:"streetAddresses,omitempty"`
+
+	// PostalCodes are the postal codes
+	// +optional
+	PostalCodes []string `json:"postalCodes,omitempty"`
+
+	// SerialNumber is the subject serial number attribute, which is unrelated to the certificate serial number
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+}
+
+// PrivateKey configures the algorithm, size and encoding of a private key
+type PrivateKey struct {
+	// Algorithm is the private key algorithm
+	// +optional
+	// +kubebuilder:default=RSA
+	// +kubebuilder:validation:Enum=RSA;ECDSA;Ed25519
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// Size is the key size in bits, 2048, 3072 or 4096 for RSA and 256 or 384 for ECDSA
+	// Defaults to 2048 for RSA and 256 for ECDSA, it must not be set for Ed25519
+	// +optional
+	Size int `json:"size,omitempty"`
+
+	// Encoding is the PEM encoding of the private key
+	// PKCS1 encodes ECDSA keys as SEC 1, Ed25519 keys are always encoded as PKCS8
+	// +optional
+	// +kubebuilder:default=PKCS1
+	// +kubebuilder:validation:Enum=PKCS1;PKCS8
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// IssuerRef is a reference to an Issuer or ClusterIssuer
+type IssuerRef struct {
+	// Name is the name of the issuer
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Kind is the kind of the issuer, either Issuer or ClusterIssuer
+	// +optional
+	// +kubebuilder:default=Issuer
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	Kind string `json:"kind,omitempty"`
+}
+
 // CertificateStatus defines the observed state of Certificate
 type CertificateStatus struct {
 	// Status is the current status of the certificate
@@ -74,12 +311,137 @@ type CertificateStatus struct {
 
 	// ExpiryDate is the date when the certificate expires
 	ExpiryDate metav1.Time `json:"expiryDate,omitempty"`
+
+	// NotBefore is the start of the validity period of the certificate stored in the Secret
+	// +optional
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+
+	// NotAfter is the end of the validity period of the certificate stored in the Secret
+	// +optional
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+
+	// SerialNumber is the serial number of the certificate as colon separated hex bytes
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// Fingerprint is the SHA-256 fingerprint of the certificate as colon separated hex bytes
+	// +optional
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// Issuer is the distinguished name of the issuer of the certificate
+	// +optional
+	Issuer string `json:"issuer,omitempty"`
+
+	// SubjectAlternativeNames are the subject alternative names of the certificate, such as "DNS:example.k8c.io"
+	// +optional
+	SubjectAlternativeNames []string `json:"subjectAlternativeNames,omitempty"`
+
+	// KeyAlgorithm is the algorithm of the certificate public key
+	// +optional
+	KeyAlgorithm string `json:"keyAlgorithm,omitempty"`
+
+	// KeySize is the size in bits of the certificate public key, it is not set for Ed25519
+	// +optional
+	KeySize int `json:"keySize,omitempty"`
+
+	// Workloads are the workloads that use the Secret or opted in and were reloaded when the certificate last changed
+	// +optional
+	Workloads []WorkloadReference `json:"workloads,omitempty"`
+
+	// Revision is the number of times a certificate was issued for the Certificate
+	// +optional
+	Revision int `json:"revision,omitempty"`
+
+	// CertificateRequest is the name of the CertificateRequest of the latest issuance
+	// +optional
+	CertificateRequest string `json:"certificateRequest,omitempty"`
+
+	// Reload is the progress of restarting the workloads for the certificate stored in the Secret
+	// +optional
+	Reload *ReloadStatus `json:"reload,omitempty"`
+
+	// Replicas are the copies of the Secret in the namespaces selected by ReplicateTo
+	// +optional
+	// +listType=map
+	// +listMapKey=namespace
+	Replicas []SecretReplicaStatus `json:"replicas,omitempty"`
+
+	// ObservedGeneration is the generation of the Certificate that was last reconciled
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions are the Ready, Issuing, Expiring and Expired conditions of the certificate
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// WorkloadReference is a workload that is reloaded for a Certificate
+type WorkloadReference struct {
+	// APIVersion is the API version of the workload
+	APIVersion string `json:"apiVersion"`
+
+	// Kind is the kind of the workload
+	Kind string `json:"kind"`
+
+	// Name is the name of the workload
+	Name string `json:"name"`
+
+	// Reasons are the places in the pod template that reference the Secret, or the annotation the workload opted in with
+	// +optional
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// SecretReplicaStatus is the state of a copy of the Secret in another namespace
+type SecretReplicaStatus struct {
+	// Namespace is the namespace of the copy
+	Namespace string `json:"namespace"`
+
+	// Synced reports whether the copy holds the current data of the Secret
+	Synced bool `json:"synced"`
+
+	// Message describes why the copy could not be written
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ReloadStatus is the progress of restarting the workloads of a Certificate
+// It is derived from the pod templates of the workloads, so a restarted controller resumes where it stopped
+type ReloadStatus struct {
+	// Revision is the checksum or resource version of the Secret the workloads are restarted for
+	Revision string `json:"revision"`
+
+	// Total is the number of workloads to restart
+	Total int `json:"total"`
+
+	// Updated is the number of workloads whose pod template has been updated to the revision
+	Updated int `json:"updated"`
+
+	// Completed is the number of updated workloads that finished restarting
+	Completed int `json:"completed"`
+
+	// Restarting are the workloads that are restarting, as kind/name
+	// +optional
+	Restarting []string `json:"restarting,omitempty"`
+
+	// StartTime is when restarting the workloads for the revision started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when all workloads finished restarting for the revision
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
 // +kubebuilder:resource:path=certificates,scope=Namespaced
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Secret",type="string",JSONPath=`.spec.secretRef.name`
+// +kubebuilder:printcolumn:name="Expiry",type="date",JSONPath=`.status.expiryDate`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
 
 // Certificate is the Schema for the certificates API
 type Certificate struct {
@@ -0,0 +1,164 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CertificateRequestSpec defines the desired state of CertificateRequest
+type CertificateRequestSpec struct {
+	// Request is the PEM encoded PKCS#10 certificate signing request
+	// The subject and subject alternative names of the certificate are taken from it
+	// +kubebuilder:validation:Required
+	Request []byte `json:"request"`
+
+	// IssuerRef is the reference to the Issuer or ClusterIssuer that signs the certificate
+	// The certificate is self-signed when no issuer is referenced, which requires the private key annotation
+	// +optional
+	IssuerRef *IssuerRef `json:"issuerRef,omitempty"`
+
+	// Duration is the requested time until the certificate expires, issuers may cap it
+	// Valid time units are "s", "m", "h", "d" (seconds, minutes, hours, days)
+	// Defaults to 90 days
+	// +optional
+	// +kubebuilder:validation:Pattern="^([0-9]+)(s|m|h|d)$"
+	Duration string `json:"duration,omitempty"`
+
+	// Usages are the key usages and extended key usages of the certificate
+	// Defaults to "digital signature", "key encipherment" and "server auth"
+	// +optional
+	// +listType=set
+	Usages []KeyUsage `json:"usages,omitempty"`
+
+	// IsCA requests a CA certificate, which adds the "cert sign" usage
+	// +optional
+	IsCA bool `json:"isCA,omitempty"`
+
+	// MaxPathLen is the maximum number of intermediate CAs that may follow a CA certificate in a chain
+	// Unlimited when not set, it requires IsCA
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxPathLen *int `json:"maxPathLen,omitempty"`
+}
+
+// CertificateRequestStatus defines the observed state of CertificateRequest
+type CertificateRequestStatus struct {
+	// Certificate is the PEM encoded signed certificate followed by any intermediates
+	// +optional
+	Certificate []byte `json:"certificate,omitempty"`
+
+	// CA is the PEM encoded certificate of the issuing CA, if known
+	// +optional
+	CA []byte `json:"ca,omitempty"`
+
+	// FailureTime is when signing the request last failed
+	// +optional
+	FailureTime *metav1.Time `json:"failureTime,omitempty"`
+
+	// ACME is the order of the certificate at the ACME server, when it is issued by an ACME issuer
+	// +optional
+	ACME *ACMEOrderStatus `json:"acme,omitempty"`
+
+	// Conditions are the Approved, Denied and Ready conditions of the request
+	// A request is only signed once it is approved, approval and denial are final
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ACMEOrderStatus tracks an order at an ACME server and the challenges presented for it
+// An order that is not invalid is resumed by the next reconcile
+type ACMEOrderStatus struct {
+	// URL is the URL of the order
+	URL string `json:"url"`
+
+	// State is the state of the order, one of pending, ready, processing, valid and invalid
+	State string `json:"state"`
+
+	// Identifiers are the names the certificate is ordered for
+	// +optional
+	Identifiers []string `json:"identifiers,omitempty"`
+
+	// Reason describes why the order became invalid
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Challenges are the challenges presented for the authorizations of the order
+	// +optional
+	Challenges []ACMEChallengeStatus `json:"challenges,omitempty"`
+}
+
+// ACMEChallengeStatus is a challenge presented to prove control over a name
+type ACMEChallengeStatus struct {
+	// DNSName is the name the challenge is for
+	DNSName string `json:"dnsName"`
+
+	// Type is the type of the challenge, http-01 or dns-01
+	Type string `json:"type"`
+
+	// URL is the URL of the challenge
+	URL string `json:"url"`
+
+	// Token is the token of the challenge
+	Token string `json:"token"`
+
+	// State is the state of the challenge, one of pending, processing, valid and invalid
+	State string `json:"state"`
+
+	// Presented is set once the key authorization of the challenge is presented
+	// The challenge is accepted once the self check finds the key authorization served for the name
+	// +optional
+	Presented bool `json:"presented,omitempty"`
+
+	// Reason describes why the challenge did not pass the self check yet or became invalid
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=certificaterequests,scope=Namespaced,shortName=cr
+// +kubebuilder:printcolumn:name="Approved",type="string",JSONPath=`.status.conditions[?(@.type=="Approved")].status`
+// +kubebuilder:printcolumn:name="Denied",type="string",JSONPath=`.status.conditions[?(@.type=="Denied")].status`
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Issuer",type="string",JSONPath=`.spec.issuerRef.name`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
+
+// CertificateRequest is the Schema for the certificaterequests API
+// It asks an issuer to sign a CSR, so the private key never has to leave its owner
+type CertificateRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CertificateRequestSpec   `json:"spec,omitempty"`
+	Status CertificateRequestStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CertificateRequestList contains a list of CertificateRequest
+type CertificateRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CertificateRequest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CertificateRequest{}, &CertificateRequestList{})
+}
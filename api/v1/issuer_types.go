@@ -0,0 +1,238 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IssuerSpec defines the desired state of Issuer and ClusterIssuer
+// Exactly one issuer type must be configured
+type IssuerSpec struct {
+	// SelfSigned issues certificates that are signed by their own private key
+	// +optional
+	SelfSigned *SelfSignedIssuer `json:"selfSigned,omitempty"`
+
+	// CA issues certificates signed by a CA key pair stored in a Secret
+	// +optional
+	CA *CAIssuer `json:"ca,omitempty"`
+
+	// ACME orders certificates from an ACME server such as Let's Encrypt
+	// +optional
+	ACME *ACMEIssuer `json:"acme,omitempty"`
+
+	// Vault signs certificates with the PKI secrets engine of HashiCorp Vault
+	// +optional
+	Vault *VaultIssuer `json:"vault,omitempty"`
+
+	// Webhook has an external signing service sign certificates with the webhook protocol
+	// +optional
+	Webhook *WebhookIssuer `json:"webhook,omitempty"`
+}
+
+// SelfSignedIssuer configures an issuer that self-signs certificates
+type SelfSignedIssuer struct{}
+
+// CAIssuer configures an issuer that signs certificates with a CA key pair
+type CAIssuer struct {
+	// SecretName is the name of the Secret holding the CA certificate in tls.crt and its private key in tls.key
+	// An optional ca.crt holds the root certificate if tls.crt is an intermediate
+	// The Secret is read from the namespace of the Issuer, or the cluster resource namespace for a ClusterIssuer
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	SecretName string `json:"secretName"`
+}
+
+// ACMEIssuer configures an issuer that orders certificates from an ACME server
+type ACMEIssuer struct {
+	// Server is the directory URL of the ACME server, such as https://acme-v02.api.letsencrypt.org/directory
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Server string `json:"server"`
+
+	// Email is the contact email address of the ACME account
+	// +optional
+	Email string `json:"email,omitempty"`
+
+	// PrivateKeySecretRef is the Secret holding the ECDSA P-256 account key in tls.key
+	// The key is generated when the Secret does not exist
+	// The Secret is read from the namespace of the Issuer, or the cluster resource namespace for a ClusterIssuer
+	// +kubebuilder:validation:Required
+	PrivateKeySecretRef SecretRef `json:"privateKeySecretRef"`
+
+	// CABundle is the PEM encoded CA bundle that verifies the TLS certificate of the ACME server
+	// The system roots are used when it is not set
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// Solvers solve the challenges of the ACME server, the first solver whose selector matches a name is used for it
+	// +kubebuilder:validation:MinItems=1
+	Solvers []ACMESolver `json:"solvers"`
+}
+
+// ACMESolver configures how the challenges for the names matching its selector are solved
+// Exactly one of HTTP01 and DNS01 must be configured
+type ACMESolver struct {
+	// Selector limits the names the solver is used for, it is used for all names when not set
+	// +optional
+	Selector *ACMESolverSelector `json:"selector,omitempty"`
+
+	// HTTP01 solves http-01 challenges by serving the key authorization from a temporary Pod, Service and Ingress
+	// +optional
+	HTTP01 *ACMEHTTP01Solver `json:"http01,omitempty"`
+
+	// DNS01 solves dns-01 challenges with TXT records created by a DNS provider
+	// Wildcard names can only be solved with dns-01
+	// +optional
+	DNS01 *ACMEDNS01Solver `json:"dns01,omitempty"`
+}
+
+// ACMESolverSelector selects the names a solver is used for
+type ACMESolverSelector struct {
+	// DNSNames are the names the solver is used for
+	// +optional
+	DNSNames []string `json:"dnsNames,omitempty"`
+
+	// DNSZones are the zones whose names and subdomains the solver is used for
+	// +optional
+	DNSZones []string `json:"dnsZones,omitempty"`
+}
+
+// ACMEHTTP01Solver configures the temporary Ingress that serves http-01 challenges
+type ACMEHTTP01Solver struct {
+	// IngressClassName is the class of the temporary Ingress, the default class is used when not set
+	// +optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+}
+
+// ACMEDNS01Solver configures the DNS provider that creates the TXT records of dns-01 challenges
+type ACMEDNS01Solver struct {
+	// Provider is the name of the DNS provider, such as cloudflare
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Provider string `json:"provider"`
+
+	// ConfigSecretRef is the Secret holding the configuration of the provider, such as the api-token for cloudflare
+	// The Secret is read from the namespace of the Issuer, or the cluster resource namespace for a ClusterIssuer
+	// +optional
+	ConfigSecretRef *SecretRef `json:"configSecretRef,omitempty"`
+}
+
+// VaultIssuer configures an issuer that has a role of the Vault PKI secrets engine sign certificates
+// The subject and names are taken from the CSR, the usages and the maximum lifetime are decided by the role
+type VaultIssuer struct {
+	// Server is the URL of the Vault server, such as https://vault.example.com:8200
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Server string `json:"server"`
+
+	// Path is the path of the sign endpoint of the PKI role, such as pki/sign/example-dot-com
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Path string `json:"path"`
+
+	// Namespace is the Vault Enterprise namespace of the PKI secrets engine and the auth method
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// CABundle is the PEM encoded CA bundle that verifies the TLS certificate of the Vault server
+	// The system roots are used when it is not set
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// Auth configures how the controller authenticates to Vault
+	// +kubebuilder:validation:Required
+	Auth VaultAuth `json:"auth"`
+}
+
+// VaultAuth configures the authentication to Vault
+// Exactly one of TokenSecretRef and Kubernetes must be configured
+type VaultAuth struct {
+	// TokenSecretRef is the Secret holding a Vault token in the token key
+	// The Secret is read from the namespace of the Issuer, or the cluster resource namespace for a ClusterIssuer
+	// +optional
+	TokenSecretRef *SecretRef `json:"tokenSecretRef,omitempty"`
+
+	// Kubernetes logs in with the Kubernetes auth method using a token of a ServiceAccount
+	// +optional
+	Kubernetes *VaultKubernetesAuth `json:"kubernetes,omitempty"`
+}
+
+// VaultKubernetesAuth configures a login with the Kubernetes auth method of Vault
+type VaultKubernetesAuth struct {
+	// MountPath is the path the Kubernetes auth method is mounted at
+	// Defaults to kubernetes
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	// Role is the role of the Kubernetes auth method to log in with
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Role string `json:"role"`
+
+	// ServiceAccountName is the ServiceAccount whose token is used to log in
+	// A short-lived token with the audience vault is requested for every login
+	// The ServiceAccount is read from the namespace of the Issuer, or the cluster resource namespace for a ClusterIssuer
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	ServiceAccountName string `json:"serviceAccountName"`
+}
+
+// WebhookIssuer configures an issuer that has an external signing service sign certificates
+// The CSR, the usages and the duration of every CertificateRequest are sent to the service, which returns the certificate chain
+type WebhookIssuer struct {
+	// URL is the HTTPS endpoint of the signing service, such as https://signer.example.com/sign
+	// +kubebuilder:validation:Pattern=`^https://`
+	// +kubebuilder:validation:Required
+	URL string `json:"url"`
+
+	// CABundle is the PEM encoded CA bundle that verifies the TLS certificate of the signing service
+	// The system roots are used when it is not set
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// ClientCertificateSecretRef is the Secret holding the client certificate in tls.crt and its private key in tls.key
+	// The controller authenticates to the signing service with it
+	// The Secret is read from the namespace of the Issuer, or the cluster resource namespace for a ClusterIssuer
+	// +optional
+	ClientCertificateSecretRef *SecretRef `json:"clientCertificateSecretRef,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=issuers,scope=Namespaced
+
+// Issuer is the Schema for the issuers API
+// An Issuer can only sign certificates in its own namespace
+type Issuer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec IssuerSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IssuerList contains a list of Issuer
+type IssuerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Issuer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Issuer{}, &IssuerList{})
+}
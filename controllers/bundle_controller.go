@@ -0,0 +1,521 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/k8s"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/keystore"
+)
+
+// bundleFormat is a truststore format a Bundle can be written to
+type bundleFormat struct {
+	name   string
+	encode func(certificates []*x509.Certificate, password string) ([]byte, error)
+	spec   func(formats *certsv1.BundleFormats) *certsv1.BundleFormat
+}
+
+// bundleFormats are the supported truststore formats of a Bundle
+var bundleFormats = []bundleFormat{
+	{
+		name:   "pkcs12",
+		encode: keystore.EncodePKCS12TrustStore,
+		spec:   func(formats *certsv1.BundleFormats) *certsv1.BundleFormat { return formats.PKCS12 },
+	},
+	{
+		name:   "jks",
+		encode: keystore.EncodeJKSTrustStore,
+		spec:   func(formats *certsv1.BundleFormats) *certsv1.BundleFormat { return formats.JKS },
+	},
+}
+
+// BundleReconciler writes the CA certificates of Bundles to a ConfigMap in every selected namespace
+type BundleReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+
+	// ClusterResourceNamespace is the namespace in which the Secrets and ConfigMaps of Bundle sources are looked up
+	ClusterResourceNamespace string
+}
+
+// bundleContent is the content of the ConfigMaps of a Bundle
+type bundleContent struct {
+	data       map[string]string
+	binaryData map[string][]byte
+	hash       string
+}
+
+// +kubebuilder:rbac:groups=certs.k8c.io,resources=bundles,verbs=get;list;watch
+// +kubebuilder:rbac:groups=certs.k8c.io,resources=bundles/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+func (r *BundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("bundle", req.Name)
+	log.Info("Request received to reconcile Bundle")
+
+	instance := &certsv1.Bundle{}
+	if err := r.Get(ctx, req.NamespacedName, instance); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The ConfigMaps are owned by the Bundle and removed by the garbage collector
+			log.Info("Bundle resource not found. Ignoring since object must be deleted")
+			return k8s.DoNotRequeue()
+		}
+		log.Error(err, "Failed to get Bundle")
+		return k8s.RequeueWithError(err)
+	}
+	if instance.DeletionTimestamp != nil {
+		return k8s.DoNotRequeue()
+	}
+
+	// An invalid spec is not retried until it changes
+	if err := validateBundleSpec(&instance.Spec); err != nil {
+		log.Error(err, "Invalid Bundle")
+		if err := r.setReady(ctx, instance, metav1.ConditionFalse, constants.ReasonInvalidSpec, err.Error()); err != nil {
+			return k8s.RequeueWithError(err)
+		}
+		return k8s.DoNotRequeue()
+	}
+
+	certificates, err := r.getBundleCertificates(ctx, instance)
+	if err != nil {
+		log.Error(err, "Failed to read Bundle sources")
+		if err := r.setReady(ctx, instance, metav1.ConditionFalse, constants.ReasonFailed, err.Error()); err != nil {
+			log.Error(err, "Failed to set status to failed")
+		}
+		return k8s.RequeueWithError(err)
+	}
+
+	content, err := getBundleContent(&instance.Spec.Target, certificates)
+	if err != nil {
+		log.Error(err, "Failed to encode Bundle")
+		if err := r.setReady(ctx, instance, metav1.ConditionFalse, constants.ReasonFailed, err.Error()); err != nil {
+			log.Error(err, "Failed to set status to failed")
+		}
+		return k8s.RequeueWithError(err)
+	}
+
+	namespaces, err := r.getBundleNamespaces(ctx, instance)
+	if err != nil {
+		log.Error(err, "Failed to list Bundle namespaces")
+		return k8s.RequeueWithError(err)
+	}
+
+	// Every namespace is written in this reconcile, so rotated CAs reach all of them at once
+	var errs []error
+	for _, namespace := range namespaces {
+		if err := r.syncConfigMap(ctx, instance, namespace, content); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := r.deleteStaleConfigMaps(ctx, instance, namespaces); err != nil {
+		errs = append(errs, err)
+	}
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		log.Error(err, "Failed to write Bundle")
+		if err := r.setReady(ctx, instance, metav1.ConditionFalse, constants.ReasonFailed, err.Error()); err != nil {
+			log.Error(err, "Failed to set status to failed")
+		}
+		return k8s.RequeueWithError(err)
+	}
+
+	patchBase := client.MergeFrom(instance.DeepCopy())
+	instance.Status.Certificates = len(certificates)
+	instance.Status.Namespaces = len(namespaces)
+	setBundleCondition(instance, metav1.ConditionTrue, constants.ReasonSynced,
+		fmt.Sprintf("Bundle of %d certificates is written to %d namespaces", len(certificates), len(namespaces)))
+	if err := r.Status().Patch(ctx, instance, patchBase); err != nil {
+		log.Error(err, "Failed to patch Bundle status")
+		return k8s.RequeueWithError(err)
+	}
+
+	log.Info("Reconciliation successful")
+	return k8s.DoNotRequeue()
+}
+
+// validateBundleSpec validates the parts of the Bundle spec the CRD schema can not
+func validateBundleSpec(spec *certsv1.BundleSpec) error {
+	var errs []error
+
+	for i, source := range spec.Sources {
+		set := 0
+		if source.Secret != nil {
+			set++
+		}
+		if source.ConfigMap != nil {
+			set++
+		}
+		if source.InLine != "" {
+			set++
+		}
+		if set != 1 {
+			errs = append(errs, fmt.Errorf("source %d must set exactly one of secret, configMap or inLine", i))
+		}
+	}
+
+	keys := map[string]bool{spec.Target.Key: true}
+	if msgs := validation.IsConfigMapKey(spec.Target.Key); len(msgs) > 0 {
+		errs = append(errs, fmt.Errorf("invalid target key %q: %s", spec.Target.Key, strings.Join(msgs, ", ")))
+	}
+	if spec.Target.AdditionalFormats != nil {
+		for _, format := range bundleFormats {
+			formatSpec := format.spec(spec.Target.AdditionalFormats)
+			if formatSpec == nil {
+				continue
+			}
+			if msgs := validation.IsConfigMapKey(formatSpec.Key); len(msgs) > 0 {
+				errs = append(errs, fmt.Errorf("invalid %s key %q: %s", format.name, formatSpec.Key, strings.Join(msgs, ", ")))
+			}
+			if keys[formatSpec.Key] {
+				errs = append(errs, fmt.Errorf("%s key %q is already used by another format", format.name, formatSpec.Key))
+			}
+			keys[formatSpec.Key] = true
+		}
+	}
+
+	if _, err := metav1.LabelSelectorAsSelector(spec.Target.NamespaceSelector); err != nil {
+		errs = append(errs, fmt.Errorf("invalid namespaceSelector: %w", err))
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// getBundleCertificates returns the distinct certificates of all sources of the Bundle
+// They are ordered by subject and fingerprint, so the bundle does not depend on the order of the sources
+func (r *BundleReconciler) getBundleCertificates(ctx context.Context, instance *certsv1.Bundle) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	seen := map[string]bool{}
+	for _, source := range instance.Spec.Sources {
+		data, name, err := r.getSourceData(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := cert.ParseCertificates(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificates in %s: %w", name, err)
+		}
+		for _, certificate := range parsed {
+			fingerprint := cert.Fingerprint(certificate)
+			if seen[fingerprint] {
+				continue
+			}
+			seen[fingerprint] = true
+			certificates = append(certificates, certificate)
+		}
+	}
+
+	sort.Slice(certificates, func(i, j int) bool {
+		if subjectI, subjectJ := certificates[i].Subject.String(), certificates[j].Subject.String(); subjectI != subjectJ {
+			return subjectI < subjectJ
+		}
+		return cert.Fingerprint(certificates[i]) < cert.Fingerprint(certificates[j])
+	})
+	return certificates, nil
+}
+
+// getSourceData returns the PEM encoded certificates of the source and a name of the source for errors
+func (r *BundleReconciler) getSourceData(ctx context.Context, source certsv1.BundleSource) ([]byte, string, error) {
+	switch {
+	case source.Secret != nil:
+		name := fmt.Sprintf("Secret %s/%s", r.ClusterResourceNamespace, source.Secret.Name)
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: source.Secret.Name, Namespace: r.ClusterResourceNamespace}, secret); err != nil {
+			return nil, name, fmt.Errorf("failed to get %s: %w", name, err)
+		}
+		data, ok := secret.Data[source.Secret.Key]
+		if !ok {
+			return nil, name, fmt.Errorf("%s has no %s key", name, source.Secret.Key)
+		}
+		return data, name, nil
+	case source.ConfigMap != nil:
+		name := fmt.Sprintf("ConfigMap %s/%s", r.ClusterResourceNamespace, source.ConfigMap.Name)
+		configMap := &corev1.ConfigMap{}
+		if err := r.Get(ctx, types.NamespacedName{Name: source.ConfigMap.Name, Namespace: r.ClusterResourceNamespace}, configMap); err != nil {
+			return nil, name, fmt.Errorf("failed to get %s: %w", name, err)
+		}
+		data, ok := configMap.Data[source.ConfigMap.Key]
+		if !ok {
+			return nil, name, fmt.Errorf("%s has no %s key", name, source.ConfigMap.Key)
+		}
+		return []byte(data), name, nil
+	default:
+		return []byte(source.InLine), "inline source", nil
+	}
+}
+
+// getBundleContent encodes the certificates as PEM and as the configured truststores
+// The hash covers everything the content is built from, so unchanged ConfigMaps are not rewritten with new random salts
+func getBundleContent(target *certsv1.BundleTarget, certificates []*x509.Certificate) (*bundleContent, error) {
+	var bundle []byte
+	for _, certificate := range certificates {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: certificate.Raw})...)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(target.Key))
+	hash.Write([]byte{0})
+	hash.Write(bundle)
+
+	content := &bundleContent{data: map[string]string{target.Key: string(bundle)}}
+	if target.AdditionalFormats != nil {
+		for _, format := range bundleFormats {
+			formatSpec := format.spec(target.AdditionalFormats)
+			if formatSpec == nil {
+				continue
+			}
+			data, err := format.encode(certificates, formatSpec.Password)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s truststore: %w", format.name, err)
+			}
+			if content.binaryData == nil {
+				content.binaryData = map[string][]byte{}
+			}
+			content.binaryData[formatSpec.Key] = data
+
+			for _, value := range []string{format.name, formatSpec.Key, formatSpec.Password} {
+				hash.Write([]byte{0})
+				hash.Write([]byte(value))
+			}
+		}
+	}
+	content.hash = hex.EncodeToString(hash.Sum(nil))
+	return content, nil
+}
+
+// getBundleNamespaces returns the names of the active namespaces selected by the Bundle in sorted order
+func (r *BundleReconciler) getBundleNamespaces(ctx context.Context, instance *certsv1.Bundle) ([]string, error) {
+	selector := labels.Everything()
+	if instance.Spec.Target.NamespaceSelector != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(instance.Spec.Target.NamespaceSelector); err != nil {
+			return nil, err
+		}
+	}
+
+	namespaceList := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaceList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	var namespaces []string
+	for _, namespace := range namespaceList.Items {
+		if namespace.Status.Phase == corev1.NamespaceTerminating || namespace.DeletionTimestamp != nil {
+			continue
+		}
+		namespaces = append(namespaces, namespace.Name)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// syncConfigMap writes the bundle to the ConfigMap of the Bundle in the namespace
+// ConfigMaps of the same name that were not created for the Bundle are left alone
+func (r *BundleReconciler) syncConfigMap(ctx context.Context, instance *certsv1.Bundle, namespace string, content *bundleContent) error {
+	configMap := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: instance.Name, Namespace: namespace}, configMap)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	if found {
+		if configMap.Labels[constants.LabelBundleName] != instance.Name {
+			return fmt.Errorf("ConfigMap %s/%s already exists and is not managed by the Bundle", namespace, instance.Name)
+		}
+		if configMap.Annotations[constants.AnnotationBundleHash] == content.hash && bundleContentMatches(configMap, content) {
+			return nil
+		}
+	} else {
+		configMap.Name = instance.Name
+		configMap.Namespace = namespace
+	}
+
+	if configMap.Labels == nil {
+		configMap.Labels = map[string]string{}
+	}
+	configMap.Labels[constants.LabelBundleName] = instance.Name
+	if configMap.Annotations == nil {
+		configMap.Annotations = map[string]string{}
+	}
+	configMap.Annotations[constants.AnnotationBundleHash] = content.hash
+	configMap.Data = content.data
+	configMap.BinaryData = content.binaryData
+	if err := controllerutil.SetControllerReference(instance, configMap, r.Scheme); err != nil {
+		return err
+	}
+
+	if found {
+		r.Log.Info("Updating Bundle ConfigMap", "bundle", instance.Name, "namespace", namespace)
+		return r.Update(ctx, configMap)
+	}
+	r.Log.Info("Creating Bundle ConfigMap", "bundle", instance.Name, "namespace", namespace)
+	return r.Create(ctx, configMap)
+}
+
+// bundleContentMatches reports whether the ConfigMap holds exactly the keys of the content and the PEM bundle
+// The truststores are compared by key only, their encoding is covered by the hash annotation
+func bundleContentMatches(configMap *corev1.ConfigMap, content *bundleContent) bool {
+	if len(configMap.Data) != len(content.data) || len(configMap.BinaryData) != len(content.binaryData) {
+		return false
+	}
+	for key, value := range content.data {
+		if configMap.Data[key] != value {
+			return false
+		}
+	}
+	for key := range content.binaryData {
+		if len(configMap.BinaryData[key]) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// deleteStaleConfigMaps deletes the ConfigMaps of the Bundle in namespaces that are no longer selected
+func (r *BundleReconciler) deleteStaleConfigMaps(ctx context.Context, instance *certsv1.Bundle, namespaces []string) error {
+	selected := map[string]bool{}
+	for _, namespace := range namespaces {
+		selected[namespace] = true
+	}
+
+	configMaps := &corev1.ConfigMapList{}
+	if err := r.List(ctx, configMaps, client.MatchingLabels{constants.LabelBundleName: instance.Name}); err != nil {
+		return err
+	}
+	var errs []error
+	for i := range configMaps.Items {
+		configMap := &configMaps.Items[i]
+		if selected[configMap.Namespace] || configMap.Name != instance.Name {
+			continue
+		}
+		r.Log.Info("Deleting stale Bundle ConfigMap", "bundle", instance.Name, "namespace", configMap.Namespace)
+		if err := r.Delete(ctx, configMap); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// setReady sets the Ready condition of the Bundle and patches its status
+func (r *BundleReconciler) setReady(ctx context.Context, instance *certsv1.Bundle, status metav1.ConditionStatus, reason, message string) error {
+	patchBase := client.MergeFrom(instance.DeepCopy())
+	setBundleCondition(instance, status, reason, message)
+	if err := r.Status().Patch(ctx, instance, patchBase); err != nil {
+		r.Log.Error(err, "Failed to patch Bundle status", "bundle", instance.Name)
+		return err
+	}
+	return nil
+}
+
+// setBundleCondition sets the Ready condition of the Bundle
+func setBundleCondition(instance *certsv1.Bundle, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:               constants.ConditionReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: instance.Generation,
+	})
+}
+
+// mapSourceToBundles returns the Bundles that read the Secret or ConfigMap of the cluster resource namespace
+func (r *BundleReconciler) mapSourceToBundles(object client.Object) []reconcile.Request {
+	if object.GetNamespace() != r.ClusterResourceNamespace {
+		return nil
+	}
+	_, isSecret := object.(*corev1.Secret)
+
+	bundles := &certsv1.BundleList{}
+	if err := r.List(context.Background(), bundles); err != nil {
+		r.Log.Error(err, "Failed to list Bundles")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, bundle := range bundles.Items {
+		for _, source := range bundle.Spec.Sources {
+			if (isSecret && source.Secret != nil && source.Secret.Name == object.GetName()) ||
+				(!isSecret && source.ConfigMap != nil && source.ConfigMap.Name == object.GetName()) {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: bundle.Name}})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// mapNamespacesToBundles returns all Bundles, any of them may select a new or relabeled namespace
+func (r *BundleReconciler) mapNamespacesToBundles() []reconcile.Request {
+	bundles := &certsv1.BundleList{}
+	if err := r.List(context.Background(), bundles); err != nil {
+		r.Log.Error(err, "Failed to list Bundles")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(bundles.Items))
+	for _, bundle := range bundles.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: bundle.Name}})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// Changes of sources, namespaces and the ConfigMaps of a Bundle are watched, so the bundle is rewritten right away
+func (r *BundleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&certsv1.Bundle{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&corev1.ConfigMap{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(func(object client.Object) []reconcile.Request {
+			return r.mapSourceToBundles(object)
+		})).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(func(object client.Object) []reconcile.Request {
+			return r.mapSourceToBundles(object)
+		})).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(func(client.Object) []reconcile.Request {
+			return r.mapNamespacesToBundles()
+		}), builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		Complete(r)
+}
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+)
+
+func TestBundleController(t *testing.T) {
+	t.Run("BundleWithSources", TestBundleWithSources)
+	t.Run("BundleTargetNamespaces", TestBundleTargetNamespaces)
+	t.Run("BundleWithInvalidSources", TestBundleWithInvalidSources)
+}
+
+// setupBundleTestEnv sets up the test environment of the Bundle controller with the given namespaces and their labels
+func setupBundleTestEnv(t *testing.T, namespaces map[string]map[string]string) *BundleReconciler {
+	r := setupTestEnv()
+	for name, labels := range namespaces {
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+		err := r.Create(context.Background(), namespace)
+		assert.NoError(t, err, "Namespace should be created")
+	}
+	return &BundleReconciler{
+		Client:                   r.Client,
+		Log:                      r.Log,
+		Scheme:                   r.Scheme,
+		ClusterResourceNamespace: "certificate-manager",
+	}
+}
+
+// TestBundleWithSources tests a Bundle of a Secret, a ConfigMap and inline certificates written to the selected namespaces
+// Duplicate certificates should be added once and a rotated CA should reach every namespace in one reconcile
+func TestBundleWithSources(t *testing.T) {
+	// Setup the test environment
+	selected := map[string]string{"certs.k8c.io/inject-ca": "true"}
+	r := setupBundleTestEnv(t, map[string]map[string]string{
+		"certificate-manager": nil,
+		"team-a":              selected,
+		"team-b":              selected,
+		"other":               nil,
+	})
+
+	caA, _ := getCAKeyPair(t, true)
+	caB, _ := getCAKeyPair(t, true)
+	caC, _ := getCAKeyPair(t, true)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ca-key-pair", Namespace: "certificate-manager"},
+		Data:       map[string][]byte{"ca.crt": caA},
+	}
+	err := r.Create(context.Background(), secret)
+	assert.NoError(t, err, "Source Secret should be created")
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "partner-cas", Namespace: "certificate-manager"},
+		Data:       map[string]string{"ca-bundle.crt": string(caB) + string(caC)},
+	}
+	err = r.Create(context.Background(), configMap)
+	assert.NoError(t, err, "Source ConfigMap should be created")
+
+	instance := &certsv1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "internal-ca"},
+		Spec: certsv1.BundleSpec{
+			Sources: []certsv1.BundleSource{
+				{Secret: &certsv1.SecretKeyRef{Name: "ca-key-pair", Key: "ca.crt"}},
+				{ConfigMap: &certsv1.ConfigMapKeyRef{Name: "partner-cas", Key: "ca-bundle.crt"}},
+				{InLine: string(caB)},
+			},
+			Target: certsv1.BundleTarget{
+				Key:               "ca-bundle.crt",
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: selected},
+				AdditionalFormats: &certsv1.BundleFormats{
+					PKCS12: &certsv1.BundleFormat{Key: "truststore.p12", Password: "changeit"},
+					JKS:    &certsv1.BundleFormat{Key: "truststore.jks", Password: "changeit"},
+				},
+			},
+		},
+	}
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Bundle should be created")
+
+	err = triggerBundleReconcile(r, "internal-ca")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	bundle := getBundle(t, r, "internal-ca")
+	assert.True(t, meta.IsStatusConditionTrue(bundle.Status.Conditions, constants.ConditionReady), "Bundle should be ready")
+	assert.Equal(t, 3, bundle.Status.Certificates, "Duplicate certificates should be added once")
+	assert.Equal(t, 2, bundle.Status.Namespaces, "Bundle should be written to the selected namespaces")
+
+	// Both selected namespaces should get the same bundle
+	target := getBundleConfigMap(t, r, "team-a")
+	certificates, err := cert.ParseCertificates([]byte(target.Data["ca-bundle.crt"]))
+	assert.NoError(t, err, "ConfigMap should contain the certificates")
+	assert.Len(t, certificates, 3, "ConfigMap should contain every distinct certificate")
+	for i := 1; i < len(certificates); i++ {
+		assert.Less(t, cert.Fingerprint(certificates[i-1]), cert.Fingerprint(certificates[i]), "Certificates should be ordered")
+	}
+	for _, certificate := range certificates {
+		assert.True(t, bytes.Contains(target.BinaryData["truststore.jks"], certificate.Raw), "JKS should contain every certificate")
+	}
+	assert.NotEmpty(t, target.BinaryData["truststore.p12"], "ConfigMap should contain the PKCS#12 truststore")
+	assert.Equal(t, "internal-ca", target.Labels[constants.LabelBundleName], "ConfigMap should be labeled with the Bundle")
+	assert.Equal(t, target.Data, getBundleConfigMap(t, r, "team-b").Data, "Namespaces should get the same bundle")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "internal-ca", Namespace: "other"}, &corev1.ConfigMap{})
+	assert.Error(t, err, "Unselected namespaces should not get the bundle")
+
+	// An unchanged bundle should not rewrite the truststores
+	truststore := target.BinaryData["truststore.p12"]
+	err = triggerBundleReconcile(r, "internal-ca")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.Equal(t, truststore, getBundleConfigMap(t, r, "team-a").BinaryData["truststore.p12"], "Truststore should not be rewritten")
+
+	// A rotated CA should replace the old one in every namespace
+	caD, _ := getCAKeyPair(t, true)
+	secret.Data["ca.crt"] = caD
+	err = r.Update(context.Background(), secret)
+	assert.NoError(t, err, "Source Secret should be updated")
+	err = triggerBundleReconcile(r, "internal-ca")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	for _, namespace := range []string{"team-a", "team-b"} {
+		target := getBundleConfigMap(t, r, namespace)
+		assert.Contains(t, target.Data["ca-bundle.crt"], string(caD), "Rotated CA should be written to %s", namespace)
+		assert.NotContains(t, target.Data["ca-bundle.crt"], string(caA), "Old CA should be removed from %s", namespace)
+		assert.NotEqual(t, truststore, target.BinaryData["truststore.p12"], "Truststore should be rewritten in %s", namespace)
+	}
+}
+
+// TestBundleTargetNamespaces tests the ConfigMaps of a Bundle when namespaces stop matching the selector
+// ConfigMaps of the same name that were not written for the Bundle should be left alone
+func TestBundleTargetNamespaces(t *testing.T) {
+	// Setup the test environment
+	r := setupBundleTestEnv(t, map[string]map[string]string{
+		"team-a": nil,
+		"team-b": nil,
+		"other":  nil,
+	})
+
+	ca, _ := getCAKeyPair(t, true)
+	instance := &certsv1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "internal-ca"},
+		Spec: certsv1.BundleSpec{
+			Sources: []certsv1.BundleSource{{InLine: string(ca)}},
+			Target:  certsv1.BundleTarget{Key: "ca.crt"},
+		},
+	}
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Bundle should be created")
+
+	err = triggerBundleReconcile(r, "internal-ca")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	for _, namespace := range []string{"team-a", "team-b", "other"} {
+		assert.Equal(t, string(ca), getBundleConfigMap(t, r, namespace).Data["ca.crt"], "Bundle should be written to %s", namespace)
+	}
+
+	// Namespaces that are no longer selected should lose their ConfigMap
+	instance = getBundle(t, r, "internal-ca")
+	instance.Spec.Target.NamespaceSelector = &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: corev1.LabelMetadataName, Operator: metav1.LabelSelectorOpIn, Values: []string{"team-a"}},
+		},
+	}
+	err = r.Update(context.Background(), instance)
+	assert.NoError(t, err, "Bundle should be updated")
+
+	namespace := &corev1.Namespace{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "team-a"}, namespace)
+	assert.NoError(t, err, "Namespace should exist")
+	namespace.Labels = map[string]string{corev1.LabelMetadataName: "team-a"}
+	err = r.Update(context.Background(), namespace)
+	assert.NoError(t, err, "Namespace should be labeled")
+
+	err = triggerBundleReconcile(r, "internal-ca")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.Equal(t, 1, getBundle(t, r, "internal-ca").Status.Namespaces, "Bundle should be written to one namespace")
+	getBundleConfigMap(t, r, "team-a")
+	for _, namespace := range []string{"team-b", "other"} {
+		err = r.Get(context.Background(), types.NamespacedName{Name: "internal-ca", Namespace: namespace}, &corev1.ConfigMap{})
+		assert.Error(t, err, "Stale ConfigMap should be removed from %s", namespace)
+	}
+
+	// A ConfigMap of the same name that belongs to someone else should not be overwritten
+	foreign := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "internal-ca", Namespace: "team-b"},
+		Data:       map[string]string{"ca.crt": "foreign"},
+	}
+	err = r.Create(context.Background(), foreign)
+	assert.NoError(t, err, "Foreign ConfigMap should be created")
+	instance = getBundle(t, r, "internal-ca")
+	instance.Spec.Target.NamespaceSelector = nil
+	err = r.Update(context.Background(), instance)
+	assert.NoError(t, err, "Bundle should be updated")
+
+	err = triggerBundleReconcile(r, "internal-ca")
+	assert.Error(t, err, "Reconcile should fail for the foreign ConfigMap")
+	assert.Equal(t, "foreign", getBundleConfigMap(t, r, "team-b").Data["ca.crt"], "Foreign ConfigMap should be left alone")
+	assert.Equal(t, string(ca), getBundleConfigMap(t, r, "other").Data["ca.crt"], "Other namespaces should still get the bundle")
+	assert.False(t, meta.IsStatusConditionTrue(getBundle(t, r, "internal-ca").Status.Conditions, constants.ConditionReady), "Bundle should not be ready")
+}
+
+// TestBundleWithInvalidSources tests Bundles whose sources are missing or invalid
+// Neither should write a ConfigMap, only missing sources are retried
+func TestBundleWithInvalidSources(t *testing.T) {
+	ca, _ := getCAKeyPair(t, true)
+	tests := []struct {
+		name    string
+		source  certsv1.BundleSource
+		reason  string
+		wantErr bool
+	}{
+		{
+			name:    "Missing Secret",
+			source:  certsv1.BundleSource{Secret: &certsv1.SecretKeyRef{Name: "missing", Key: "ca.crt"}},
+			reason:  constants.ReasonFailed,
+			wantErr: true,
+		},
+		{
+			name:    "Inline source without certificates",
+			source:  certsv1.BundleSource{InLine: "not a certificate"},
+			reason:  constants.ReasonFailed,
+			wantErr: true,
+		},
+		{
+			name: "Source with several fields",
+			source: certsv1.BundleSource{
+				ConfigMap: &certsv1.ConfigMapKeyRef{Name: "partner-cas", Key: "ca.crt"},
+				InLine:    string(ca),
+			},
+			reason: constants.ReasonInvalidSpec,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup the test environment
+			r := setupBundleTestEnv(t, map[string]map[string]string{"default": nil})
+
+			instance := &certsv1.Bundle{
+				ObjectMeta: metav1.ObjectMeta{Name: "internal-ca"},
+				Spec: certsv1.BundleSpec{
+					Sources: []certsv1.BundleSource{tt.source},
+					Target:  certsv1.BundleTarget{Key: "ca.crt"},
+				},
+			}
+			err := r.Create(context.Background(), instance)
+			assert.NoError(t, err, "Bundle should be created")
+
+			err = triggerBundleReconcile(r, "internal-ca")
+			if tt.wantErr {
+				assert.Error(t, err, "Reconcile should return an error")
+			} else {
+				assert.NoError(t, err, "Reconcile should not return an error")
+			}
+
+			readyCondition := meta.FindStatusCondition(getBundle(t, r, "internal-ca").Status.Conditions, constants.ConditionReady)
+			if assert.NotNil(t, readyCondition, "Ready condition should be set") {
+				assert.Equal(t, metav1.ConditionFalse, readyCondition.Status, "Ready condition should be false")
+				assert.Equal(t, tt.reason, readyCondition.Reason, "Ready condition reason should match")
+			}
+			err = r.Get(context.Background(), types.NamespacedName{Name: "internal-ca", Namespace: "default"}, &corev1.ConfigMap{})
+			assert.Error(t, err, "ConfigMap should not be created")
+		})
+	}
+}
+
+// triggerBundleReconcile triggers the Reconcile function of the Bundle controller
+func triggerBundleReconcile(r *BundleReconciler, name string) error {
+	_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Name: name}})
+	return err
+}
+
+// getBundle returns the Bundle with the given name
+func getBundle(t *testing.T, r *BundleReconciler, name string) *certsv1.Bundle {
+	bundle := &certsv1.Bundle{}
+	err := r.Get(context.Background(), types.NamespacedName{Name: name}, bundle)
+	assert.NoError(t, err, "Bundle should exist")
+	return bundle
+}
+
+// getBundleConfigMap returns the ConfigMap of the internal-ca Bundle in the namespace
+func getBundleConfigMap(t *testing.T, r *BundleReconciler, namespace string) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{}
+	err := r.Get(context.Background(), types.NamespacedName{Name: "internal-ca", Namespace: namespace}, configMap)
+	assert.NoError(t, err, "ConfigMap should exist in %s", namespace)
+	return configMap
+}
@@ -0,0 +1,582 @@
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/acme"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/objects"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+)
+
+const (
+	// acmeSelfCheckTimeout is how long the self check of a presented challenge may take
+	acmeSelfCheckTimeout = 15 * time.Second
+
+	// issuancePendingRequeueInterval is how long a Certificate waits for a pending issuance before checking again
+	issuancePendingRequeueInterval = 30 * time.Second
+
+	// acmeHTTP01SolverPort is the port the http-01 solver Pod serves the key authorization on
+	acmeHTTP01SolverPort = 8089
+
+	// DefaultACMEHTTP01SolverImage is the image of the http-01 solver Pod, it needs a shell and busybox httpd
+	DefaultACMEHTTP01SolverImage = "busybox:1.36"
+)
+
+// acmeSigner orders certificates for a CertificateRequest from an ACME server
+// The order is tracked in the status of the CertificateRequest, so an order in progress is resumed instead of ordered again
+type acmeSigner struct {
+	r         *CertificateRequestReconciler
+	instance  *certsv1.CertificateRequest
+	namespace string
+	issuer    *certsv1.ACMEIssuer
+	client    *acme.Client
+}
+
+// buildACMESigner builds a Signer that orders certificates with the account key stored in the Secret referenced by the issuer
+func buildACMESigner(ctx context.Context, r *CertificateRequestReconciler, instance *certsv1.CertificateRequest, namespace string, spec *certsv1.IssuerSpec) (cert.Signer, error) {
+	for i, solver := range spec.ACME.Solvers {
+		if (solver.HTTP01 == nil) == (solver.DNS01 == nil) {
+			return nil, fmt.Errorf("ACME solver %d must configure exactly one of http01 and dns01", i)
+		}
+	}
+
+	key, err := r.getACMEAccountKey(ctx, namespace, spec.ACME)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := newHTTPClient(spec.ACME.CABundle)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACME caBundle: %w", err)
+	}
+
+	return &acmeSigner{
+		r:         r,
+		instance:  instance,
+		namespace: namespace,
+		issuer:    spec.ACME,
+		client: &acme.Client{
+			DirectoryURL: spec.ACME.Server,
+			Key:          key,
+			HTTPClient:   httpClient,
+		},
+	}, nil
+}
+
+// getACMEAccountKey returns the account key stored in the Secret referenced by the issuer
+// A new key is generated and stored when the Secret does not exist
+func (r *CertificateRequestReconciler) getACMEAccountKey(ctx context.Context, namespace string, issuer *certsv1.ACMEIssuer) (*ecdsa.PrivateKey, error) {
+	secret := objects.Secret(issuer.PrivateKeySecretRef.Name, namespace)
+	err := r.Get(ctx, client.ObjectKeyFromObject(secret), secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get ACME account key Secret %s/%s: %w", namespace, issuer.PrivateKeySecretRef.Name, err)
+	}
+
+	if apierrors.IsNotFound(err) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err := cert.EncodePrivateKey(key, constants.KeyEncodingPKCS8)
+		if err != nil {
+			return nil, err
+		}
+		secret.Data = map[string][]byte{"tls.key": keyPEM}
+		if err := r.Create(ctx, secret); err != nil {
+			return nil, fmt.Errorf("failed to create ACME account key Secret %s/%s: %w", namespace, issuer.PrivateKeySecretRef.Name, err)
+		}
+		return key, nil
+	}
+
+	key, err := cert.ParsePrivateKey(secret.Data["tls.key"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACME account key Secret %s/%s: %w", namespace, issuer.PrivateKeySecretRef.Name, err)
+	}
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok || ecdsaKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("invalid ACME account key Secret %s/%s: account keys must be ECDSA P-256 keys", namespace, issuer.PrivateKeySecretRef.Name)
+	}
+	return ecdsaKey, nil
+}
+
+// Sign orders a certificate for the names of the request
+// It returns cert.ErrIssuancePending until the challenges pass the self check and while the order is being processed
+func (s *acmeSigner) Sign(ctx context.Context, request *cert.SigningRequest) (*cert.SignedCertificate, error) {
+	log := s.r.Log.WithValues("acme", s.instance.Name)
+
+	if request.CSR == nil {
+		return nil, errors.New("ACME issuers require a certificate signing request")
+	}
+	identifiers, err := getACMEIdentifiers(request.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.client.Register(ctx, s.issuer.Email); err != nil {
+		return nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+
+	order, err := s.getOrder(ctx, identifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Present the challenges of the pending authorizations, each is accepted once it passes the self check
+	challenges, accepted, err := s.presentChallenges(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	if !accepted {
+		if err := s.setOrderStatus(ctx, order, challenges, ""); err != nil {
+			return nil, err
+		}
+		log.Info("Waiting for ACME challenges to pass the self check", "order", order.URL)
+		return nil, cert.ErrIssuancePending
+	}
+
+	// The order is polled by the next reconcile instead of waiting for the ACME server
+	if order, err = s.client.GetOrder(ctx, order.URL); err != nil {
+		return nil, fmt.Errorf("failed to get ACME order: %w", err)
+	}
+
+	// Request the certificate with the CSR of the request
+	if order.Status == acme.StatusReady {
+		log.Info("ACME order is ready, finalizing", "order", order.URL)
+		if order, err = s.client.Finalize(ctx, order, request.CSR.Raw); err != nil {
+			return nil, fmt.Errorf("failed to finalize ACME order: %w", err)
+		}
+	}
+	if order.Status == acme.StatusPending || order.Status == acme.StatusProcessing {
+		if err := s.setOrderStatus(ctx, order, s.refreshChallenges(ctx, challenges), ""); err != nil {
+			return nil, err
+		}
+		log.Info("ACME order is still being processed", "order", order.URL, "status", order.Status)
+		return nil, cert.ErrIssuancePending
+	}
+
+	challenges = s.refreshChallenges(ctx, challenges)
+	if order.Status != acme.StatusValid {
+		s.cleanUp(ctx, challenges)
+		reason := fmt.Sprintf("order is %s", order.Status)
+		if order.Error != nil {
+			reason = order.Error.Error()
+		}
+		if err := s.setOrderStatus(ctx, order, challenges, reason); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("ACME order %s failed: %s", order.URL, reason)
+	}
+
+	chain, err := s.client.FetchCertificate(ctx, order.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ACME certificate: %w", err)
+	}
+	s.cleanUp(ctx, challenges)
+	if err := s.setOrderStatus(ctx, order, challenges, ""); err != nil {
+		return nil, err
+	}
+	log.Info("ACME order is valid, certificate issued", "order", order.URL)
+
+	return &cert.SignedCertificate{Certificate: chain}, nil
+}
+
+// getACMEIdentifiers returns the ACME identifiers of the DNS names and IP addresses of the certificate
+func getACMEIdentifiers(template *x509.Certificate) ([]acme.Identifier, error) {
+	if len(template.URIs) > 0 || len(template.EmailAddresses) > 0 {
+		return nil, errors.New("ACME issuers only issue certificates for DNS names and IP addresses")
+	}
+
+	var identifiers []acme.Identifier
+	for _, dnsName := range template.DNSNames {
+		identifiers = append(identifiers, acme.Identifier{Type: acme.IdentifierDNS, Value: dnsName})
+	}
+	for _, ip := range template.IPAddresses {
+		identifiers = append(identifiers, acme.Identifier{Type: acme.IdentifierIP, Value: ip.String()})
+	}
+	return identifiers, nil
+}
+
+// getOrder resumes the order tracked in the status of the CertificateRequest when it is for the same names
+// and not invalid, the CSR of a request never changes so even a finalized order is resumed
+// Otherwise a new order is created
+func (s *acmeSigner) getOrder(ctx context.Context, identifiers []acme.Identifier) (*acme.Order, error) {
+	var names []string
+	for _, identifier := range identifiers {
+		names = append(names, identifier.Value)
+	}
+
+	if tracked := s.instance.Status.ACME; tracked != nil && tracked.URL != "" && tracked.State != acme.StatusInvalid &&
+		strings.Join(tracked.Identifiers, ",") == strings.Join(names, ",") {
+		order, err := s.client.GetOrder(ctx, tracked.URL)
+		if err == nil && order.Status != acme.StatusInvalid {
+			s.r.Log.Info("Resuming ACME order", "order", order.URL, "status", order.Status)
+			return order, nil
+		}
+		s.r.Log.Info("Tracked ACME order can not be resumed, ordering again", "order", tracked.URL)
+	}
+
+	order, err := s.client.NewOrder(ctx, identifiers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ACME order: %w", err)
+	}
+	s.r.Log.Info("Created ACME order", "order", order.URL)
+
+	// Track the new order right away, so it is resumed when the controller restarts
+	if err := s.setOrderStatus(ctx, order, nil, ""); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// presentChallenges presents a challenge for every pending authorization of the order
+// A presented challenge is accepted once its self check passes, it reports whether every challenge was accepted
+// Challenges presented or accepted by an earlier reconcile are not presented again
+func (s *acmeSigner) presentChallenges(ctx context.Context, order *acme.Order) ([]certsv1.ACMEChallengeStatus, bool, error) {
+	var challenges []certsv1.ACMEChallengeStatus
+	accepted := true
+	for _, url := range order.Authorizations {
+		authorization, err := s.client.GetAuthorization(ctx, url)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get ACME authorization: %w", err)
+		}
+		domain := authorization.Identifier.Value
+		if authorization.Wildcard {
+			domain = "*." + domain
+		}
+
+		// Authorizations validated before only track the challenge that validated them, so it is cleaned up
+		if authorization.Status == acme.StatusValid {
+			for _, challenge := range authorization.Challenges {
+				if challenge.Status == acme.StatusValid {
+					challenges = append(challenges, certsv1.ACMEChallengeStatus{
+						DNSName:   domain,
+						Type:      challenge.Type,
+						URL:       challenge.URL,
+						Token:     challenge.Token,
+						State:     challenge.Status,
+						Presented: true,
+					})
+				}
+			}
+			continue
+		}
+		solver, challenge, err := s.getSolver(ctx, domain, authorization.Challenges)
+		if err != nil {
+			return nil, false, err
+		}
+
+		status := certsv1.ACMEChallengeStatus{
+			DNSName:   domain,
+			Type:      challenge.Type,
+			URL:       challenge.URL,
+			Token:     challenge.Token,
+			State:     challenge.Status,
+			Presented: challenge.Status != acme.StatusPending || s.isPresented(challenge.URL),
+		}
+		if authorization.Status == acme.StatusPending && challenge.Status == acme.StatusPending {
+			keyAuthorization, err := s.client.KeyAuthorization(challenge.Token)
+			if err != nil {
+				return nil, false, err
+			}
+			if !status.Presented {
+				s.r.Log.Info("Presenting ACME challenge", "dnsName", domain, "type", challenge.Type)
+				if err := solver.Present(ctx, domain, challenge, keyAuthorization); err != nil {
+					return nil, false, fmt.Errorf("failed to present %s challenge for %s: %w", challenge.Type, domain, err)
+				}
+				status.Presented = true
+			}
+
+			// The ACME server invalidates the order when it can not validate the challenge, so it is only accepted once it can
+			if err := s.selfCheck(ctx, domain, challenge, keyAuthorization); err != nil {
+				s.r.Log.Info("ACME challenge did not pass the self check", "dnsName", domain, "type", challenge.Type, "reason", err.Error())
+				status.Reason = fmt.Sprintf("self check failed: %v", err)
+				challenges = append(challenges, status)
+				accepted = false
+				continue
+			}
+			s.r.Log.Info("Accepting ACME challenge", "dnsName", domain, "type", challenge.Type)
+			acceptedChallenge, err := s.client.Accept(ctx, challenge)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to accept %s challenge for %s: %w", challenge.Type, domain, err)
+			}
+			status.State = acceptedChallenge.Status
+		}
+		challenges = append(challenges, status)
+	}
+	return challenges, accepted, nil
+}
+
+// isPresented reports whether the challenge at the URL was presented by an earlier reconcile
+func (s *acmeSigner) isPresented(url string) bool {
+	if s.instance.Status.ACME == nil {
+		return false
+	}
+	for _, challenge := range s.instance.Status.ACME.Challenges {
+		if challenge.URL == url {
+			return challenge.Presented
+		}
+	}
+	return false
+}
+
+// selfCheck checks that the key authorization of the presented challenge is served for the domain
+func (s *acmeSigner) selfCheck(ctx context.Context, domain string, challenge *acme.Challenge, keyAuthorization string) error {
+	check := s.r.ACMESelfCheck
+	if check == nil {
+		check = &acme.SelfCheck{}
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, acmeSelfCheckTimeout)
+	defer cancel()
+	return check.Check(checkCtx, domain, challenge, keyAuthorization)
+}
+
+// refreshChallenges updates the state of the tracked challenges from the ACME server
+func (s *acmeSigner) refreshChallenges(ctx context.Context, challenges []certsv1.ACMEChallengeStatus) []certsv1.ACMEChallengeStatus {
+	for i := range challenges {
+		challenge, err := s.client.GetChallenge(ctx, challenges[i].URL)
+		if err != nil {
+			s.r.Log.Error(err, "Failed to get ACME challenge", "dnsName", challenges[i].DNSName)
+			continue
+		}
+		challenges[i].State = challenge.Status
+		if challenge.Error != nil {
+			challenges[i].Reason = challenge.Error.Error()
+		}
+	}
+	return challenges
+}
+
+// cleanUp removes everything that was created to present the challenges, failures are only logged
+func (s *acmeSigner) cleanUp(ctx context.Context, challenges []certsv1.ACMEChallengeStatus) {
+	for _, status := range challenges {
+		challenge := &acme.Challenge{Type: status.Type, URL: status.URL, Token: status.Token}
+		solver, _, err := s.getSolver(ctx, status.DNSName, []acme.Challenge{*challenge})
+		if err == nil {
+			var keyAuthorization string
+			if keyAuthorization, err = s.client.KeyAuthorization(challenge.Token); err == nil {
+				err = solver.CleanUp(ctx, status.DNSName, challenge, keyAuthorization)
+			}
+		}
+		if err != nil {
+			s.r.Log.Error(err, "Failed to clean up ACME challenge", "dnsName", status.DNSName, "type", status.Type)
+		}
+	}
+}
+
+// setOrderStatus records the order and its challenges in the status of the CertificateRequest
+func (s *acmeSigner) setOrderStatus(ctx context.Context, order *acme.Order, challenges []certsv1.ACMEChallengeStatus, reason string) error {
+	patchBase := client.MergeFrom(s.instance.DeepCopy())
+	status := &certsv1.ACMEOrderStatus{
+		URL:        order.URL,
+		State:      order.Status,
+		Reason:     reason,
+		Challenges: challenges,
+	}
+	for _, identifier := range order.Identifiers {
+		status.Identifiers = append(status.Identifiers, identifier.Value)
+	}
+	s.instance.Status.ACME = status
+	if err := s.r.Status().Patch(ctx, s.instance, patchBase); err != nil {
+		return fmt.Errorf("failed to record ACME order: %w", err)
+	}
+	return nil
+}
+
+// getSolver returns the solver for the first configured solver whose selector matches the domain
+// together with the challenge it solves, solvers whose challenge type is not offered are skipped
+func (s *acmeSigner) getSolver(ctx context.Context, domain string, challenges []acme.Challenge) (acme.Solver, *acme.Challenge, error) {
+	for _, solver := range s.issuer.Solvers {
+		if !acmeSelectorMatches(solver.Selector, domain) {
+			continue
+		}
+
+		challengeType := acme.ChallengeHTTP01
+		if solver.DNS01 != nil {
+			challengeType = acme.ChallengeDNS01
+		}
+		for i := range challenges {
+			if challenges[i].Type != challengeType {
+				continue
+			}
+
+			if solver.DNS01 != nil {
+				dnsSolver, err := s.buildDNS01Solver(ctx, solver.DNS01)
+				return dnsSolver, &challenges[i], err
+			}
+			return &http01Solver{r: s.r, instance: s.instance, config: solver.HTTP01}, &challenges[i], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no ACME solver configured for %s", domain)
+}
+
+// buildDNS01Solver builds a dns-01 solver for the DNS provider with the configuration from its Secret
+func (s *acmeSigner) buildDNS01Solver(ctx context.Context, config *certsv1.ACMEDNS01Solver) (acme.Solver, error) {
+	var data map[string][]byte
+	if config.ConfigSecretRef != nil {
+		secret := &corev1.Secret{}
+		if err := s.r.Get(ctx, types.NamespacedName{Name: config.ConfigSecretRef.Name, Namespace: s.namespace}, secret); err != nil {
+			return nil, fmt.Errorf("failed to get DNS provider Secret %s/%s: %w", s.namespace, config.ConfigSecretRef.Name, err)
+		}
+		data = secret.Data
+	}
+
+	provider, err := acme.NewDNSProvider(config.Provider, data)
+	if err != nil {
+		return nil, err
+	}
+	return &acme.DNS01Solver{Provider: provider}, nil
+}
+
+// acmeSelectorMatches reports whether the solver selector matches the domain
+// A domain matches a zone when it is the zone or one of its subdomains
+func acmeSelectorMatches(selector *certsv1.ACMESolverSelector, domain string) bool {
+	if selector == nil || (len(selector.DNSNames) == 0 && len(selector.DNSZones) == 0) {
+		return true
+	}
+	for _, dnsName := range selector.DNSNames {
+		if dnsName == domain {
+			return true
+		}
+	}
+	name := strings.TrimPrefix(domain, "*.")
+	for _, zone := range selector.DNSZones {
+		if name == zone || strings.HasSuffix(name, "."+zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// http01Solver solves http-01 challenges with a temporary Pod that serves the key authorization
+// through a Service and an Ingress for the domain in the namespace of the CertificateRequest
+type http01Solver struct {
+	r        *CertificateRequestReconciler
+	instance *certsv1.CertificateRequest
+	config   *certsv1.ACMEHTTP01Solver
+}
+
+// http01SolverName returns the name of the solver resources of the challenge token
+func http01SolverName(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "acme-http-solver-" + hex.EncodeToString(sum[:5])
+}
+
+// Present creates the solver Pod, Service and Ingress, resources that already exist are kept
+func (s *http01Solver) Present(ctx context.Context, domain string, challenge *acme.Challenge, keyAuthorization string) error {
+	name := http01SolverName(challenge.Token)
+	labels := map[string]string{constants.LabelACMEHTTP01Solver: name}
+	meta := metav1.ObjectMeta{Name: name, Namespace: s.instance.Namespace, Labels: labels}
+
+	pod := &corev1.Pod{
+		ObjectMeta: meta,
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyOnFailure,
+			Containers: []corev1.Container{
+				{
+					Name:  "acme-http-solver",
+					Image: s.image(),
+					Command: []string{"sh", "-c", fmt.Sprintf(
+						`mkdir -p /tmp/www/.well-known/acme-challenge && printf '%%s' "$KEY_AUTHORIZATION" > "/tmp/www/.well-known/acme-challenge/$TOKEN" && exec httpd -f -p %d -h /tmp/www`,
+						acmeHTTP01SolverPort)},
+					Env: []corev1.EnvVar{
+						{Name: "TOKEN", Value: challenge.Token},
+						{Name: "KEY_AUTHORIZATION", Value: keyAuthorization},
+					},
+					Ports: []corev1.ContainerPort{{ContainerPort: acmeHTTP01SolverPort}},
+				},
+			},
+		},
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: *meta.DeepCopy(),
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports: []corev1.ServicePort{
+				{Port: acmeHTTP01SolverPort, TargetPort: intstr.FromInt(acmeHTTP01SolverPort)},
+			},
+		},
+	}
+
+	pathType := networkingv1.PathTypeExact
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: *meta.DeepCopy(),
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: domain,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     "/.well-known/acme-challenge/" + challenge.Token,
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: name,
+											Port: networkingv1.ServiceBackendPort{Number: acmeHTTP01SolverPort},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if s.config != nil {
+		ingress.Spec.IngressClassName = s.config.IngressClassName
+	}
+
+	// The solver resources are owned by the CertificateRequest, so they are garbage collected with it
+	for _, object := range []client.Object{pod, service, ingress} {
+		if err := controllerutil.SetControllerReference(s.instance, object, s.r.Scheme); err != nil {
+			return err
+		}
+		if err := s.r.Create(ctx, object); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanUp deletes the solver Pod, Service and Ingress
+func (s *http01Solver) CleanUp(ctx context.Context, _ string, challenge *acme.Challenge, _ string) error {
+	meta := metav1.ObjectMeta{Name: http01SolverName(challenge.Token), Namespace: s.instance.Namespace}
+	for _, object := range []client.Object{&corev1.Pod{ObjectMeta: meta}, &corev1.Service{ObjectMeta: meta}, &networkingv1.Ingress{ObjectMeta: meta}} {
+		if err := s.r.Delete(ctx, object); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// image returns the image of the solver Pod
+func (s *http01Solver) image() string {
+	if s.r.ACMEHTTP01SolverImage != "" {
+		return s.r.ACMEHTTP01SolverImage
+	}
+	return DefaultACMEHTTP01SolverImage
+}
@@ -18,7 +18,8 @@ package controllers
 
 import (
 	"context"
-	"reflect"
+	stderrors "errors"
+	"time"
 
 	"github.com/go-logr/logr"
 
@@ -28,8 +29,8 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
-	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -37,6 +38,7 @@ import (
 
 	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
 	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
 	"github.com/sheryarbutt/certificate-manager/pkg/utils/k8s"
 )
 
@@ -45,13 +47,22 @@ type CertificateReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+
+	// MaxConcurrentReconciles is the maximum number of Certificates reconciled concurrently
+	MaxConcurrentReconciles int
+
+	// ExtraWorkloadKinds are reloaded in addition to the DefaultWorkloadKinds when a Secret changes
+	ExtraWorkloadKinds []WorkloadKind
 }
 
 // +kubebuilder:rbac:groups=certs.k8c.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=certs.k8c.io,resources=certificates/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=certs.k8c.io,resources=certificates/finalizers,verbs=update
+// +kubebuilder:rbac:groups=certs.k8c.io,resources=certificaterequests,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=certs.k8c.io,resources=certificaterequests/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 func (r *CertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	// Initialize the log with the request namespace
 	log := r.Log.WithValues("certificate", req.NamespacedName)
@@ -74,9 +85,12 @@ func (r *CertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	log.Info("Checking if resource is marked for deletion")
 	if instance.DeletionTimestamp != nil {
 		log.Info("Deletion timestamp found for instance " + req.Name)
+		if !controllerutil.ContainsFinalizer(instance, constants.Finalizer) {
+			return k8s.DoNotRequeue()
+		}
 		if instance.Spec.PurgeOnDelete {
 			// update status to deleting
-			err := r.SetStatus(ctx, instance, constants.StatusDeleting, constants.StatusMessageDeleting, instance.Namespace, 0)
+			err := r.SetStatus(ctx, instance, constants.StatusDeleting, constants.StatusMessageDeleting, instance.Namespace, nil)
 			if err != nil {
 				log.Error(err, "Failed to set status to deleting")
 				return k8s.RequeueWithError(err)
@@ -88,35 +102,69 @@ func (r *CertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 				log.Error(err, "Failed to handle delete logic")
 				return k8s.RequeueWithError(err)
 			}
+		}
 
-			// remove finalizer
-			log.Info("Removing finalizer from Certificate")
-			controllerutil.RemoveFinalizer(instance, constants.Finalizer)
-			if err := r.Update(ctx, instance); err != nil {
-				log.Error(err, "Failed to remove finalizer from Certificate")
-				return k8s.RequeueWithError(err)
-			}
+		// Replicas in other namespaces cannot be owned by the Certificate, they are always deleted with it
+		if err := r.deleteReplicas(ctx, instance, "", nil); err != nil {
+			log.Error(err, "Failed to delete Secret replicas")
+			return k8s.RequeueWithError(err)
+		}
+
+		// remove finalizer
+		log.Info("Removing finalizer from Certificate")
+		controllerutil.RemoveFinalizer(instance, constants.Finalizer)
+		if err := r.Update(ctx, instance); err != nil {
+			log.Error(err, "Failed to remove finalizer from Certificate")
+			return k8s.RequeueWithError(err)
+		}
+		return k8s.DoNotRequeue()
+	}
+
+	// Keep the finalizer in sync with the spec, purgeOnDelete and replicateTo can be enabled or disabled at any time
+	if err := r.syncFinalizer(ctx, instance); err != nil {
+		log.Error(err, "Failed to update finalizer of Certificate")
+		return k8s.RequeueWithError(err)
+	}
+
+	// Validate the spec, an invalid spec is not retried until it changes
+	if err := validateCertificateSpec(&instance.Spec); err != nil {
+		log.Error(err, "Invalid Certificate spec")
+		if err := r.SetStatus(ctx, instance, constants.StatusInvalid, err.Error(), instance.Namespace, nil); err != nil {
+			log.Error(err, "Failed to set status to invalid")
+			return k8s.RequeueWithError(err)
 		}
 		return k8s.DoNotRequeue()
 	}
 
 	// Set status condition to reconciling
-	err := r.SetStatus(ctx, instance, constants.StatusReconciling, constants.StatusMessageReconciling, instance.Namespace, 0)
+	err := r.SetStatus(ctx, instance, constants.StatusReconciling, constants.StatusMessageReconciling, instance.Namespace, nil)
 	if err != nil {
 		log.Error(err, "Failed to set status to reconciling")
 		return k8s.RequeueWithError(err)
 	}
 
 	// Handle the create/update logic
-	duration, err := r.handleCreate(ctx, req, instance)
+	certificate, err := r.handleCreate(ctx, req, instance)
+	if stderrors.Is(err, cert.ErrIssuancePending) {
+		// The CertificateRequest is not signed yet, its status changes requeue the Certificate as well
+		log.Info("Certificate issuance is pending, requeueing")
+		return k8s.RequeueAfter(issuancePendingRequeueInterval)
+	}
 	if err != nil {
 		log.Error(err, "Failed to handle create/update logic")
+		status := constants.StatusFailed
+		if stderrors.Is(err, errCertificateRequestConflict) {
+			status = constants.StatusConflict
+		}
+		if err := r.SetStatus(ctx, instance, status, err.Error(), instance.Namespace, nil); err != nil {
+			log.Error(err, "Failed to set status to failed")
+		}
 		return k8s.RequeueWithError(err)
 	}
 
 	// Set the status to deployed
 	if instance.Status.Status != constants.StatusExpired {
-		err = r.SetStatus(ctx, instance, constants.StatusDeployed, constants.StatusMessageDeployed, instance.Namespace, duration)
+		err = r.SetStatus(ctx, instance, constants.StatusDeployed, constants.StatusMessageDeployed, instance.Namespace, certificate)
 		if err != nil {
 			log.Error(err, "Failed to set status to deployed")
 			return k8s.RequeueWithError(err)
@@ -125,9 +173,26 @@ func (r *CertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	log.Info("Reconciliation successful")
 
+	if reload := instance.Status.Reload; reload != nil && reload.CompletionTime == nil {
+		// Requeue to restart the next workloads, the progress is checked again on every reconcile
+		log.Info("Workloads are still being reloaded", "completed", reload.Completed, "total", reload.Total)
+		return k8s.RequeueAfter(reloadRequeueInterval)
+	}
+
+	// Requeue to renew the certificate at its renewal time, computed from the stored certificate
+	// Certificates that are not rotated are requeued to update their Expiring and Expired conditions instead
+	renewalTime, err := getRenewalTime(&instance.Spec, certificate)
+	if err != nil {
+		log.Error(err, "Failed to compute renewal time")
+		return k8s.RequeueWithError(err)
+	}
 	if instance.Spec.RotateOnExpiry {
-		// Requeue after the specified duration to renew the certificate
-		return k8s.RequeueAfter(duration)
+		return k8s.RequeueAfter(time.Until(renewalTime))
+	}
+	for _, transition := range []time.Time{renewalTime, certificate.NotAfter} {
+		if time.Now().Before(transition) {
+			return k8s.RequeueAfter(time.Until(transition))
+		}
 	}
 
 	return k8s.DoNotRequeue()
@@ -135,36 +200,25 @@ func (r *CertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *CertificateReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	eventPredicate := predicate.Funcs{
-		CreateFunc: func(e event.CreateEvent) bool {
-			// Handle create events
-			r.Log.Info("Create event detected", "name", e.Object.GetName())
-
-			// Set Event to "Create"
-			Event = constants.EventCreate
-			return true
-		},
-		UpdateFunc: func(e event.UpdateEvent) bool {
-			// Handle update events
-			oldSpec := e.ObjectOld.(*certsv1.Certificate).Spec
-			newSpec := e.ObjectNew.(*certsv1.Certificate).Spec
-			if !reflect.DeepEqual(oldSpec, newSpec) {
-				r.Log.Info("Update event detected", "name", e.ObjectNew.GetName())
-
-				// Set Event to "Update"
-				Event = constants.EventUpdate
-				return true
-			}
-			return false
-		},
+	// Index the workloads by the Certificates they opt in to be reloaded for
+	if err := r.indexWorkloads(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		return err
 	}
 
+	// Owned Secrets are watched for every change, Secrets have no generation and edits to them are repaired
+	// CertificateRequests are watched for their status, which changes when they are signed
+	// Namespaces are watched for the Certificates that replicate their Secret to namespaces selected by labels
+	// Replicas are watched for every change, so edits to the read-only copies are reverted right away
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&certsv1.Certificate{}, builder.WithPredicates(eventPredicate)).
+		For(&certsv1.Certificate{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(func(object client.Object) []reconcile.Request {
 			return MapSecretsToCertificates(object, r.Client, r.Log)
-		}), builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{}))).
-		WithEventFilter(predicate.GenerationChangedPredicate{}).
-		Owns(&corev1.Secret{}).
+		}), builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{}, replicaChangedPredicate))).
+		Owns(&corev1.Secret{}, builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(func(object client.Object) []reconcile.Request {
+			return MapNamespacesToReplicatingCertificates(r.Client, r.Log)
+		}), builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		Owns(&certsv1.CertificateRequest{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
@@ -1,52 +1,126 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/acme"
+	"github.com/sheryarbutt/certificate-manager/pkg/acme/acmetest"
 	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+	"github.com/sheryarbutt/certificate-manager/pkg/vault/vaulttest"
+	"github.com/sheryarbutt/certificate-manager/pkg/webhook"
+	"github.com/sheryarbutt/certificate-manager/pkg/webhook/webhooktest"
 )
 
 func TestCertificateController(t *testing.T) {
 	t.Run("CreateBasicCertificate", TestCreateBasicCertificate)
 	t.Run("DeleteDeployedSecret", TestDeleteDeployedSecret)
+	t.Run("RepairDeployedSecret", TestRepairDeployedSecret)
 	t.Run("CertificateWithPurgeOnDelete", TestCertificateWithPurgeOnDelete)
 	t.Run("CertificateWithPurgeOnDeleteSetToFalse", TestCertificateWithPurgeOnDeleteSetToFalse)
+	t.Run("CertificateWithPurgeOnDeleteEnabledLater", TestCertificateWithPurgeOnDeleteEnabledLater)
 	t.Run("CertificateWithReloadOnChange", TestCertificateWithReloadOnChange)
 	t.Run("CertificateWithReloadOnChangeSetToFalse", TestCertificateWithReloadOnChangeSetToFalse)
 	t.Run("CertificateWithRotateOnExpiry", TestCertificateWithRotateOnExpiry)
 	t.Run("CertificateWithRotateOnExpirySetToFalse", TestCertificateWithRotateOnExpirySetToFalse)
 	t.Run("CertificateWithRotateOnExpiryAndReloadOnChange", TestCertificateWithRotateOnExpiryAndReloadOnChange)
+	t.Run("CertificateWithIssuerRef", TestCertificateWithIssuerRef)
+	t.Run("CertificateWithMissingIssuer", TestCertificateWithMissingIssuer)
+	t.Run("CertificateWithCAIssuer", TestCertificateWithCAIssuer)
+	t.Run("CertificateWithInvalidCAIssuer", TestCertificateWithInvalidCAIssuer)
+	t.Run("CertificateWithSubjectAlternativeNames", TestCertificateWithSubjectAlternativeNames)
+	t.Run("CertificateWithInvalidSubjectAlternativeNames", TestCertificateWithInvalidSubjectAlternativeNames)
+	t.Run("CertificateWithPrivateKey", TestCertificateWithPrivateKey)
+	t.Run("CertificateWithRenewBefore", TestCertificateWithRenewBefore)
+	t.Run("CertificateStatusConditions", TestCertificateStatusConditions)
+	t.Run("CertificateExpiringCondition", TestCertificateExpiringCondition)
+	t.Run("CertificateStatusDetails", TestCertificateStatusDetails)
+	t.Run("CertificateWithSubject", TestCertificateWithSubject)
+	t.Run("CertificateWithUsages", TestCertificateWithUsages)
+	t.Run("CertificateWithIntermediateCA", TestCertificateWithIntermediateCA)
+	t.Run("CertificateWithInvalidUsages", TestCertificateWithInvalidUsages)
+	t.Run("CertificateSpecChange", TestCertificateSpecChange)
+	t.Run("CertificateWithoutSpecHash", TestCertificateWithoutSpecHash)
+	t.Run("ConcurrentReconciles", TestConcurrentReconciles)
+	t.Run("ReloadWorkloads", TestReloadWorkloads)
+	t.Run("ParseWorkloadKinds", TestParseWorkloadKinds)
+	t.Run("DetectSecretUsage", TestDetectSecretUsage)
+	t.Run("ReloadWithChecksumAnnotation", TestReloadWithChecksumAnnotation)
+	t.Run("ReloadAnnotations", TestReloadAnnotations)
+	t.Run("StaggeredReload", TestStaggeredReload)
+	t.Run("CertificateWithACMEIssuer", TestCertificateWithACMEIssuer)
+	t.Run("CertificateWithFailedACMEChallenge", TestCertificateWithFailedACMEChallenge)
+	t.Run("CertificateWithPendingACMESelfCheck", TestCertificateWithPendingACMESelfCheck)
+	t.Run("CertificateWithVaultIssuer", TestCertificateWithVaultIssuer)
+	t.Run("CertificateWithVaultKubernetesAuth", TestCertificateWithVaultKubernetesAuth)
+	t.Run("CertificateWithWebhookIssuer", TestCertificateWithWebhookIssuer)
+	t.Run("CertificateWithRejectingWebhookIssuer", TestCertificateWithRejectingWebhookIssuer)
+	t.Run("CertificateWithKeystores", TestCertificateWithKeystores)
+	t.Run("MapSecretsToCertificates", TestMapSecretsToCertificates)
+	t.Run("CertificateWithSecretTemplate", TestCertificateWithSecretTemplate)
+	t.Run("CertificateWithInvalidSecretTemplate", TestCertificateWithInvalidSecretTemplate)
+	t.Run("CertificateWithCombinedPEM", TestCertificateWithCombinedPEM)
+	t.Run("CertificateWithReplication", TestCertificateWithReplication)
 }
 
 // setupTestEnv sets up the test environment for the Certificate controller
-func setupTestEnv() *CertificateReconciler {
+// The workloads of the default and the given extra workload kinds are indexed like in the manager
+func setupTestEnv(extraWorkloadKinds ...WorkloadKind) *CertificateReconciler {
 	// Setup the test environment
 	scheme := runtime.NewScheme()
 	_ = certsv1.AddToScheme(scheme)
 	_ = appsv1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+	_ = certificatesv1.AddToScheme(scheme)
 
-	fakeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
 	r := &CertificateReconciler{
-		Client: fakeClient,
-		Log:    zap.New(zap.UseDevMode(true)),
-		Scheme: scheme,
+		Log:                zap.New(zap.UseDevMode(true)),
+		Scheme:             scheme,
+		ExtraWorkloadKinds: extraWorkloadKinds,
 	}
 
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for _, kind := range r.workloadKinds() {
+		object := &unstructured.Unstructured{}
+		object.SetGroupVersionKind(kind.GroupVersionKind)
+		builder = builder.WithIndex(object, reloadCertificatesIndex, indexReloadCertificates)
+	}
+	r.Client = builder.Build()
+
 	return r
 }
 
@@ -80,6 +154,8 @@ func TestCreateBasicCertificate(t *testing.T) {
 	// Check the secret data
 	assert.Contains(t, secret.Data, "tls.crt", "Secret should contain tls.crt")
 	assert.Contains(t, secret.Data, "tls.key", "Secret should contain tls.key")
+	assert.Equal(t, secret.Data["tls.crt"], secret.Data["ca.crt"], "ca.crt should contain the self-signed certificate")
+	assert.NotContains(t, secret.Data, "tls-combined.pem", "Secret should not contain tls-combined.pem")
 }
 
 // TestDeleteDeployedSecret tests the deletion of a deployed Secret
@@ -115,6 +191,50 @@ func TestDeleteDeployedSecret(t *testing.T) {
 	assert.NoError(t, err, "Secret should be recreated")
 }
 
+// TestRepairDeployedSecret tests changes made to the Secret of a Certificate by others
+// The Secret should be owned by the Certificate and a corrupted certificate should be reissued
+func TestRepairDeployedSecret(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// The Secret should be owned by the Certificate, so changes to it reconcile the Certificate
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	if assert.Len(t, secret.OwnerReferences, 1, "Secret should have an owner reference") {
+		assert.Equal(t, "test-certificate", secret.OwnerReferences[0].Name, "Secret should be owned by the Certificate")
+	}
+
+	// Corrupt the certificate and remove the owner reference
+	secret.Data["tls.crt"] = []byte("corrupted")
+	secret.OwnerReferences = nil
+	err = r.Update(context.Background(), secret)
+	assert.NoError(t, err, "Secret should be updated")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// The certificate should be reissued and the owner reference restored
+	secret = &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate")
+	key, err := cert.ParsePrivateKey(secret.Data["tls.key"])
+	assert.NoError(t, err, "Secret should contain a private key")
+	assert.True(t, cert.CertificateMatches(chain[0], key.Public()), "Certificate should be issued for the private key")
+	assert.Len(t, secret.OwnerReferences, 1, "Owner reference should be restored")
+}
+
 // TestCertificateWithPurgeOnDelete tests the deletion of a Certificate instance with PurgeOnDelete set to true
 // The corresponding Secret should be deleted when the Certificate instance is deleted
 func TestCertificateWithPurgeOnDelete(t *testing.T) {
@@ -179,6 +299,53 @@ func TestCertificateWithPurgeOnDeleteSetToFalse(t *testing.T) {
 	assert.NoError(t, err, "Secret should not be deleted")
 }
 
+// TestCertificateWithPurgeOnDeleteEnabledLater tests enabling PurgeOnDelete on a Certificate whose Secret was already issued
+// The finalizer should be added without reissuing the certificate and the Secret should be deleted with the Certificate
+func TestCertificateWithPurgeOnDeleteEnabledLater(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance without PurgeOnDelete
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+
+	// Enable PurgeOnDelete
+	instance = &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, instance)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.NotContains(t, instance.Finalizers, constants.Finalizer, "Certificate should not have the finalizer")
+	instance.Spec.PurgeOnDelete = true
+	err = r.Update(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be updated")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, instance)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Contains(t, instance.Finalizers, constants.Finalizer, "Certificate should have the finalizer")
+
+	// Delete the Certificate instance
+	err = r.Delete(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be deleted")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// Check if the secret is deleted
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.Error(t, err, "Secret should be deleted")
+}
+
 // TestCertificateWithReloadOnChange tests the reloading of a Deployment when the Certificate instance is updated
 // The Deployment should be updated with the new certificate ENV when the Certificate instance is updated
 func TestCertificateWithReloadOnChange(t *testing.T) {
@@ -188,6 +355,8 @@ func TestCertificateWithReloadOnChange(t *testing.T) {
 	// Create a Certificate instance
 	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, true, false)
 
+	instance.Spec.ReloadMode = constants.ReloadModeEnv
+
 	err := r.Create(context.Background(), instance)
 	assert.NoError(t, err, "Certificate instance should be created")
 
@@ -382,6 +551,8 @@ func TestCertificateWithRotateOnExpirySetToFalse(t *testing.T) {
 	assert.NoError(t, err, "Certificate instance should exist")
 	assert.Equal(t, certificate.Status.Status, constants.StatusExpired, "Certificate status should be Expired")
 	assert.Equal(t, certificate.Status.Message, constants.StatusMessageExpired, "Certificate message should be Expired")
+	assert.True(t, meta.IsStatusConditionTrue(certificate.Status.Conditions, constants.ConditionExpired), "Expired condition should be true")
+	assert.True(t, meta.IsStatusConditionFalse(certificate.Status.Conditions, constants.ConditionReady), "Ready condition should be false")
 }
 
 // TestCertificateWithRotateOnExpiryAndReloadOnChange tests the rotation of a certificate when it expires
@@ -393,6 +564,8 @@ func TestCertificateWithRotateOnExpiryAndReloadOnChange(t *testing.T) {
 	// Create a Certificate instance
 	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "5s", false, true, true)
 
+	instance.Spec.ReloadMode = constants.ReloadModeEnv
+
 	err := r.Create(context.Background(), instance)
 	assert.NoError(t, err, "Certificate instance should be created")
 
@@ -453,76 +626,2619 @@ func TestCertificateWithRotateOnExpiryAndReloadOnChange(t *testing.T) {
 	assert.Equal(t, secret.ResourceVersion, valueAfterRotation, "ResourceVersion should match")
 }
 
-// triggerReconcile triggers the Reconcile function of the Certificate controller
-func triggerReconcile(r *CertificateReconciler, name, namespace string) error {
-	_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}})
-	return err
+// TestCertificateWithIssuerRef tests the creation of Certificates signed through an Issuer and a ClusterIssuer
+// The Secret should be created by the signer of the referenced issuer
+func TestCertificateWithIssuerRef(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a self-signed Issuer and ClusterIssuer
+	issuer := &certsv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-issuer", Namespace: "default"},
+		Spec:       certsv1.IssuerSpec{SelfSigned: &certsv1.SelfSignedIssuer{}},
+	}
+	err := r.Create(context.Background(), issuer)
+	assert.NoError(t, err, "Issuer should be created")
+
+	clusterIssuer := &certsv1.ClusterIssuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster-issuer"},
+		Spec:       certsv1.IssuerSpec{SelfSigned: &certsv1.SelfSignedIssuer{}},
+	}
+	err = r.Create(context.Background(), clusterIssuer)
+	assert.NoError(t, err, "ClusterIssuer should be created")
+
+	for _, ref := range []certsv1.IssuerRef{
+		{Name: "test-issuer", Kind: constants.KindIssuer},
+		{Name: "test-cluster-issuer", Kind: constants.KindClusterIssuer},
+	} {
+		// Create a Certificate instance referencing the issuer
+		instance := getCertificateTemplate("test-certificate-"+ref.Name, "default", "test-secret-"+ref.Name, "1h", false, false, false)
+		instance.Spec.IssuerRef = ref.DeepCopy()
+
+		err = r.Create(context.Background(), instance)
+		assert.NoError(t, err, "Certificate instance should be created")
+
+		err = triggerReconcile(r, instance.Name, "default")
+		assert.NoError(t, err, "Reconcile should not return an error")
+
+		// Get the secret created by the Certificate instance
+		secret := &corev1.Secret{}
+		err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret-" + ref.Name, Namespace: "default"}, secret)
+		assert.NoError(t, err, "Secret should be created")
+		assert.Contains(t, secret.Data, "tls.crt", "Secret should contain tls.crt")
+		assert.Contains(t, secret.Data, "tls.key", "Secret should contain tls.key")
+	}
 }
 
-// checkIfCertificateEnvExists checks if the certificate ENV exists in the deployment
-func checkIfCertificateEnvExists(deployment *appsv1.Deployment) (string, error) {
-	for _, container := range deployment.Spec.Template.Spec.Containers {
-		for _, env := range container.Env {
-			if env.Name == constants.CertificateENVName {
-				return env.Value, nil
-			}
-		}
+// TestCertificateWithMissingIssuer tests a Certificate referencing an Issuer that does not exist
+// The Certificate controller should return an error and not create the Secret
+func TestCertificateWithMissingIssuer(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance referencing a missing Issuer
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "missing-issuer", Kind: constants.KindIssuer}
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.Error(t, err, "Reconcile should return an error")
+
+	// Check that the secret was not created
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.Error(t, err, "Secret should not be created")
+}
+
+// TestCertificateWithCAIssuer tests the creation of a Certificate signed by a CA Issuer
+// The Secret should contain a certificate chain that verifies against the CA stored in ca.crt
+func TestCertificateWithCAIssuer(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create the CA Secret and the Issuer referencing it
+	caCert, caKey := getCAKeyPair(t, true)
+	caSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ca", Namespace: "default"},
+		Data:       map[string][]byte{"tls.crt": caCert, "tls.key": caKey},
 	}
-	return "", errors.New("Certificate ENV not found")
+	err := r.Create(context.Background(), caSecret)
+	assert.NoError(t, err, "CA Secret should be created")
+
+	issuer := &certsv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-issuer", Namespace: "default"},
+		Spec:       certsv1.IssuerSpec{CA: &certsv1.CAIssuer{SecretName: "test-ca"}},
+	}
+	err = r.Create(context.Background(), issuer)
+	assert.NoError(t, err, "Issuer should be created")
+
+	// Create a Certificate instance referencing the Issuer
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// Get the secret created by the Certificate instance
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	assert.Equal(t, caCert, secret.Data["ca.crt"], "Secret should contain the CA certificate")
+
+	// The chain should hold the leaf followed by the CA and verify against the CA
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate chain")
+	assert.Len(t, chain, 2, "Chain should contain the leaf and the CA certificate")
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(secret.Data["ca.crt"])
+	_, err = chain[0].Verify(x509.VerifyOptions{DNSName: "example.k8c.io", Roots: roots})
+	assert.NoError(t, err, "Certificate should be signed by the CA")
 }
 
-// getCertificateTemplate returns a basic Certificate instance template
-func getCertificateTemplate(name, namespace, secretName, validity string, PurgeOnDelete, ReloadOnChange, RotateOnExpiry bool) *certsv1.Certificate {
-	return &certsv1.Certificate{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
+// TestCertificateWithInvalidCAIssuer tests a Certificate referencing a CA Issuer whose certificate is not a CA
+// The Certificate controller should return an error and not create the Secret
+func TestCertificateWithInvalidCAIssuer(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Secret holding a certificate that is not a CA and the Issuer referencing it
+	caCert, caKey := getCAKeyPair(t, false)
+	caSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ca", Namespace: "default"},
+		Data:       map[string][]byte{"tls.crt": caCert, "tls.key": caKey},
+	}
+	err := r.Create(context.Background(), caSecret)
+	assert.NoError(t, err, "CA Secret should be created")
+
+	issuer := &certsv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-issuer", Namespace: "default"},
+		Spec:       certsv1.IssuerSpec{CA: &certsv1.CAIssuer{SecretName: "test-ca"}},
+	}
+	err = r.Create(context.Background(), issuer)
+	assert.NoError(t, err, "Issuer should be created")
+
+	// Create a Certificate instance referencing the Issuer
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.Error(t, err, "Reconcile should return an error")
+
+	// Check that the secret was not created
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.Error(t, err, "Secret should not be created")
+}
+
+// TestCertificateWithSubjectAlternativeNames tests the creation of a Certificate with multiple subject alternative names
+// The issued certificate should contain every DNS name, IP address, URI and email address of the spec
+func TestCertificateWithSubjectAlternativeNames(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance with multiple SANs
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.DNSNames = []string{"example.k8c.io", "www.example.k8c.io", "*.apps.k8c.io"}
+	instance.Spec.IPAddresses = []string{"10.0.0.1", "fd00::1"}
+	instance.Spec.URIs = []string{"spiffe://k8c.io/ns/default/sa/test"}
+	instance.Spec.EmailAddresses = []string{"admin@k8c.io"}
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// Get the secret created by the Certificate instance
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate")
+
+	// dnsName and dnsNames are merged without duplicates
+	certificate := chain[0]
+	assert.Equal(t, "example.k8c.io", certificate.Subject.CommonName, "Common name should be the first DNS name")
+	assert.Equal(t, []string{"example.k8c.io", "www.example.k8c.io", "*.apps.k8c.io"}, certificate.DNSNames, "DNS names should match")
+	assert.Len(t, certificate.IPAddresses, 2, "IP addresses should match")
+	assert.Equal(t, "10.0.0.1", certificate.IPAddresses[0].String(), "IP addresses should match")
+	assert.Equal(t, "fd00::1", certificate.IPAddresses[1].String(), "IP addresses should match")
+	assert.Len(t, certificate.URIs, 1, "URIs should match")
+	assert.Equal(t, "spiffe://k8c.io/ns/default/sa/test", certificate.URIs[0].String(), "URIs should match")
+	assert.Equal(t, []string{"admin@k8c.io"}, certificate.EmailAddresses, "Email addresses should match")
+}
+
+// TestCertificateWithInvalidSubjectAlternativeNames tests the creation of a Certificate with invalid subject alternative names
+// The Certificate controller should set the status to Invalid and not create the Secret
+func TestCertificateWithInvalidSubjectAlternativeNames(t *testing.T) {
+	tests := []struct {
+		name string
+		spec func(spec *certsv1.CertificateSpec)
+	}{
+		{
+			name: "No names",
+			spec: func(spec *certsv1.CertificateSpec) { spec.DNSName = "" },
 		},
-		Spec: certsv1.CertificateSpec{
-			SecretRef: certsv1.SecretRef{
-				Name: secretName,
-			},
-			Validity:       validity,
-			PurgeOnDelete:  PurgeOnDelete,
-			ReloadOnChange: ReloadOnChange,
-			RotateOnExpiry: RotateOnExpiry,
+		{
+			name: "Invalid DNS name",
+			spec: func(spec *certsv1.CertificateSpec) { spec.DNSNames = []string{"not_a_hostname"} },
+		},
+		{
+			name: "Invalid IP address",
+			spec: func(spec *certsv1.CertificateSpec) { spec.IPAddresses = []string{"10.0.0.256"} },
+		},
+		{
+			name: "Relative URI",
+			spec: func(spec *certsv1.CertificateSpec) { spec.URIs = []string{"/ns/default"} },
 		},
+		{
+			name: "Invalid email address",
+			spec: func(spec *certsv1.CertificateSpec) { spec.EmailAddresses = []string{"Admin <admin@k8c.io>"} },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup the test environment
+			r := setupTestEnv()
+
+			// Create a Certificate instance with an invalid spec
+			instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+			tt.spec(&instance.Spec)
+
+			err := r.Create(context.Background(), instance)
+			assert.NoError(t, err, "Certificate instance should be created")
+
+			err = triggerReconcile(r, "test-certificate", "default")
+			assert.NoError(t, err, "Reconcile should not return an error")
+
+			// Check status of the Certificate instance
+			certificate := &certsv1.Certificate{}
+			err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+			assert.NoError(t, err, "Certificate instance should exist")
+			assert.Equal(t, constants.StatusInvalid, certificate.Status.Status, "Certificate status should be Invalid")
+
+			// Check that the secret was not created
+			secret := &corev1.Secret{}
+			err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+			assert.Error(t, err, "Secret should not be created")
+		})
 	}
 }
 
-// getDeploymentTemplate returns a basic Deployment instance template
-func getDeploymentTemplate(name, namespace, secretName string) *appsv1.Deployment {
-	return &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
-		},
-		Spec: appsv1.DeploymentSpec{
-			Template: corev1.PodTemplateSpec{
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name: "test-container",
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "test-volume",
-									MountPath: "/etc/secret-volume",
-									ReadOnly:  true,
-								},
-							},
-						},
-					},
-					Volumes: []corev1.Volume{
-						{
-							Name: "test-volume",
-							VolumeSource: corev1.VolumeSource{
-								Secret: &corev1.SecretVolumeSource{
-									SecretName: secretName,
-								},
-							},
-						},
-					},
-				},
+// TestCertificateWithPrivateKey tests the creation of a Certificate with a configured private key
+// The Secret should contain a key of the configured algorithm and encoding matching the certificate
+func TestCertificateWithPrivateKey(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance with a PKCS#8 encoded ECDSA P-384 key
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.PrivateKey = &certsv1.PrivateKey{
+		Algorithm: constants.KeyAlgorithmECDSA,
+		Size:      384,
+		Encoding:  constants.KeyEncodingPKCS8,
+	}
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// Get the secret created by the Certificate instance
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+
+	pemBlock, _ := pem.Decode(secret.Data["tls.key"])
+	assert.NotNil(t, pemBlock, "Secret should contain a PEM encoded key")
+	assert.Equal(t, constants.TypePKCS8PrivateKey, pemBlock.Type, "Key should be PKCS#8 encoded")
+
+	privateKey, err := cert.ParsePrivateKey(secret.Data["tls.key"])
+	assert.NoError(t, err, "Key should be parsed")
+	ecdsaKey, ok := privateKey.(*ecdsa.PrivateKey)
+	assert.True(t, ok, "Key should be an ECDSA key")
+	assert.Equal(t, elliptic.P384(), ecdsaKey.Curve, "Key should use the P-384 curve")
+
+	// The certificate should be issued for the key
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate")
+	assert.True(t, ecdsaKey.PublicKey.Equal(chain[0].PublicKey), "Certificate should be issued for the key")
+	assert.Zero(t, chain[0].KeyUsage&x509.KeyUsageKeyEncipherment, "Key encipherment should only be set for RSA keys")
+
+	// An invalid key size should set the status to Invalid
+	instance = getCertificateTemplate("test-certificate-invalid", "default", "test-secret-invalid", "1h", false, false, false)
+	instance.Spec.PrivateKey = &certsv1.PrivateKey{Algorithm: constants.KeyAlgorithmECDSA, Size: 2048}
+
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate-invalid", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate-invalid", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Equal(t, constants.StatusInvalid, certificate.Status.Status, "Certificate status should be Invalid")
+}
+
+// TestCertificateWithRenewBefore tests the renewal of a certificate before it expires
+// The Certificate controller should requeue at NotAfter - renewBefore of the stored certificate and renew it from then on
+func TestCertificateWithRenewBefore(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance that is renewed at half of its lifetime
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, true)
+	instance.Spec.RenewBefore = "50%"
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	result, err := reconcileCertificate(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.InDelta(t, float64(30*time.Minute), float64(result.RequeueAfter), float64(5*time.Second), "Reconcile should requeue at half of the lifetime")
+
+	// A certificate that is within renewBefore of its expiry should be renewed
+	instance = getCertificateTemplate("test-certificate-due", "default", "test-secret-due", "1h", false, false, true)
+	instance.Spec.RenewBefore = "3599s"
+
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate-due", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret-due", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	oldCertificate := secret.Data["tls.crt"]
+
+	// Wait for the renewal time to pass
+	time.Sleep(2 * time.Second)
+
+	err = triggerReconcile(r, "test-certificate-due", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret = &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret-due", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	assert.NotEqual(t, oldCertificate, secret.Data["tls.crt"], "Certificate should be renewed")
+
+	// A renewBefore that is not shorter than the validity should set the status to Invalid
+	instance = getCertificateTemplate("test-certificate-invalid", "default", "test-secret-invalid", "1h", false, false, true)
+	instance.Spec.RenewBefore = "2h"
+
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate-invalid", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate-invalid", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Equal(t, constants.StatusInvalid, certificate.Status.Status, "Certificate status should be Invalid")
+
+	// Percentages outside of 0% and 100% and durations that are not positive should set the status to Invalid
+	for i, renewBefore := range []string{"abc%", "0%", "100%", "150%", "0s", "-1h", "abc"} {
+		name := fmt.Sprintf("test-certificate-invalid-%d", i)
+		instance = getCertificateTemplate(name, "default", name, "1h", false, false, true)
+		instance.Spec.RenewBefore = renewBefore
+
+		err = r.Create(context.Background(), instance)
+		assert.NoError(t, err, "Certificate instance should be created")
+
+		err = triggerReconcile(r, name, "default")
+		assert.NoError(t, err, "Reconcile should not return an error")
+
+		err = r.Get(context.Background(), types.NamespacedName{Name: name, Namespace: "default"}, certificate)
+		assert.NoError(t, err, "Certificate instance should exist")
+		assert.Equal(t, constants.StatusInvalid, certificate.Status.Status, "Certificate status should be Invalid for renewBefore %q", renewBefore)
+
+		// The renewal time of an unparsable renewBefore is an error instead of the expiry
+		_, err = getRenewalTime(&instance.Spec, &x509.Certificate{NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)})
+		assert.Error(t, err, "Renewal time should not be computed for renewBefore %q", renewBefore)
+	}
+}
+
+// TestCertificateStatusConditions tests the status conditions of a Certificate
+// The Ready, Issuing and Expired conditions should be set and keep their lastTransitionTime when nothing changed
+func TestCertificateStatusConditions(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Equal(t, certificate.Generation, certificate.Status.ObservedGeneration, "ObservedGeneration should be set")
+	assert.True(t, meta.IsStatusConditionTrue(certificate.Status.Conditions, constants.ConditionReady), "Ready condition should be true")
+	assert.True(t, meta.IsStatusConditionFalse(certificate.Status.Conditions, constants.ConditionIssuing), "Issuing condition should be false")
+	assert.True(t, meta.IsStatusConditionFalse(certificate.Status.Conditions, constants.ConditionExpired), "Expired condition should be false")
+
+	ready := meta.FindStatusCondition(certificate.Status.Conditions, constants.ConditionReady)
+	assert.NotNil(t, ready, "Ready condition should exist")
+	assert.Equal(t, constants.ReasonIssued, ready.Reason, "Ready reason should be Issued")
+	lastTransitionTime := ready.LastTransitionTime
+
+	// Reconciling again should not change the lastTransitionTime
+	time.Sleep(time.Second)
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	certificate = &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	ready = meta.FindStatusCondition(certificate.Status.Conditions, constants.ConditionReady)
+	assert.NotNil(t, ready, "Ready condition should exist")
+	assert.True(t, lastTransitionTime.Equal(&ready.LastTransitionTime), "Ready lastTransitionTime should not change")
+
+	// A failed issuance should set the Ready condition to false
+	instance = getCertificateTemplate("test-certificate-failed", "default", "test-secret-failed", "1h", false, false, false)
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "missing-issuer", Kind: constants.KindIssuer}
+
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate-failed", "default")
+	assert.Error(t, err, "Reconcile should return an error")
+
+	certificate = &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate-failed", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Equal(t, constants.StatusFailed, certificate.Status.Status, "Certificate status should be Failed")
+	ready = meta.FindStatusCondition(certificate.Status.Conditions, constants.ConditionReady)
+	assert.NotNil(t, ready, "Ready condition should exist")
+	assert.Equal(t, metav1.ConditionFalse, ready.Status, "Ready condition should be false")
+	assert.Equal(t, constants.ReasonFailed, ready.Reason, "Ready reason should be Failed")
+}
+
+// TestCertificateExpiringCondition tests the Expiring condition of a Certificate that is not rotated
+// The condition should turn true at the renewal time and false again with the Expired reason once the certificate expired
+func TestCertificateExpiringCondition(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance that is due for renewal two seconds before it expires
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "4s", false, false, false)
+	instance.Spec.RenewBefore = "2s"
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	// getExpiring returns the Expiring condition of the Certificate instance
+	getExpiring := func() *metav1.Condition {
+		certificate := &certsv1.Certificate{}
+		err := r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+		assert.NoError(t, err, "Certificate instance should exist")
+		return meta.FindStatusCondition(certificate.Status.Conditions, constants.ConditionExpiring)
+	}
+
+	result, err := reconcileCertificate(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.InDelta(t, float64(2*time.Second), float64(result.RequeueAfter), float64(time.Second), "Certificate should be requeued at its renewal time")
+	expiring := getExpiring()
+	if assert.NotNil(t, expiring, "Expiring condition should exist") {
+		assert.Equal(t, metav1.ConditionFalse, expiring.Status, "Expiring condition should be false")
+		assert.Equal(t, constants.ReasonValid, expiring.Reason, "Expiring reason should be Valid")
+	}
+
+	// Within renewBefore of its expiry the certificate is expiring but still ready
+	time.Sleep(2500 * time.Millisecond)
+	result, err = reconcileCertificate(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.Greater(t, result.RequeueAfter, time.Duration(0), "Certificate should be requeued at its expiry")
+	expiring = getExpiring()
+	if assert.NotNil(t, expiring, "Expiring condition should exist") {
+		assert.Equal(t, metav1.ConditionTrue, expiring.Status, "Expiring condition should be true")
+		assert.Equal(t, constants.ReasonExpiring, expiring.Reason, "Expiring reason should be Expiring")
+	}
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.True(t, meta.IsStatusConditionTrue(certificate.Status.Conditions, constants.ConditionReady), "Ready condition should be true")
+
+	// Once the certificate expired it is no longer expiring but expired
+	time.Sleep(2 * time.Second)
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	expiring = getExpiring()
+	if assert.NotNil(t, expiring, "Expiring condition should exist") {
+		assert.Equal(t, metav1.ConditionFalse, expiring.Status, "Expiring condition should be false")
+		assert.Equal(t, constants.ReasonExpired, expiring.Reason, "Expiring reason should be Expired")
+	}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.True(t, meta.IsStatusConditionTrue(certificate.Status.Conditions, constants.ConditionExpired), "Expired condition should be true")
+}
+
+// TestCertificateStatusDetails tests the certificate details recorded in the status of a Certificate
+// The details should match the certificate stored in the Secret and not change while reconciling
+func TestCertificateStatusDetails(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance with an ECDSA key and several SANs
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.IPAddresses = []string{"10.0.0.1"}
+	instance.Spec.EmailAddresses = []string{"admin@k8c.io"}
+	instance.Spec.PrivateKey = &certsv1.PrivateKey{Algorithm: constants.KeyAlgorithmECDSA}
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// Parse the certificate stored in the Secret
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate")
+
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+
+	status := certificate.Status
+	assert.NotNil(t, status.NotBefore, "NotBefore should be set")
+	assert.NotNil(t, status.NotAfter, "NotAfter should be set")
+	assert.True(t, chain[0].NotBefore.Equal(status.NotBefore.Time), "NotBefore should match the certificate")
+	assert.True(t, chain[0].NotAfter.Equal(status.NotAfter.Time), "NotAfter should match the certificate")
+	assert.True(t, chain[0].NotAfter.Equal(status.ExpiryDate.Time), "ExpiryDate should match the certificate")
+	assert.Equal(t, cert.SerialNumber(chain[0]), status.SerialNumber, "SerialNumber should match the certificate")
+	assert.Len(t, strings.Split(status.Fingerprint, ":"), 32, "Fingerprint should be a SHA-256 fingerprint")
+	assert.Equal(t, chain[0].Issuer.String(), status.Issuer, "Issuer should match the certificate")
+	assert.Equal(t, []string{"DNS:example.k8c.io", "IP:10.0.0.1", "email:admin@k8c.io"}, status.SubjectAlternativeNames, "SubjectAlternativeNames should match the certificate")
+	assert.Equal(t, constants.KeyAlgorithmECDSA, status.KeyAlgorithm, "KeyAlgorithm should be ECDSA")
+	assert.Equal(t, 256, status.KeySize, "KeySize should be 256")
+
+	// Reconciling again should keep the details of the stored certificate
+	time.Sleep(time.Second)
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	certificate = &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Equal(t, status.Fingerprint, certificate.Status.Fingerprint, "Fingerprint should not change")
+	assert.True(t, status.ExpiryDate.Equal(&certificate.Status.ExpiryDate), "ExpiryDate should not change")
+}
+
+// TestCertificateWithSubject tests the creation of a Certificate with subject fields
+// The certificate should carry the subject fields and every certificate should get a unique random serial number
+func TestCertificateWithSubject(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance with a subject
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.Subject = &certsv1.Subject{
+		Organizations:       []string{"Kubermatic"},
+		OrganizationalUnits: []string{"Platform"},
+		Countries:           []string{"DE"},
+		Localities:          []string{"Hamburg"},
+		Provinces:           []string{"Hamburg"},
+		StreetAddresses:     []string{"Reeperbahn 1"},
+		PostalCodes:         []string{"20359"},
+		SerialNumber:        "1234",
+	}
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate")
+
+	subject := chain[0].Subject
+	assert.Equal(t, "example.k8c.io", subject.CommonName, "CommonName should be the DNS name")
+	assert.Equal(t, []string{"Kubermatic"}, subject.Organization, "Organization should be set")
+	assert.Equal(t, []string{"Platform"}, subject.OrganizationalUnit, "OrganizationalUnit should be set")
+	assert.Equal(t, []string{"DE"}, subject.Country, "Country should be set")
+	assert.Equal(t, []string{"Hamburg"}, subject.Locality, "Locality should be set")
+	assert.Equal(t, []string{"Hamburg"}, subject.Province, "Province should be set")
+	assert.Equal(t, []string{"Reeperbahn 1"}, subject.StreetAddress, "StreetAddress should be set")
+	assert.Equal(t, []string{"20359"}, subject.PostalCode, "PostalCode should be set")
+	assert.Equal(t, "1234", subject.SerialNumber, "SerialNumber should be set")
+
+	// Serial numbers should be random, positive and at most 128 bits
+	serialNumber := chain[0].SerialNumber
+	assert.Equal(t, 1, serialNumber.Sign(), "Serial number should be positive")
+	assert.LessOrEqual(t, serialNumber.BitLen(), 128, "Serial number should be at most 128 bits")
+
+	instance = getCertificateTemplate("test-certificate-other", "default", "test-secret-other", "1h", false, false, false)
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate-other", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret = &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret-other", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	otherChain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate")
+	assert.NotEqual(t, 0, serialNumber.Cmp(otherChain[0].SerialNumber), "Serial numbers should be unique")
+}
+
+// TestCertificateWithUsages tests the creation of a client Certificate with configured usages
+// The certificate should only carry the configured key usages and extended key usages
+func TestCertificateWithUsages(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance for mTLS clients
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.Usages = []certsv1.KeyUsage{constants.UsageDigitalSignature, constants.UsageClientAuth}
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate")
+
+	assert.Equal(t, x509.KeyUsageDigitalSignature, chain[0].KeyUsage, "Key usage should be digital signature")
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, chain[0].ExtKeyUsage, "Extended key usage should be client auth")
+	assert.False(t, chain[0].IsCA, "Certificate should not be a CA")
+}
+
+// TestCertificateWithIntermediateCA tests the creation of an intermediate CA Certificate
+// The intermediate CA should be usable by a CA Issuer and its path length should be enforced
+func TestCertificateWithIntermediateCA(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create the root CA Secret and the Issuer referencing it
+	caCert, caKey := getCAKeyPair(t, true)
+	caSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ca", Namespace: "default"},
+		Data:       map[string][]byte{"tls.crt": caCert, "tls.key": caKey},
+	}
+	err := r.Create(context.Background(), caSecret)
+	assert.NoError(t, err, "CA Secret should be created")
+
+	issuer := &certsv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "root-issuer", Namespace: "default"},
+		Spec:       certsv1.IssuerSpec{CA: &certsv1.CAIssuer{SecretName: "test-ca"}},
+	}
+	err = r.Create(context.Background(), issuer)
+	assert.NoError(t, err, "Issuer should be created")
+
+	// Create an intermediate CA Certificate that may not sign further CAs
+	maxPathLen := 0
+	instance := getCertificateTemplate("test-intermediate", "default", "test-intermediate", "1h", false, false, false)
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "root-issuer", Kind: constants.KindIssuer}
+	instance.Spec.Usages = []certsv1.KeyUsage{constants.UsageDigitalSignature, constants.UsageCRLSign}
+	instance.Spec.IsCA = true
+	instance.Spec.MaxPathLen = &maxPathLen
+
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-intermediate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-intermediate", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate")
+
+	assert.True(t, chain[0].IsCA, "Certificate should be a CA")
+	assert.True(t, chain[0].MaxPathLenZero, "MaxPathLen should be zero")
+	assert.NotZero(t, chain[0].KeyUsage&x509.KeyUsageCertSign, "CA certificate should be allowed to sign certificates")
+	assert.NotZero(t, chain[0].KeyUsage&x509.KeyUsageCRLSign, "CA certificate should be allowed to sign CRLs")
+
+	// Issue a leaf certificate from the intermediate CA
+	issuer = &certsv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "intermediate-issuer", Namespace: "default"},
+		Spec:       certsv1.IssuerSpec{CA: &certsv1.CAIssuer{SecretName: "test-intermediate"}},
+	}
+	err = r.Create(context.Background(), issuer)
+	assert.NoError(t, err, "Issuer should be created")
+
+	instance = getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "intermediate-issuer", Kind: constants.KindIssuer}
+
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret = &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	chain, err = cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate chain")
+	assert.Len(t, chain, 3, "Chain should contain the leaf, the intermediate and the root certificate")
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(secret.Data["ca.crt"])
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(chain[1])
+	_, err = chain[0].Verify(x509.VerifyOptions{DNSName: "example.k8c.io", Roots: roots, Intermediates: intermediates})
+	assert.NoError(t, err, "Certificate should verify through the intermediate CA")
+}
+
+// TestCertificateWithInvalidUsages tests Certificates with combinations of usages that do not make sense
+// The Certificate controller should set the status to Invalid and not create the Secret
+func TestCertificateWithInvalidUsages(t *testing.T) {
+	maxPathLen := 1
+	tests := []struct {
+		name string
+		spec func(spec *certsv1.CertificateSpec)
+	}{
+		{
+			name: "Cert sign without isCA",
+			spec: func(spec *certsv1.CertificateSpec) {
+				spec.Usages = []certsv1.KeyUsage{constants.UsageCertSign}
+			},
+		},
+		{
+			name: "MaxPathLen without isCA",
+			spec: func(spec *certsv1.CertificateSpec) { spec.MaxPathLen = &maxPathLen },
+		},
+		{
+			name: "Encipher only without key agreement",
+			spec: func(spec *certsv1.CertificateSpec) {
+				spec.Usages = []certsv1.KeyUsage{constants.UsageEncipherOnly}
+			},
+		},
+		{
+			name: "Key encipherment with an ECDSA key",
+			spec: func(spec *certsv1.CertificateSpec) {
+				spec.Usages = []certsv1.KeyUsage{constants.UsageKeyEncipherment}
+				spec.PrivateKey = &certsv1.PrivateKey{Algorithm: constants.KeyAlgorithmECDSA}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup the test environment
+			r := setupTestEnv()
+
+			// Create a Certificate instance with an invalid spec
+			instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+			tt.spec(&instance.Spec)
+
+			err := r.Create(context.Background(), instance)
+			assert.NoError(t, err, "Certificate instance should be created")
+
+			err = triggerReconcile(r, "test-certificate", "default")
+			assert.NoError(t, err, "Reconcile should not return an error")
+
+			// Check status of the Certificate instance
+			certificate := &certsv1.Certificate{}
+			err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+			assert.NoError(t, err, "Certificate instance should exist")
+			assert.Equal(t, constants.StatusInvalid, certificate.Status.Status, "Certificate status should be Invalid")
+
+			// Check that the secret was not created
+			secret := &corev1.Secret{}
+			err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+			assert.Error(t, err, "Secret should not be created")
+		})
+	}
+}
+
+// TestCertificateSpecChange tests the reissuance of a certificate when its spec changes
+// The certificate should only be reissued when a field it depends on changes, tracked by the spec hash annotation on the Secret
+func TestCertificateSpecChange(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	assert.NotEmpty(t, secret.Annotations[constants.AnnotationSpecHash], "Secret should have the spec hash annotation")
+	oldCertificate := secret.Data["tls.crt"]
+	oldHash := secret.Annotations[constants.AnnotationSpecHash]
+
+	// Changing fields the certificate does not depend on should not reissue it
+	updateCertificate := func(update func(spec *certsv1.CertificateSpec)) {
+		certificate := &certsv1.Certificate{}
+		err := r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+		assert.NoError(t, err, "Certificate instance should exist")
+		update(&certificate.Spec)
+		err = r.Update(context.Background(), certificate)
+		assert.NoError(t, err, "Certificate instance should be updated")
+
+		err = triggerReconcile(r, "test-certificate", "default")
+		assert.NoError(t, err, "Reconcile should not return an error")
+
+		secret = &corev1.Secret{}
+		err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+		assert.NoError(t, err, "Secret should exist")
+	}
+
+	updateCertificate(func(spec *certsv1.CertificateSpec) {
+		spec.RenewBefore = "10m"
+		spec.DNSNames = []string{spec.DNSName}
+		spec.DNSName = ""
+	})
+	assert.Equal(t, oldCertificate, secret.Data["tls.crt"], "Certificate should not be reissued")
+	assert.Equal(t, oldHash, secret.Annotations[constants.AnnotationSpecHash], "Spec hash should not change")
+
+	// Changing the names should reissue the certificate
+	updateCertificate(func(spec *certsv1.CertificateSpec) {
+		spec.DNSNames = append(spec.DNSNames, "www.example.k8c.io")
+	})
+	assert.NotEqual(t, oldCertificate, secret.Data["tls.crt"], "Certificate should be reissued")
+	assert.NotEqual(t, oldHash, secret.Annotations[constants.AnnotationSpecHash], "Spec hash should change")
+
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate")
+	assert.Equal(t, []string{"example.k8c.io", "www.example.k8c.io"}, chain[0].DNSNames, "Certificate should contain the new DNS names")
+}
+
+// TestCertificateWithoutSpecHash tests Secrets that were written before the spec hash annotation was tracked
+// The spec hash should be stamped on Secrets whose certificate matches the spec and the others should be reissued
+func TestCertificateWithoutSpecHash(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Certificate instance
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	oldCertificate := secret.Data["tls.crt"]
+	oldHash := secret.Annotations[constants.AnnotationSpecHash]
+
+	// Remove the spec hash annotation and reconcile the Certificate
+	removeSpecHash := func() {
+		secret := &corev1.Secret{}
+		err := r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+		assert.NoError(t, err, "Secret should exist")
+		delete(secret.Annotations, constants.AnnotationSpecHash)
+		err = r.Update(context.Background(), secret)
+		assert.NoError(t, err, "Secret should be updated")
+	}
+	removeSpecHash()
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// The certificate matches the spec, the spec hash should be stamped without reissuing it
+	secret = &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	assert.Equal(t, oldCertificate, secret.Data["tls.crt"], "Certificate should not be reissued")
+	assert.Equal(t, oldHash, secret.Annotations[constants.AnnotationSpecHash], "Spec hash should be stamped")
+
+	// Remove the spec hash annotation and change the names of the Certificate
+	removeSpecHash()
+
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	certificate.Spec.DNSNames = []string{"www.example.k8c.io"}
+	err = r.Update(context.Background(), certificate)
+	assert.NoError(t, err, "Certificate instance should be updated")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// The certificate no longer matches the spec and should be reissued
+	secret = &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	assert.NotEqual(t, oldCertificate, secret.Data["tls.crt"], "Certificate should be reissued")
+	assert.NotEmpty(t, secret.Annotations[constants.AnnotationSpecHash], "Secret should have the spec hash annotation")
+	assert.NotEqual(t, oldHash, secret.Annotations[constants.AnnotationSpecHash], "Spec hash should change")
+}
+
+// TestConcurrentReconciles tests reconciling several Certificates concurrently
+// Every Secret should hold a certificate issued for its own Certificate
+func TestConcurrentReconciles(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	const count = 5
+	for i := 0; i < count; i++ {
+		instance := getCertificateTemplate(fmt.Sprintf("test-certificate-%d", i), "default", fmt.Sprintf("test-secret-%d", i), "1h", false, false, false)
+		instance.Spec.DNSName = fmt.Sprintf("example-%d.k8c.io", i)
+		err := r.Create(context.Background(), instance)
+		assert.NoError(t, err, "Certificate instance should be created")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := triggerReconcile(r, fmt.Sprintf("test-certificate-%d", i), "default")
+			assert.NoError(t, err, "Reconcile should not return an error")
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < count; i++ {
+		secret := &corev1.Secret{}
+		err := r.Get(context.Background(), types.NamespacedName{Name: fmt.Sprintf("test-secret-%d", i), Namespace: "default"}, secret)
+		assert.NoError(t, err, "Secret should be created")
+		chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+		assert.NoError(t, err, "Secret should contain a certificate")
+		assert.Equal(t, []string{fmt.Sprintf("example-%d.k8c.io", i)}, chain[0].DNSNames, "Certificate should be issued for its own Certificate")
+	}
+}
+
+// TestReloadWorkloads tests the reloading of StatefulSets, DaemonSets and extra workload kinds
+// Every workload that mounts the secret should get the certificate ENV, other workloads should be left alone
+func TestReloadWorkloads(t *testing.T) {
+	// Setup the test environment with ReplicaSets as an extra workload kind
+	r := setupTestEnv(WorkloadKind{
+		GroupVersionKind: appsv1.SchemeGroupVersion.WithKind("ReplicaSet"),
+		PodTemplatePath:  []string{"spec", "template"},
+	})
+
+	// Create workloads that mount the secret and a Deployment that does not
+	workloads := []client.Object{
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-statefulset", Namespace: "default"},
+			Spec:       appsv1.StatefulSetSpec{Template: getPodTemplate("test-secret")},
+		},
+		&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-daemonset", Namespace: "default"},
+			Spec:       appsv1.DaemonSetSpec{Template: getPodTemplate("test-secret")},
+		},
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-replicaset", Namespace: "default"},
+			Spec:       appsv1.ReplicaSetSpec{Template: getPodTemplate("test-secret")},
+		},
+		getDeploymentTemplate("test-deployment", "default", "other-secret"),
+	}
+	for _, workload := range workloads {
+		err := r.Create(context.Background(), workload)
+		assert.NoError(t, err, "Workload should be created")
+	}
+
+	// Create a Certificate instance that reloads its workloads
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, true, false)
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// The workloads start with the issued certificate, its checksum is recorded without restarting them
+	statefulSet := &appsv1.StatefulSet{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-statefulset", Namespace: "default"}, statefulSet)
+	assert.NoError(t, err, "StatefulSet should exist")
+	assert.NotEmpty(t, statefulSet.Annotations[checksumAnnotationKey("test-secret")], "Checksum should be recorded on the StatefulSet")
+	_, err = checkIfChecksumAnnotationExists(&statefulSet.Spec.Template, "test-secret")
+	assert.Error(t, err, "StatefulSet should not be restarted")
+
+	// Reissuing the certificate should restart the workloads
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	certificate.Spec.Validity = "2h"
+	err = r.Update(context.Background(), certificate)
+	assert.NoError(t, err, "Certificate instance should be updated")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+
+	statefulSet = &appsv1.StatefulSet{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-statefulset", Namespace: "default"}, statefulSet)
+	assert.NoError(t, err, "StatefulSet should exist")
+	value, err := checkIfChecksumAnnotationExists(&statefulSet.Spec.Template, "test-secret")
+	assert.NoError(t, err, "Checksum annotation should be set on the StatefulSet")
+	assert.Equal(t, getSecretChecksum(secret), value, "Checksum should match")
+
+	daemonSet := &appsv1.DaemonSet{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-daemonset", Namespace: "default"}, daemonSet)
+	assert.NoError(t, err, "DaemonSet should exist")
+	value, err = checkIfChecksumAnnotationExists(&daemonSet.Spec.Template, "test-secret")
+	assert.NoError(t, err, "Checksum annotation should be set on the DaemonSet")
+	assert.Equal(t, getSecretChecksum(secret), value, "Checksum should match")
+
+	replicaSet := &appsv1.ReplicaSet{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-replicaset", Namespace: "default"}, replicaSet)
+	assert.NoError(t, err, "ReplicaSet should exist")
+	value, err = checkIfChecksumAnnotationExists(&replicaSet.Spec.Template, "test-secret")
+	assert.NoError(t, err, "Checksum annotation should be set on the extra workload kind")
+	assert.Equal(t, getSecretChecksum(secret), value, "Checksum should match")
+
+	deployment := &appsv1.Deployment{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-deployment", Namespace: "default"}, deployment)
+	assert.NoError(t, err, "Deployment should exist")
+	_, err = checkIfChecksumAnnotationExists(&deployment.Spec.Template, "test-secret")
+	assert.Error(t, err, "Checksum annotation should not be set on workloads that do not mount the secret")
+}
+
+// TestParseWorkloadKinds tests parsing the extra workload kinds flag
+func TestParseWorkloadKinds(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []WorkloadKind
+		wantErr  bool
+	}{
+		{
+			name:  "Empty",
+			input: "",
+		},
+		{
+			name:  "Multiple kinds",
+			input: "argoproj.io/v1alpha1/Rollout=spec.template, apps/v1/ReplicaSet=spec.template",
+			expected: []WorkloadKind{
+				{
+					GroupVersionKind: schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"},
+					PodTemplatePath:  []string{"spec", "template"},
+				},
+				{
+					GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"},
+					PodTemplatePath:  []string{"spec", "template"},
+				},
+			},
+		},
+		{
+			name:  "Core group",
+			input: "v1/ReplicationController=spec.template",
+			expected: []WorkloadKind{
+				{
+					GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ReplicationController"},
+					PodTemplatePath:  []string{"spec", "template"},
+				},
+			},
+		},
+		{
+			name:    "Missing pod template path",
+			input:   "argoproj.io/v1alpha1/Rollout",
+			wantErr: true,
+		},
+		{
+			name:    "Missing version",
+			input:   "Rollout=spec.template",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kinds, err := ParseWorkloadKinds(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, kinds)
+			}
+		})
+	}
+}
+
+// TestDetectSecretUsage tests the detection of workloads that use the secret without mounting it as a secret volume
+// Projected volumes, envFrom, env secretKeyRef and init containers should be detected and reported in the status
+func TestDetectSecretUsage(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// A Deployment that uses the secret through a projected volume
+	projected := getDeploymentTemplate("test-projected", "default", "other-secret")
+	projected.Spec.Template.Spec.Volumes = append(projected.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name: "projected-volume",
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{
+					{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "test-secret"}}},
+				},
+			},
+		},
+	})
+
+	// A StatefulSet that uses the secret through envFrom
+	envFrom := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-envfrom", Namespace: "default"},
+		Spec:       appsv1.StatefulSetSpec{Template: getPodTemplate("other-secret")},
+	}
+	envFrom.Spec.Template.Spec.Containers[0].EnvFrom = []corev1.EnvFromSource{
+		{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "test-secret"}}},
+	}
+
+	// A DaemonSet that uses the secret through env secretKeyRef of an init container
+	initContainer := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-init", Namespace: "default"},
+		Spec:       appsv1.DaemonSetSpec{Template: getPodTemplate("other-secret")},
+	}
+	initContainer.Spec.Template.Spec.InitContainers = []corev1.Container{
+		{
+			Name: "init",
+			Env: []corev1.EnvVar{
+				{
+					Name: "TLS_CERT",
+					ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "test-secret"},
+							Key:                  "tls.crt",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, workload := range []client.Object{projected, envFrom, initContainer, getDeploymentTemplate("test-unrelated", "default", "other-secret")} {
+		err := r.Create(context.Background(), workload)
+		assert.NoError(t, err, "Workload should be created")
+	}
+
+	// Create a Certificate instance that reloads its workloads
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, true, false)
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// The certificate checksum should be recorded on all workloads using the secret
+	deployment := &appsv1.Deployment{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-projected", Namespace: "default"}, deployment)
+	assert.NoError(t, err, "Deployment should exist")
+	assert.NotEmpty(t, deployment.Annotations[checksumAnnotationKey("test-secret")], "Deployment using a projected volume should be tracked")
+
+	statefulSet := &appsv1.StatefulSet{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-envfrom", Namespace: "default"}, statefulSet)
+	assert.NoError(t, err, "StatefulSet should exist")
+	assert.NotEmpty(t, statefulSet.Annotations[checksumAnnotationKey("test-secret")], "StatefulSet using envFrom should be tracked")
+
+	daemonSet := &appsv1.DaemonSet{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-init", Namespace: "default"}, daemonSet)
+	assert.NoError(t, err, "DaemonSet should exist")
+	assert.NotEmpty(t, daemonSet.Annotations[checksumAnnotationKey("test-secret")], "DaemonSet using the secret in an init container should be tracked")
+
+	deployment = &appsv1.Deployment{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-unrelated", Namespace: "default"}, deployment)
+	assert.NoError(t, err, "Deployment should exist")
+	assert.Empty(t, deployment.Annotations[checksumAnnotationKey("test-secret")], "Deployment not using the secret should not be tracked")
+
+	// The matched workloads and the reasons should be reported in the status
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.ElementsMatch(t, []certsv1.WorkloadReference{
+		{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-projected", Reasons: []string{`projected volume "projected-volume"`}},
+		{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "test-envfrom", Reasons: []string{`envFrom of container "test-container"`}},
+		{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "test-init", Reasons: []string{`env "TLS_CERT" of init container "init"`}},
+	}, certificate.Status.Workloads, "Status should report the matched workloads and why")
+}
+
+// TestReloadWithChecksumAnnotation tests the default reload mode that sets a checksum annotation on the pod template
+// Workloads should only roll when the certificate changes and not get the certificate ENV
+func TestReloadWithChecksumAnnotation(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	deployment := getDeploymentTemplate("test-deployment", "default", "test-secret")
+	err := r.Create(context.Background(), deployment)
+	assert.NoError(t, err, "Deployment should be created")
+
+	// Create a Certificate instance that reloads its workloads
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, true, false)
+
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+
+	// The Deployment starts with the issued certificate, its checksum is recorded without restarting it
+	deployment = &appsv1.Deployment{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-deployment", Namespace: "default"}, deployment)
+	assert.NoError(t, err, "Deployment should exist")
+	checksum := deployment.Annotations[checksumAnnotationKey("test-secret")]
+	assert.Equal(t, getSecretChecksum(secret), checksum, "Recorded checksum should match the secret data")
+	_, err = checkIfChecksumAnnotationExists(&deployment.Spec.Template, "test-secret")
+	assert.Error(t, err, "Deployment should not be restarted")
+	_, err = checkIfCertificateEnvExists(deployment)
+	assert.Error(t, err, "Certificate ENV should not be inserted")
+	oldResourceVersion := deployment.ResourceVersion
+
+	// Changing only the metadata of the secret should not roll the workload
+	secret.Labels = map[string]string{"team": "platform"}
+	err = r.Update(context.Background(), secret)
+	assert.NoError(t, err, "Secret should be updated")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	deployment = &appsv1.Deployment{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-deployment", Namespace: "default"}, deployment)
+	assert.NoError(t, err, "Deployment should exist")
+	assert.Equal(t, oldResourceVersion, deployment.ResourceVersion, "Deployment should not be patched")
+
+	// Reissuing the certificate should roll the workload
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	certificate.Spec.Validity = "2h"
+	err = r.Update(context.Background(), certificate)
+	assert.NoError(t, err, "Certificate instance should be updated")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret = &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+
+	deployment = &appsv1.Deployment{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-deployment", Namespace: "default"}, deployment)
+	assert.NoError(t, err, "Deployment should exist")
+	newChecksum, err := checkIfChecksumAnnotationExists(&deployment.Spec.Template, "test-secret")
+	assert.NoError(t, err, "Checksum annotation should be set")
+	assert.NotEqual(t, checksum, newChecksum, "Checksum should change with the certificate")
+	assert.Equal(t, getSecretChecksum(secret), newChecksum, "Checksum should match the new secret data")
+	assert.Equal(t, newChecksum, deployment.Annotations[checksumAnnotationKey("test-secret")], "Recorded checksum should be updated")
+
+	// A Deployment created later starts with the current certificate and should not be restarted
+	err = r.Create(context.Background(), getDeploymentTemplate("test-deployment-new", "default", "test-secret"))
+	assert.NoError(t, err, "Deployment should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	deployment = &appsv1.Deployment{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-deployment-new", Namespace: "default"}, deployment)
+	assert.NoError(t, err, "Deployment should exist")
+	assert.Equal(t, newChecksum, deployment.Annotations[checksumAnnotationKey("test-secret")], "Checksum should be recorded on the new Deployment")
+	_, err = checkIfChecksumAnnotationExists(&deployment.Spec.Template, "test-secret")
+	assert.Error(t, err, "New Deployment should not be restarted")
+}
+
+// TestReloadAnnotations tests that workloads can opt out of reloads and opt in to reloads for Certificates they name
+func TestReloadAnnotations(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	// Create a Deployment that mounts the secret but opted out and one that opted in without mounting it
+	optedOut := getDeploymentTemplate("opted-out", "default", "test-secret")
+	optedOut.Annotations = map[string]string{constants.AnnotationReload: "false"}
+	optedIn := getDeploymentTemplate("opted-in", "default", "other-secret")
+	optedIn.Annotations = map[string]string{constants.AnnotationReloadCertificates: "other-certificate, test-certificate"}
+	for _, deployment := range []*appsv1.Deployment{optedOut, optedIn} {
+		err := r.Create(context.Background(), deployment)
+		assert.NoError(t, err, "Deployment should be created")
+	}
+
+	// Create a Certificate instance without ReloadOnChange
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+
+	deployment := &appsv1.Deployment{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "opted-in", Namespace: "default"}, deployment)
+	assert.NoError(t, err, "Deployment should exist")
+	assert.Equal(t, getSecretChecksum(secret), deployment.Annotations[checksumAnnotationKey("test-secret")], "Checksum should be recorded on the opted in Deployment")
+
+	// Enabling ReloadOnChange should still leave the opted out Deployment alone
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	certificate.Spec.ReloadOnChange = true
+	err = r.Update(context.Background(), certificate)
+	assert.NoError(t, err, "Certificate instance should be updated")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	deployment = &appsv1.Deployment{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "opted-out", Namespace: "default"}, deployment)
+	assert.NoError(t, err, "Deployment should exist")
+	_, err = checkIfChecksumAnnotationExists(&deployment.Spec.Template, "test-secret")
+	assert.Error(t, err, "Checksum annotation should not be set on the opted out Deployment")
+	assert.Empty(t, deployment.Annotations[checksumAnnotationKey("test-secret")], "Checksum should not be recorded on the opted out Deployment")
+
+	certificate = &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Equal(t, []certsv1.WorkloadReference{
+		{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       "opted-in",
+			Reasons:    []string{fmt.Sprintf("annotation %q", constants.AnnotationReloadCertificates)},
+		},
+	}, certificate.Status.Workloads, "Only the opted in Deployment should be recorded")
+}
+
+// TestStaggeredReload tests that workloads are restarted one at a time and only after the previous one became available
+func TestStaggeredReload(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	names := []string{"test-deployment-a", "test-deployment-b", "test-deployment-c"}
+	for _, name := range names {
+		err := r.Create(context.Background(), getDeploymentTemplate(name, "default", "test-secret"))
+		assert.NoError(t, err, "Deployment should be created")
+	}
+
+	// Create a Certificate instance that restarts one workload at a time
+	maxConcurrent := 1
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, true, false)
+	instance.Spec.ReloadStrategy = &certsv1.ReloadStrategy{
+		MaxConcurrent:    &maxConcurrent,
+		WaitForAvailable: true,
+	}
+
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	// getReloaded returns the names of the Deployments that were restarted
+	getReloaded := func() []string {
+		var reloaded []string
+		for _, name := range names {
+			deployment := &appsv1.Deployment{}
+			err := r.Get(context.Background(), types.NamespacedName{Name: name, Namespace: "default"}, deployment)
+			assert.NoError(t, err, "Deployment should exist")
+			if _, err := checkIfChecksumAnnotationExists(&deployment.Spec.Template, "test-secret"); err == nil {
+				reloaded = append(reloaded, name)
+			}
+		}
+		return reloaded
+	}
+
+	// getReloadStatus returns the reload progress in the status of the Certificate instance
+	getReloadStatus := func() *certsv1.ReloadStatus {
+		certificate := &certsv1.Certificate{}
+		err := r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+		assert.NoError(t, err, "Certificate instance should exist")
+		return certificate.Status.Reload
+	}
+
+	// setAvailable marks the rollout of the Deployment as complete
+	setAvailable := func(name string) {
+		deployment := &appsv1.Deployment{}
+		err := r.Get(context.Background(), types.NamespacedName{Name: name, Namespace: "default"}, deployment)
+		assert.NoError(t, err, "Deployment should exist")
+		deployment.Status = appsv1.DeploymentStatus{
+			ObservedGeneration: deployment.Generation,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+			AvailableReplicas:  1,
+			Conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+			},
+		}
+		err = r.Status().Update(context.Background(), deployment)
+		assert.NoError(t, err, "Deployment status should be updated")
+	}
+
+	// The Deployments start with the issued certificate, they are only restarted once it is reissued
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.Empty(t, getReloaded(), "No Deployment should be restarted")
+	assert.Equal(t, 3, getReloadStatus().Completed, "The recorded Deployments should be completed")
+
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, instance)
+	assert.NoError(t, err, "Certificate instance should exist")
+	instance.Spec.Validity = "2h"
+	err = r.Update(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be updated")
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-certificate", Namespace: "default"}}
+	result, err := reconcileCertificate(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.Equal(t, reloadRequeueInterval, result.RequeueAfter, "Certificate should be requeued while reloading")
+	assert.Equal(t, names[:1], getReloaded(), "Only the first Deployment should be restarted")
+
+	reload := getReloadStatus()
+	assert.NotNil(t, reload, "Reload progress should be set")
+	assert.Equal(t, 3, reload.Total, "Total should be set")
+	assert.Equal(t, 1, reload.Updated, "Updated should be set")
+	assert.Equal(t, 0, reload.Completed, "Completed should be set")
+	assert.Equal(t, []string{"Deployment/test-deployment-a"}, reload.Restarting, "Restarting should be set")
+	assert.NotNil(t, reload.StartTime, "StartTime should be set")
+	assert.Nil(t, reload.CompletionTime, "CompletionTime should not be set")
+	startTime := reload.StartTime
+
+	// The next Deployment waits until the first one is available
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.Equal(t, names[:1], getReloaded(), "The second Deployment should wait")
+
+	// The next Deployment also waits while pods of the previous revision are still running
+	deployment := &appsv1.Deployment{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-deployment-a", Namespace: "default"}, deployment)
+	assert.NoError(t, err, "Deployment should exist")
+	deployment.Status = appsv1.DeploymentStatus{
+		ObservedGeneration: deployment.Generation,
+		Replicas:           2,
+		UpdatedReplicas:    1,
+		AvailableReplicas:  1,
+		Conditions: []appsv1.DeploymentCondition{
+			{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+		},
+	}
+	err = r.Status().Update(context.Background(), deployment)
+	assert.NoError(t, err, "Deployment status should be updated")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.Equal(t, names[:1], getReloaded(), "The second Deployment should wait for the old pods to terminate")
+
+	// A restarted controller resumes with the next Deployment
+	setAvailable("test-deployment-a")
+	restarted := &CertificateReconciler{Client: r.Client, Log: r.Log, Scheme: r.Scheme}
+	err = triggerReconcile(restarted, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.Equal(t, names[:2], getReloaded(), "The second Deployment should be restarted")
+
+	reload = getReloadStatus()
+	assert.Equal(t, 2, reload.Updated, "Updated should be set")
+	assert.Equal(t, 1, reload.Completed, "Completed should be set")
+	assert.Equal(t, []string{"Deployment/test-deployment-b"}, reload.Restarting, "Restarting should be set")
+	assert.True(t, startTime.Equal(reload.StartTime), "StartTime should be kept")
+
+	setAvailable("test-deployment-b")
+	err = triggerReconcile(restarted, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.Equal(t, names, getReloaded(), "The third Deployment should be restarted")
+
+	// Once all Deployments are available the reload completes
+	setAvailable("test-deployment-c")
+	result, err = restarted.Reconcile(context.Background(), request)
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.InDelta(t, float64(2*time.Hour), float64(result.RequeueAfter), float64(time.Minute), "Certificate should only be requeued at its expiry once reloaded")
+
+	reload = getReloadStatus()
+	assert.Equal(t, 3, reload.Updated, "Updated should be set")
+	assert.Equal(t, 3, reload.Completed, "Completed should be set")
+	assert.Empty(t, reload.Restarting, "Restarting should be empty")
+	assert.NotNil(t, reload.CompletionTime, "CompletionTime should be set")
+}
+
+// TestCertificateWithACMEIssuer tests a Certificate issued by an ACME server with dns-01 and http-01 challenges
+// The solver resources and TXT records should be removed once the order is valid
+func TestCertificateWithACMEIssuer(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+	server, dns := setupACMEServer(t, r)
+	defer server.Close()
+
+	issuer := getACMEIssuerTemplate(server)
+	err := r.Create(context.Background(), issuer)
+	assert.NoError(t, err, "Issuer should be created")
+
+	// Names of the dns.k8c.io zone are solved with dns-01, the others with http-01
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.DNSName = "dns.k8c.io"
+	instance.Spec.DNSNames = []string{"*.dns.k8c.io", "http.k8c.io"}
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// The account key should be stored for the next orders
+	accountKey := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "acme-account", Namespace: "default"}, accountKey)
+	assert.NoError(t, err, "ACME account key Secret should be created")
+
+	// The issued chain should verify against the root of the ACME server
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate chain")
+	assert.Len(t, chain, 2, "Chain should contain the leaf and the intermediate certificate")
+	assert.Equal(t, []string{"dns.k8c.io", "*.dns.k8c.io", "http.k8c.io"}, chain[0].DNSNames, "DNS names should match")
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(server.RootPEM())
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(chain[1])
+	_, err = chain[0].Verify(x509.VerifyOptions{DNSName: "www.dns.k8c.io", Roots: roots, Intermediates: intermediates})
+	assert.NoError(t, err, "Certificate should be issued by the ACME server")
+
+	// ACME servers do not return their root, ca.crt holds the top of the chain
+	ca, err := cert.ParseCertificates(secret.Data["ca.crt"])
+	assert.NoError(t, err, "Secret should contain a CA certificate")
+	assert.Equal(t, chain[1].Raw, ca[0].Raw, "ca.crt should contain the intermediate certificate")
+
+	// The order and its challenges should be recorded in the status
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Equal(t, constants.StatusDeployed, certificate.Status.Status, "Certificate status should be deployed")
+
+	request := &certsv1.CertificateRequest{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: certificate.Status.CertificateRequest, Namespace: "default"}, request)
+	assert.NoError(t, err, "CertificateRequest should exist")
+	if assert.NotNil(t, request.Status.ACME, "ACME order should be recorded") {
+		assert.Equal(t, acme.StatusValid, request.Status.ACME.State, "ACME order should be valid")
+		assert.Equal(t, []string{"dns.k8c.io", "*.dns.k8c.io", "http.k8c.io"}, request.Status.ACME.Identifiers, "ACME order identifiers should match")
+
+		challengeTypes := map[string]string{}
+		for _, challenge := range request.Status.ACME.Challenges {
+			assert.Equal(t, acme.StatusValid, challenge.State, "ACME challenge should be valid")
+			challengeTypes[challenge.DNSName] = challenge.Type
+		}
+		assert.Equal(t, map[string]string{
+			"dns.k8c.io":   acme.ChallengeDNS01,
+			"*.dns.k8c.io": acme.ChallengeDNS01,
+			"http.k8c.io":  acme.ChallengeHTTP01,
+		}, challengeTypes, "Every name should be solved with the challenge of its solver")
+	}
+
+	// The TXT records and the http-01 solver resources should be removed
+	assert.Empty(t, dns.Records(), "TXT records should be removed")
+	pods := &corev1.PodList{}
+	err = r.List(context.Background(), pods, client.InNamespace("default"), client.HasLabels{constants.LabelACMEHTTP01Solver})
+	assert.NoError(t, err, "Pods should be listed")
+	assert.Empty(t, pods.Items, "Solver Pods should be removed")
+	ingresses := &networkingv1.IngressList{}
+	err = r.List(context.Background(), ingresses, client.InNamespace("default"), client.HasLabels{constants.LabelACMEHTTP01Solver})
+	assert.NoError(t, err, "Ingresses should be listed")
+	assert.Empty(t, ingresses.Items, "Solver Ingresses should be removed")
+}
+
+// TestCertificateWithFailedACMEChallenge tests a Certificate whose http-01 challenge can not be validated
+// The Certificate controller should record the invalid order, remove the solver resources and not create the Secret
+func TestCertificateWithFailedACMEChallenge(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+	server, _ := setupACMEServer(t, r)
+	defer server.Close()
+
+	// The http-01 challenge is answered with a wrong key authorization
+	server.HTTP01 = func(context.Context, string, string) (string, error) {
+		return "wrong", nil
+	}
+
+	issuer := getACMEIssuerTemplate(server)
+	err := r.Create(context.Background(), issuer)
+	assert.NoError(t, err, "Issuer should be created")
+
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.DNSName = "http.k8c.io"
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.Error(t, err, "Reconcile should return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.Error(t, err, "Secret should not be created")
+
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Equal(t, constants.StatusFailed, certificate.Status.Status, "Certificate status should be failed")
+
+	request := &certsv1.CertificateRequest{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate-1", Namespace: "default"}, request)
+	assert.NoError(t, err, "CertificateRequest should exist")
+	if assert.NotNil(t, request.Status.ACME, "ACME order should be recorded") {
+		assert.Equal(t, acme.StatusInvalid, request.Status.ACME.State, "ACME order should be invalid")
+		assert.NotEmpty(t, request.Status.ACME.Reason, "ACME order should have a reason")
+		if assert.Len(t, request.Status.ACME.Challenges, 1, "ACME challenge should be recorded") {
+			assert.Equal(t, acme.StatusInvalid, request.Status.ACME.Challenges[0].State, "ACME challenge should be invalid")
+			assert.NotEmpty(t, request.Status.ACME.Challenges[0].Reason, "ACME challenge should have a reason")
+		}
+	}
+
+	pods := &corev1.PodList{}
+	err = r.List(context.Background(), pods, client.InNamespace("default"), client.HasLabels{constants.LabelACMEHTTP01Solver})
+	assert.NoError(t, err, "Pods should be listed")
+	assert.Empty(t, pods.Items, "Solver Pods should be removed")
+}
+
+// TestCertificateWithPendingACMESelfCheck tests a Certificate whose dns-01 challenge has not propagated yet
+// The challenge should be presented once and only be accepted after the self check finds the TXT record
+func TestCertificateWithPendingACMESelfCheck(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+	server, dns := setupACMEServer(t, r)
+	defer server.Close()
+
+	issuer := getACMEIssuerTemplate(server)
+	err := r.Create(context.Background(), issuer)
+	assert.NoError(t, err, "Issuer should be created")
+
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.DNSName = "dns.k8c.io"
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	_, err = r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-certificate", Namespace: "default"}})
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	// The resolver of the self check does not see the TXT record yet
+	requestReconciler := &CertificateRequestReconciler{
+		Client:        r.Client,
+		Log:           r.Log,
+		Scheme:        r.Scheme,
+		ACMESelfCheck: &acme.SelfCheck{Resolver: acmetest.NewDNSStub()},
+	}
+	for i := 0; i < 2; i++ {
+		result, err := requestReconciler.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-certificate-1", Namespace: "default"}})
+		assert.NoError(t, err, "Reconcile should not return an error")
+		assert.Greater(t, result.RequeueAfter, time.Duration(0), "CertificateRequest should be requeued")
+	}
+
+	request := &certsv1.CertificateRequest{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate-1", Namespace: "default"}, request)
+	assert.NoError(t, err, "CertificateRequest should exist")
+	if assert.NotNil(t, request.Status.ACME, "ACME order should be recorded") && assert.Len(t, request.Status.ACME.Challenges, 1, "ACME challenge should be recorded") {
+		challenge := request.Status.ACME.Challenges[0]
+		assert.Equal(t, acme.StatusPending, challenge.State, "ACME challenge should not be accepted")
+		assert.True(t, challenge.Presented, "ACME challenge should be presented")
+		assert.Contains(t, challenge.Reason, "self check", "Reason should contain the self check error")
+	}
+	values, err := dns.LookupTXT(context.Background(), acme.DNS01Record("dns.k8c.io"))
+	assert.NoError(t, err, "TXT record should be created")
+	assert.Len(t, values, 1, "TXT record should only be presented once")
+
+	// Once the TXT record is seen the challenge is accepted and the certificate issued
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	assert.Empty(t, dns.Records(), "TXT records should be removed")
+}
+
+// TestCertificateWithVaultIssuer tests the creation of a Certificate signed by a Vault PKI role with a token from a Secret
+// The Secret should contain the chain returned by Vault and the requested names and lifetime should be sent to the sign endpoint
+func TestCertificateWithVaultIssuer(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+	server, err := vaulttest.NewServer()
+	assert.NoError(t, err, "Vault server should start")
+	defer server.Close()
+	server.Roles["k8c-io"] = true
+
+	tokenSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "vault-token", Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte(server.RootToken + "\n")},
+	}
+	err = r.Create(context.Background(), tokenSecret)
+	assert.NoError(t, err, "Vault token Secret should be created")
+
+	issuer := getVaultIssuerTemplate(server, certsv1.VaultAuth{TokenSecretRef: &certsv1.SecretRef{Name: "vault-token"}})
+	err = r.Create(context.Background(), issuer)
+	assert.NoError(t, err, "Issuer should be created")
+
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.DNSNames = []string{"www.k8c.io"}
+	instance.Spec.IPAddresses = []string{"10.0.0.1"}
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate chain")
+	assert.Len(t, chain, 3, "Chain should contain the leaf, the intermediate and the root certificate")
+	assert.Equal(t, []string{"example.k8c.io", "www.k8c.io"}, chain[0].DNSNames, "DNS names should match")
+	assert.InDelta(t, float64(time.Hour), float64(chain[0].NotAfter.Sub(chain[0].NotBefore)), float64(time.Minute), "Validity should be requested from Vault")
+	assert.Equal(t, server.RootPEM(), secret.Data["ca.crt"], "ca.crt should contain the root of the Vault CA")
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(server.RootPEM())
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(chain[1])
+	_, err = chain[0].Verify(x509.VerifyOptions{DNSName: "www.k8c.io", Roots: roots, Intermediates: intermediates})
+	assert.NoError(t, err, "Certificate should be signed by Vault")
+
+	requests := server.SignRequests()
+	if assert.Len(t, requests, 1, "Vault should sign one certificate") {
+		assert.Equal(t, "example.k8c.io", requests[0].CommonName, "Common name should be sent")
+		assert.Equal(t, "example.k8c.io,www.k8c.io", requests[0].AltNames, "DNS names should be sent")
+		assert.Equal(t, "10.0.0.1", requests[0].IPSANs, "IP addresses should be sent")
+		assert.Equal(t, "3600s", requests[0].TTL, "TTL should be sent")
+	}
+}
+
+// TestCertificateWithVaultKubernetesAuth tests a Vault issuer that logs in with the Kubernetes auth method
+// A Certificate should be issued with the token of the ServiceAccount and fail when the role rejects it
+func TestCertificateWithVaultKubernetesAuth(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+	server, err := vaulttest.NewServer()
+	assert.NoError(t, err, "Vault server should start")
+	defer server.Close()
+	server.Roles["k8c-io"] = true
+	server.KubernetesRoles["certificate-manager"] = "fake-token"
+
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "vault-issuer", Namespace: "default"}}
+	err = r.Create(context.Background(), serviceAccount)
+	assert.NoError(t, err, "ServiceAccount should be created")
+
+	issuer := getVaultIssuerTemplate(server, certsv1.VaultAuth{Kubernetes: &certsv1.VaultKubernetesAuth{Role: "certificate-manager", ServiceAccountName: "vault-issuer"}})
+	err = r.Create(context.Background(), issuer)
+	assert.NoError(t, err, "Issuer should be created")
+
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+
+	// A role that does not accept the token of the ServiceAccount should fail the issuance
+	instance = getCertificateTemplate("test-certificate-denied", "default", "test-secret-denied", "1h", false, false, false)
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+	server.KubernetesRoles["certificate-manager"] = "other-token"
+
+	err = triggerReconcile(r, "test-certificate-denied", "default")
+	assert.Error(t, err, "Reconcile should return an error")
+
+	request := &certsv1.CertificateRequest{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate-denied-1", Namespace: "default"}, request)
+	assert.NoError(t, err, "CertificateRequest should exist")
+	readyCondition := meta.FindStatusCondition(request.Status.Conditions, constants.ConditionReady)
+	if assert.NotNil(t, readyCondition, "Ready condition should be set") {
+		assert.Equal(t, constants.ReasonFailed, readyCondition.Reason, "CertificateRequest should be failed")
+		assert.Contains(t, readyCondition.Message, "permission denied", "Message should contain the Vault error")
+	}
+}
+
+// TestCertificateWithWebhookIssuer tests the creation of a Certificate signed by an external issuer over mutual TLS
+// The issuance should stay pending until the issuer signs the request and the CSR, usages and duration should be sent to it
+func TestCertificateWithWebhookIssuer(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+	server, err := webhooktest.NewServer()
+	assert.NoError(t, err, "Webhook server should start")
+	defer server.Close()
+	server.PendingAttempts = 1
+	createWebhookIssuer(t, r, server)
+
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+	instance.Spec.Usages = []certsv1.KeyUsage{constants.UsageDigitalSignature, constants.UsageClientAuth}
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	request := &certsv1.CertificateRequest{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate-1", Namespace: "default"}, request)
+	assert.NoError(t, err, "CertificateRequest should exist")
+	readyCondition := meta.FindStatusCondition(request.Status.Conditions, constants.ConditionReady)
+	if assert.NotNil(t, readyCondition, "Ready condition should be set") {
+		assert.Equal(t, constants.ReasonPending, readyCondition.Reason, "CertificateRequest should be pending")
+	}
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	assert.Equal(t, server.CAPEM(), secret.Data["ca.crt"], "ca.crt should contain the CA of the webhook")
+
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate")
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, chain[0].ExtKeyUsage, "Usages should be requested from the webhook")
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(server.CAPEM())
+	_, err = chain[0].Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	assert.NoError(t, err, "Certificate should be signed by the webhook")
+
+	requests := server.SignRequests()
+	if assert.Len(t, requests, 2, "Webhook should receive the request until it is signed") {
+		assert.Equal(t, requests[0].UID, requests[1].UID, "Retries should keep the UID")
+		assert.Equal(t, webhook.APIVersion, requests[1].APIVersion, "Protocol version should be sent")
+		assert.Equal(t, "test-certificate-1", requests[1].Name, "CertificateRequest name should be sent")
+		assert.Equal(t, []string{constants.UsageClientAuth, constants.UsageDigitalSignature}, requests[1].Usages, "Usages should be sent")
+		assert.Equal(t, int64(3600), requests[1].DurationSeconds, "Duration should be sent")
+	}
+}
+
+// TestCertificateWithRejectingWebhookIssuer tests that the CertificateRequest fails with the message of an external issuer that refuses to sign
+func TestCertificateWithRejectingWebhookIssuer(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+	server, err := webhooktest.NewServer()
+	assert.NoError(t, err, "Webhook server should start")
+	defer server.Close()
+	server.Authorize = func(request *webhook.SignRequest) error {
+		return fmt.Errorf("namespace %s is not allowed", request.Namespace)
+	}
+	createWebhookIssuer(t, r, server)
+
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.Error(t, err, "Reconcile should return an error")
+
+	request := &certsv1.CertificateRequest{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate-1", Namespace: "default"}, request)
+	assert.NoError(t, err, "CertificateRequest should exist")
+	readyCondition := meta.FindStatusCondition(request.Status.Conditions, constants.ConditionReady)
+	if assert.NotNil(t, readyCondition, "Ready condition should be set") {
+		assert.Equal(t, constants.ReasonFailed, readyCondition.Reason, "CertificateRequest should be failed")
+		assert.Contains(t, readyCondition.Message, "namespace default is not allowed", "Message should contain the webhook error")
+	}
+}
+
+// TestCertificateWithKeystores tests the PKCS#12 and JKS keystores written to the Secret of a Certificate
+// The keystores should only be regenerated when the certificate rotates or their password changes and removed when disabled
+func TestCertificateWithKeystores(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	passwordSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "keystore-password", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("changeit")},
+	}
+	err := r.Create(context.Background(), passwordSecret)
+	assert.NoError(t, err, "Password Secret should be created")
+
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "3s", false, false, true)
+	passwordRef := certsv1.SecretKeyRef{Name: "keystore-password", Key: "password"}
+	instance.Spec.Keystores = &certsv1.Keystores{
+		PKCS12: &certsv1.Keystore{PasswordSecretRef: passwordRef},
+		JKS:    &certsv1.Keystore{PasswordSecretRef: passwordRef},
+	}
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	for _, key := range []string{"keystore.p12", "truststore.p12", "keystore.jks", "truststore.jks"} {
+		assert.NotEmpty(t, secret.Data[key], "Secret should contain %s", key)
+	}
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate")
+	assert.True(t, bytes.Contains(secret.Data["keystore.jks"], chain[0].Raw), "JKS should contain the certificate")
+	keystoreP12 := secret.Data["keystore.p12"]
+
+	// Reconciling an unchanged Certificate should not regenerate the keystores
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	assert.Equal(t, keystoreP12, secret.Data["keystore.p12"], "Keystore should not be regenerated")
+
+	// A new password should regenerate the keystores without reissuing the certificate
+	passwordSecret.Data["password"] = []byte("changed")
+	err = r.Update(context.Background(), passwordSecret)
+	assert.NoError(t, err, "Password Secret should be updated")
+	tlsCrt := secret.Data["tls.crt"]
+	checksum := getSecretChecksum(secret)
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	assert.Equal(t, tlsCrt, secret.Data["tls.crt"], "Certificate should not be reissued")
+	assert.NotEqual(t, keystoreP12, secret.Data["keystore.p12"], "Keystore should be regenerated")
+	assert.Equal(t, checksum, getSecretChecksum(secret), "Checksum should not change without a new certificate")
+	keystoreP12 = secret.Data["keystore.p12"]
+
+	// A rotated certificate should be written to the keystores
+	time.Sleep(3 * time.Second)
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	assert.NotEqual(t, tlsCrt, secret.Data["tls.crt"], "Certificate should be rotated")
+	assert.NotEqual(t, keystoreP12, secret.Data["keystore.p12"], "Keystore should be regenerated")
+	chain, err = cert.ParseCertificates(secret.Data["tls.crt"])
+	assert.NoError(t, err, "Secret should contain a certificate")
+	assert.True(t, bytes.Contains(secret.Data["keystore.jks"], chain[0].Raw), "JKS should contain the rotated certificate")
+
+	// Disabled keystores should be removed from the Secret
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, instance)
+	assert.NoError(t, err, "Certificate should exist")
+	instance.Spec.Keystores.JKS = nil
+	err = r.Update(context.Background(), instance)
+	assert.NoError(t, err, "Certificate should be updated")
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	assert.NotContains(t, secret.Data, "keystore.jks", "JKS keystore should be removed")
+	assert.NotContains(t, secret.Data, "truststore.jks", "JKS truststore should be removed")
+	assert.Contains(t, secret.Data, "keystore.p12", "PKCS#12 keystore should be kept")
+}
+
+// TestMapSecretsToCertificates tests the Certificates that are reconciled when a Secret changes
+// Every Certificate in the namespace of the Secret that writes it or reads a keystore password from it should be returned
+func TestMapSecretsToCertificates(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	passwordRef := certsv1.SecretKeyRef{Name: "keystore-password", Key: "password"}
+	for _, certificate := range []struct{ name, namespace, secret string }{
+		{"test-certificate", "default", "test-secret"},
+		{"test-certificate-2", "default", "test-secret-2"},
+		{"test-certificate", "other", "test-secret"},
+	} {
+		instance := getCertificateTemplate(certificate.name, certificate.namespace, certificate.secret, "1h", false, false, false)
+		instance.Spec.Keystores = &certsv1.Keystores{PKCS12: &certsv1.Keystore{PasswordSecretRef: passwordRef}}
+		err := r.Create(context.Background(), instance)
+		assert.NoError(t, err, "Certificate instance should be created")
+	}
+
+	// The password Secret is used by both Certificates in its namespace
+	requests := MapSecretsToCertificates(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "keystore-password", Namespace: "default"}}, r.Client, r.Log)
+	assert.ElementsMatch(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: "test-certificate", Namespace: "default"}},
+		{NamespacedName: types.NamespacedName{Name: "test-certificate-2", Namespace: "default"}},
+	}, requests, "Certificates in the namespace of the password Secret should be returned")
+
+	// The Secret of a Certificate is only written by the Certificate in its namespace
+	requests = MapSecretsToCertificates(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "other"}}, r.Client, r.Log)
+	assert.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: "test-certificate", Namespace: "other"}},
+	}, requests, "Only the Certificate in the namespace of the Secret should be returned")
+
+	// Secrets in namespaces without Certificates are not mapped
+	requests = MapSecretsToCertificates(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "keystore-password", Namespace: "unrelated"}}, r.Client, r.Log)
+	assert.Empty(t, requests, "No Certificates should be returned")
+}
+
+// TestCertificateWithSecretTemplate tests the labels, annotations and key aliases of the secret template
+// They should be kept in sync with the template without removing metadata added to the Secret by others
+func TestCertificateWithSecretTemplate(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	instance.Spec.SecretTemplate = &certsv1.SecretTemplate{
+		Labels:      map[string]string{"app": "test", "team": "platform"},
+		Annotations: map[string]string{"example.com/owner": "platform"},
+		KeyAliases:  map[string]string{"cert.pem": "tls.crt", "key.pem": "tls.key"},
+	}
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	assert.Equal(t, "test", secret.Labels["app"], "Secret should have the app label")
+	assert.Equal(t, "platform", secret.Labels["team"], "Secret should have the team label")
+	assert.Equal(t, "platform", secret.Annotations["example.com/owner"], "Secret should have the owner annotation")
+	assert.Equal(t, secret.Data["tls.crt"], secret.Data["cert.pem"], "cert.pem should be a copy of tls.crt")
+	assert.Equal(t, secret.Data["tls.key"], secret.Data["key.pem"], "key.pem should be a copy of tls.key")
+
+	// Metadata added by others should survive reconciles
+	secret.Labels["foreign"] = "value"
+	secret.Annotations["example.com/foreign"] = "value"
+	err = r.Update(context.Background(), secret)
+	assert.NoError(t, err, "Secret should be updated")
+
+	// Entries removed from the template should be removed from the Secret
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, instance)
+	assert.NoError(t, err, "Certificate should exist")
+	instance.Spec.SecretTemplate = &certsv1.SecretTemplate{
+		Labels:     map[string]string{"app": "changed"},
+		KeyAliases: map[string]string{"cert.pem": "tls.crt"},
+	}
+	err = r.Update(context.Background(), instance)
+	assert.NoError(t, err, "Certificate should be updated")
+	tlsCrt := secret.Data["tls.crt"]
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	assert.Equal(t, tlsCrt, secret.Data["tls.crt"], "Certificate should not be reissued")
+	assert.Equal(t, "changed", secret.Labels["app"], "App label should be updated")
+	assert.NotContains(t, secret.Labels, "team", "Team label should be removed")
+	assert.NotContains(t, secret.Annotations, "example.com/owner", "Owner annotation should be removed")
+	assert.NotContains(t, secret.Data, "key.pem", "key.pem alias should be removed")
+	assert.Equal(t, tlsCrt, secret.Data["cert.pem"], "cert.pem alias should be kept")
+	assert.Equal(t, "value", secret.Labels["foreign"], "Foreign label should be kept")
+	assert.Equal(t, "value", secret.Annotations["example.com/foreign"], "Foreign annotation should be kept")
+
+	// Removing the template should remove everything it set
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, instance)
+	assert.NoError(t, err, "Certificate should exist")
+	instance.Spec.SecretTemplate = nil
+	err = r.Update(context.Background(), instance)
+	assert.NoError(t, err, "Certificate should be updated")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	assert.NotContains(t, secret.Labels, "app", "App label should be removed")
+	assert.NotContains(t, secret.Data, "cert.pem", "cert.pem alias should be removed")
+	assert.NotContains(t, secret.Annotations, constants.AnnotationSecretTemplate, "Secret template annotation should be removed")
+	assert.Equal(t, "value", secret.Labels["foreign"], "Foreign label should be kept")
+}
+
+// TestCertificateWithInvalidSecretTemplate tests Certificates with secret templates that cannot be applied
+// The Certificate controller should set the status to Invalid and not create the Secret
+func TestCertificateWithInvalidSecretTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec func(spec *certsv1.CertificateSpec)
+	}{
+		{
+			name: "Secret template alias overwriting tls.crt",
+			spec: func(spec *certsv1.CertificateSpec) {
+				spec.SecretTemplate = &certsv1.SecretTemplate{KeyAliases: map[string]string{"tls.crt": "tls.key"}}
+			},
+		},
+		{
+			name: "Secret template alias with unknown source",
+			spec: func(spec *certsv1.CertificateSpec) {
+				spec.SecretTemplate = &certsv1.SecretTemplate{KeyAliases: map[string]string{"cert.pem": "missing"}}
+			},
+		},
+		{
+			name: "Secret template with invalid label",
+			spec: func(spec *certsv1.CertificateSpec) {
+				spec.SecretTemplate = &certsv1.SecretTemplate{Labels: map[string]string{"app": "not valid"}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup the test environment
+			r := setupTestEnv()
+
+			// Create a Certificate instance with an invalid secret template
+			instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+			tt.spec(&instance.Spec)
+
+			err := r.Create(context.Background(), instance)
+			assert.NoError(t, err, "Certificate instance should be created")
+
+			err = triggerReconcile(r, "test-certificate", "default")
+			assert.NoError(t, err, "Reconcile should not return an error")
+
+			// Check status of the Certificate instance
+			certificate := &certsv1.Certificate{}
+			err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+			assert.NoError(t, err, "Certificate instance should exist")
+			assert.Equal(t, constants.StatusInvalid, certificate.Status.Status, "Certificate status should be Invalid")
+
+			// Check that the secret was not created
+			secret := &corev1.Secret{}
+			err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+			assert.Error(t, err, "Secret should not be created")
+		})
+	}
+}
+
+// TestCertificateWithCombinedPEM tests the private key and certificate chain written to tls-combined.pem
+// It should follow rotations and be removed when CombinedPEM is disabled
+func TestCertificateWithCombinedPEM(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "3s", false, false, true)
+	instance.Spec.CombinedPEM = true
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	assert.Equal(t, append(append([]byte{}, secret.Data["tls.key"]...), secret.Data["tls.crt"]...), secret.Data["tls-combined.pem"],
+		"tls-combined.pem should contain the private key followed by the certificate chain")
+	_, err = cert.ParsePrivateKey(secret.Data["tls-combined.pem"])
+	assert.NoError(t, err, "tls-combined.pem should contain the private key")
+	_, err = cert.ParseCertificates(secret.Data["tls-combined.pem"])
+	assert.NoError(t, err, "tls-combined.pem should contain the certificate")
+
+	// A rotated certificate should be written to tls-combined.pem
+	combined := secret.Data["tls-combined.pem"]
+	time.Sleep(3 * time.Second)
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	assert.NotEqual(t, combined, secret.Data["tls-combined.pem"], "tls-combined.pem should be updated")
+	assert.Equal(t, append(append([]byte{}, secret.Data["tls.key"]...), secret.Data["tls.crt"]...), secret.Data["tls-combined.pem"],
+		"tls-combined.pem should contain the rotated certificate")
+
+	// Disabling CombinedPEM should remove tls-combined.pem without reissuing the certificate
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, instance)
+	assert.NoError(t, err, "Certificate should exist")
+	instance.Spec.CombinedPEM = false
+	err = r.Update(context.Background(), instance)
+	assert.NoError(t, err, "Certificate should be updated")
+	tlsCrt := secret.Data["tls.crt"]
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	assert.Equal(t, tlsCrt, secret.Data["tls.crt"], "Certificate should not be reissued")
+	assert.NotContains(t, secret.Data, "tls-combined.pem", "tls-combined.pem should be removed")
+}
+
+// TestCertificateWithReplication tests the copies of the Secret in the namespaces selected by ReplicateTo
+// Copies should follow the Secret, be restored when changed and removed when their namespace is no longer selected
+func TestCertificateWithReplication(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+	for name, labels := range map[string]map[string]string{
+		"default": {"ingress": "true"},
+		"app-a":   {"ingress": "true"},
+		"app-b":   {"ingress": "true"},
+		"app-c":   nil,
+		"foreign": nil,
+		"other":   nil,
+	} {
+		err := r.Create(context.Background(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}})
+		assert.NoError(t, err, "Namespace should be created")
+	}
+
+	// A Secret of the same name that is not a replica should be left alone
+	foreign := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "foreign"},
+		Data:       map[string][]byte{"tls.crt": []byte("foreign")},
+	}
+	err := r.Create(context.Background(), foreign)
+	assert.NoError(t, err, "Foreign Secret should be created")
+
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "3s", false, false, true)
+	instance.Spec.ReplicateTo = &certsv1.SecretReplication{
+		Namespaces:        []string{"app-c", "foreign"},
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"ingress": "true"}},
+	}
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	getReplica := func(namespace string) *corev1.Secret {
+		replica := &corev1.Secret{}
+		err := r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: namespace}, replica)
+		assert.NoError(t, err, "Replica should exist in %s", namespace)
+		return replica
+	}
+	for _, namespace := range []string{"app-a", "app-b", "app-c"} {
+		replica := getReplica(namespace)
+		assert.Equal(t, secret.Data, replica.Data, "Replica in %s should hold the data of the Secret", namespace)
+		assert.Equal(t, corev1.SecretTypeTLS, replica.Type, "Replica in %s should be a TLS Secret", namespace)
+		assert.Equal(t, "default", replica.Labels[constants.LabelReplicaSourceNamespace], "Replica should be labeled with the source namespace")
+	}
+	assert.Equal(t, []byte("foreign"), getReplica("foreign").Data["tls.crt"], "Foreign Secret should be left alone")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "other"}, &corev1.Secret{})
+	assert.Error(t, err, "Unselected namespaces should not get a replica")
+
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Equal(t, constants.StatusDeployed, certificate.Status.Status, "A foreign Secret should not fail the Certificate")
+	if assert.Len(t, certificate.Status.Replicas, 4, "Every selected namespace should be recorded") {
+		assert.Equal(t, certsv1.SecretReplicaStatus{Namespace: "app-a", Synced: true}, certificate.Status.Replicas[0], "app-a should be synced")
+		assert.Equal(t, "foreign", certificate.Status.Replicas[3].Namespace, "Foreign namespace should be recorded")
+		assert.False(t, certificate.Status.Replicas[3].Synced, "Foreign namespace should not be synced")
+		assert.NotEmpty(t, certificate.Status.Replicas[3].Message, "Foreign namespace should report the conflict")
+	}
+
+	// Editing a replica should reconcile its Certificate, which restores the replica
+	replica := getReplica("app-a")
+	edited := replica.DeepCopy()
+	edited.Data["tls.crt"] = []byte("edited")
+	err = r.Update(context.Background(), edited)
+	assert.NoError(t, err, "Replica should be updated")
+	assert.True(t, replicaChangedPredicate.Update(event.UpdateEvent{ObjectOld: replica, ObjectNew: edited}), "Edits to a replica should be watched")
+	foreignEdited := foreign.DeepCopy()
+	foreignEdited.ResourceVersion += "1"
+	assert.False(t, replicaChangedPredicate.Update(event.UpdateEvent{ObjectOld: foreign, ObjectNew: foreignEdited}), "Edits to Secrets that are not replicas should not be watched")
+	for _, request := range MapSecretsToCertificates(edited, r.Client, r.Log) {
+		_, err = r.Reconcile(context.Background(), request)
+		assert.NoError(t, err, "Reconcile should not return an error")
+	}
+	assert.Equal(t, secret.Data, getReplica("app-a").Data, "Edited replica should be restored")
+
+	// Changed replicas should be restored and a rotated certificate should reach every replica
+	replica = getReplica("app-a")
+	replica.Data["tls.crt"] = []byte("changed")
+	err = r.Update(context.Background(), replica)
+	assert.NoError(t, err, "Replica should be updated")
+	time.Sleep(3 * time.Second)
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	tlsCrt := secret.Data["tls.crt"]
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should exist")
+	assert.NotEqual(t, tlsCrt, secret.Data["tls.crt"], "Certificate should be rotated")
+	for _, namespace := range []string{"app-a", "app-b", "app-c"} {
+		assert.Equal(t, secret.Data, getReplica(namespace).Data, "Replica in %s should hold the rotated certificate", namespace)
+	}
+
+	// Replicas in namespaces that are no longer selected should be removed
+	namespace := &corev1.Namespace{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "app-b"}, namespace)
+	assert.NoError(t, err, "Namespace should exist")
+	namespace.Labels = nil
+	err = r.Update(context.Background(), namespace)
+	assert.NoError(t, err, "Namespace should be updated")
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "app-b"}, &corev1.Secret{})
+	assert.Error(t, err, "Replica should be removed from app-b")
+	getReplica("app-a")
+
+	// Removing ReplicateTo should remove every replica but leave the foreign Secret alone
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, instance)
+	assert.NoError(t, err, "Certificate should exist")
+	instance.Spec.ReplicateTo = nil
+	err = r.Update(context.Background(), instance)
+	assert.NoError(t, err, "Certificate should be updated")
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	for _, namespace := range []string{"app-a", "app-c"} {
+		err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: namespace}, &corev1.Secret{})
+		assert.Error(t, err, "Replica should be removed from %s", namespace)
+	}
+	assert.Equal(t, []byte("foreign"), getReplica("foreign").Data["tls.crt"], "Foreign Secret should be left alone")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Empty(t, certificate.Status.Replicas, "Replicas should be removed from the status")
+	assert.NotContains(t, certificate.Finalizers, constants.Finalizer, "Finalizer should be removed without ReplicateTo")
+
+	// Deleting a Certificate that replicates its Secret should remove the replicas even without PurgeOnDelete
+	instance = certificate.DeepCopy()
+	instance.Spec.ReplicateTo = &certsv1.SecretReplication{Namespaces: []string{"app-a", "foreign"}}
+	err = r.Update(context.Background(), instance)
+	assert.NoError(t, err, "Certificate should be updated")
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	getReplica("app-a")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, instance)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Contains(t, instance.Finalizers, constants.Finalizer, "Certificate should have the finalizer with ReplicateTo")
+
+	err = r.Delete(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be deleted")
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "app-a"}, &corev1.Secret{})
+	assert.Error(t, err, "Replica should be removed with the Certificate")
+	assert.Equal(t, []byte("foreign"), getReplica("foreign").Data["tls.crt"], "Foreign Secret should be left alone")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, &corev1.Secret{})
+	assert.NoError(t, err, "Secret should be kept without PurgeOnDelete")
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, &certsv1.Certificate{})
+	assert.Error(t, err, "Certificate instance should be removed once the finalizer is removed")
+}
+
+// triggerReconcile triggers the Reconcile function of the Certificate controller
+func triggerReconcile(r *CertificateReconciler, name, namespace string) error {
+	_, err := reconcileCertificate(r, name, namespace)
+	return err
+}
+
+// reconcileCertificate reconciles the Certificate like a running manager would
+// CertificateRequests the Certificate waits for are signed by the CertificateRequest controller, then the Certificate is reconciled again
+func reconcileCertificate(r *CertificateReconciler, name, namespace string) (reconcile.Result, error) {
+	ctx := context.Background()
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}
+	result, err := r.Reconcile(ctx, request)
+	if err != nil {
+		return result, err
+	}
+
+	requests := &certsv1.CertificateRequestList{}
+	if err := r.List(ctx, requests, client.InNamespace(namespace), client.MatchingLabels{constants.LabelCertificateName: name}); err != nil {
+		return result, err
+	}
+	signed := false
+	requestReconciler := &CertificateRequestReconciler{Client: r.Client, Log: r.Log, Scheme: r.Scheme, RequestToken: requestTestToken(r.Client), ACMESelfCheck: testACMESelfCheck(r.Client)}
+	for _, item := range requests.Items {
+		if meta.IsStatusConditionTrue(item.Status.Conditions, constants.ConditionReady) {
+			continue
+		}
+		// Signing failures are recorded in the status of the request, the Certificate reports them
+		_, _ = requestReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: item.Name, Namespace: namespace}})
+		signed = true
+	}
+	if !signed {
+		return result, nil
+	}
+	return r.Reconcile(ctx, request)
+}
+
+// requestTestToken returns a TokenRequester that issues fake-token for existing ServiceAccounts
+// The fake client does not support creating the token subresource
+func requestTestToken(c client.Client) TokenRequester {
+	return func(ctx context.Context, serviceAccount *corev1.ServiceAccount, tokenRequest *authenticationv1.TokenRequest) error {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(serviceAccount), serviceAccount); err != nil {
+			return err
+		}
+		tokenRequest.Status.Token = "fake-token"
+		return nil
+	}
+}
+
+// checkIfCertificateEnvExists checks if the certificate ENV exists in the deployment
+func checkIfCertificateEnvExists(deployment *appsv1.Deployment) (string, error) {
+	return checkIfPodTemplateEnvExists(&deployment.Spec.Template)
+}
+
+// checkIfChecksumAnnotationExists checks if the checksum annotation of the secret exists in the pod template
+func checkIfChecksumAnnotationExists(template *corev1.PodTemplateSpec, secretName string) (string, error) {
+	value, ok := template.Annotations[checksumAnnotationKey(secretName)]
+	if !ok {
+		return "", errors.New("Checksum annotation not found")
+	}
+	return value, nil
+}
+
+// checkIfPodTemplateEnvExists checks if the certificate ENV exists in the pod template
+func checkIfPodTemplateEnvExists(template *corev1.PodTemplateSpec) (string, error) {
+	for _, container := range template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name == constants.CertificateENVName {
+				return env.Value, nil
+			}
+		}
+	}
+	return "", errors.New("Certificate ENV not found")
+}
+
+// getCAKeyPair returns a PEM encoded self-signed certificate and key, which is a CA if isCA is set
+func getCAKeyPair(t *testing.T, isCA bool) ([]byte, []byte) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err, "CA key should be generated")
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	assert.NoError(t, err, "CA certificate should be created")
+
+	keyBytes, err := x509.MarshalECPrivateKey(privateKey)
+	assert.NoError(t, err, "CA key should be marshalled")
+
+	return pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: certBytes}),
+		pem.EncodeToMemory(&pem.Block{Type: constants.TypeECPrivateKey, Bytes: keyBytes})
+}
+
+// getCertificateTemplate returns a basic Certificate instance template
+func getCertificateTemplate(name, namespace, secretName, validity string, PurgeOnDelete, ReloadOnChange, RotateOnExpiry bool) *certsv1.Certificate {
+	return &certsv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: certsv1.CertificateSpec{
+			DNSName: "example.k8c.io",
+			SecretRef: certsv1.SecretRef{
+				Name: secretName,
+			},
+			Validity:       validity,
+			PurgeOnDelete:  PurgeOnDelete,
+			ReloadOnChange: ReloadOnChange,
+			RotateOnExpiry: RotateOnExpiry,
+		},
+	}
+}
+
+// getDeploymentTemplate returns a basic Deployment instance template
+func getDeploymentTemplate(name, namespace, secretName string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: getPodTemplate(secretName),
+		},
+	}
+}
+
+// getPodTemplate returns a pod template that mounts the secret
+func getPodTemplate(secretName string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "test-container",
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "test-volume",
+							MountPath: "/etc/secret-volume",
+							ReadOnly:  true,
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "test-volume",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName: secretName,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// setupACMEServer starts an ACME server that resolves dns-01 challenges with a DNS stub registered as the "stub" provider
+// and http-01 challenges with the key authorization of the solver Pod
+func setupACMEServer(t *testing.T, r *CertificateReconciler) (*acmetest.Server, *acmetest.DNSStub) {
+	server, err := acmetest.NewServer()
+	assert.NoError(t, err, "ACME server should be started")
+
+	dns := acmetest.NewDNSStub()
+	server.Resolver = dns
+	acme.RegisterDNSProvider("stub", func(map[string][]byte) (acme.DNSProvider, error) {
+		return dns, nil
+	})
+
+	server.HTTP01 = fetchSolverKeyAuthorization(r.Client)
+	return server, dns
+}
+
+// testACMESelfCheck checks http-01 challenges with the key authorization of the solver Pod
+// and dns-01 challenges with the TXT records of the DNS provider registered as "stub"
+func testACMESelfCheck(c client.Client) *acme.SelfCheck {
+	return &acme.SelfCheck{HTTP01: fetchSolverKeyAuthorization(c), Resolver: stubResolver{}}
+}
+
+// fetchSolverKeyAuthorization returns a function that reads the key authorization of a http-01 challenge from its solver Pod
+func fetchSolverKeyAuthorization(c client.Client) func(ctx context.Context, domain, token string) (string, error) {
+	return func(ctx context.Context, _ string, token string) (string, error) {
+		pod := &corev1.Pod{}
+		if err := c.Get(ctx, types.NamespacedName{Name: http01SolverName(token), Namespace: "default"}, pod); err != nil {
+			return "", err
+		}
+		for _, env := range pod.Spec.Containers[0].Env {
+			if env.Name == "KEY_AUTHORIZATION" {
+				return env.Value, nil
+			}
+		}
+		return "", errors.New("key authorization not found")
+	}
+}
+
+// stubResolver looks up TXT records in the DNS provider registered as "stub"
+type stubResolver struct{}
+
+// LookupTXT returns the values of the TXT record of the stub provider
+func (stubResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	provider, err := acme.NewDNSProvider("stub", nil)
+	if err != nil {
+		return nil, err
+	}
+	resolver, ok := provider.(acme.Resolver)
+	if !ok {
+		return nil, errors.New("stub DNS provider does not resolve TXT records")
+	}
+	return resolver.LookupTXT(ctx, name)
+}
+
+// getACMEIssuerTemplate returns an ACME Issuer that solves the dns.k8c.io zone with dns-01 and other names with http-01
+func getACMEIssuerTemplate(server *acmetest.Server) *certsv1.Issuer {
+	return &certsv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-issuer", Namespace: "default"},
+		Spec: certsv1.IssuerSpec{
+			ACME: &certsv1.ACMEIssuer{
+				Server:              server.DirectoryURL(),
+				Email:               "admin@k8c.io",
+				PrivateKeySecretRef: certsv1.SecretRef{Name: "acme-account"},
+				CABundle:            server.TLSCertificatePEM(),
+				Solvers: []certsv1.ACMESolver{
+					{
+						Selector: &certsv1.ACMESolverSelector{DNSZones: []string{"dns.k8c.io"}},
+						DNS01:    &certsv1.ACMEDNS01Solver{Provider: "stub"},
+					},
+					{
+						HTTP01: &certsv1.ACMEHTTP01Solver{},
+					},
+				},
+			},
+		},
+	}
+}
+
+// createWebhookIssuer creates the test-issuer Issuer calling the webhook server with a client certificate from a Secret
+func createWebhookIssuer(t *testing.T, r *CertificateReconciler, server *webhooktest.Server) {
+	clientCert, clientKey, err := server.ClientCertificate("certificate-manager")
+	assert.NoError(t, err, "Client certificate should be issued")
+	clientSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook-client", Namespace: "default"},
+		Data:       map[string][]byte{"tls.crt": clientCert, "tls.key": clientKey},
+	}
+	err = r.Create(context.Background(), clientSecret)
+	assert.NoError(t, err, "Client certificate Secret should be created")
+
+	issuer := &certsv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-issuer", Namespace: "default"},
+		Spec: certsv1.IssuerSpec{
+			Webhook: &certsv1.WebhookIssuer{
+				URL:                        server.URL,
+				CABundle:                   server.TLSCertificatePEM(),
+				ClientCertificateSecretRef: &certsv1.SecretRef{Name: "webhook-client"},
+			},
+		},
+	}
+	err = r.Create(context.Background(), issuer)
+	assert.NoError(t, err, "Issuer should be created")
+}
+
+// getVaultIssuerTemplate returns the test-issuer Issuer signing with the k8c-io role of the Vault server
+func getVaultIssuerTemplate(server *vaulttest.Server, auth certsv1.VaultAuth) *certsv1.Issuer {
+	return &certsv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-issuer", Namespace: "default"},
+		Spec: certsv1.IssuerSpec{
+			Vault: &certsv1.VaultIssuer{
+				Server:   server.URL,
+				Path:     "pki/sign/k8c-io",
+				CABundle: server.TLSCertificatePEM(),
+				Auth:     auth,
 			},
 		},
 	}
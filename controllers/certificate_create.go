@@ -2,6 +2,11 @@ package controllers
 
 import (
 	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/url"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -17,35 +22,75 @@ import (
 	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
 )
 
-func (r *CertificateReconciler) handleCreate(ctx context.Context, req ctrl.Request, instance *certsv1.Certificate) (time.Duration, error) {
+// handleCreate issues the certificate when needed and returns the certificate stored in the Secret
+func (r *CertificateReconciler) handleCreate(ctx context.Context, req ctrl.Request, instance *certsv1.Certificate) (*x509.Certificate, error) {
 	log := r.Log.WithValues("certificate", req.NamespacedName)
 	log.Info("Creating/Updating Certificate")
 
+	// Hash the issuance relevant fields of the spec, the certificate is reissued when they changed
+	specHash, err := getSpecHash(&instance.Spec)
+	if err != nil {
+		log.Error(err, "Failed to hash Certificate spec")
+		return nil, err
+	}
+
 	// Check if the certificate already exists
 	log.Info("Checking if the Secret exists")
 	secret := objects.Secret(instance.Spec.SecretRef.Name, req.Namespace)
-	err := r.Get(ctx, client.ObjectKeyFromObject(secret), secret)
+	err = r.Get(ctx, client.ObjectKeyFromObject(secret), secret)
 	if err != nil && !errors.IsNotFound(err) {
 		log.Error(err, "Failed to get Secret")
-		return 0, err
+		return nil, err
+	}
+
+	// Secrets written before the spec hash was tracked are adopted when their certificate still matches the spec
+	if err == nil && secret.Annotations[constants.AnnotationSpecHash] == "" {
+		if err := r.stampSpecHash(ctx, instance, secret, specHash); err != nil {
+			log.Error(err, "Failed to stamp spec hash on Secret")
+			return nil, err
+		}
 	}
 
-	// If the secret does not exist, create it
-	if errors.IsNotFound(err) || Event == constants.EventUpdate {
-		log.Info("Secret does not exist, creating..")
-		// Generate a self-signed certificate
-		cert, key, err := r.GenerateSelfSignedCertificate(ctx, instance)
+	// If the secret does not exist, was issued for a different spec or its certificate was corrupted, create it
+	if errors.IsNotFound(err) || secret.Annotations[constants.AnnotationSpecHash] != specHash || !hasUsableCertificate(secret) {
+		log.Info("Secret does not exist, the spec changed or the certificate is unusable, issuing..")
+		// Set the status to "Issuing"
+		err := r.SetStatus(ctx, instance, constants.StatusIssuing, constants.StatusMessageIssuing, req.Namespace, nil)
 		if err != nil {
-			log.Error(err, "Failed to generate self-signed certificate")
-			return 0, err
+			log.Error(err, "Failed to set status")
+			return nil, err
+		}
+
+		// Have the configured issuer sign a certificate for a new private key
+		cert, key, err := r.issueCertificate(ctx, instance, specHash)
+		if err != nil {
+			log.Error(err, "Failed to issue certificate")
+			return nil, err
 		}
 
 		// Create the Secret object
-		secret := objects.Secret(instance.Spec.SecretRef.Name, instance.Namespace)
+		secret = objects.Secret(instance.Spec.SecretRef.Name, instance.Namespace)
 		secret.Type = corev1.SecretTypeTLS
-		secret.Data = map[string][]byte{
-			"tls.crt": cert,
-			"tls.key": key,
+		secret.Annotations = map[string]string{
+			constants.AnnotationSpecHash: specHash,
+		}
+		if err := setCertificateData(secret, cert, key); err != nil {
+			log.Error(err, "Failed to write certificate")
+			return nil, err
+		}
+		setCombinedPEM(instance, secret)
+		if _, err := r.setKeystores(ctx, instance, secret); err != nil {
+			log.Error(err, "Failed to write keystores")
+			return nil, err
+		}
+		applySecretTemplate(instance, secret)
+
+		// Set owner reference on the Secret, changes to the Secret reconcile the Certificate
+		log.Info("Setting owner reference on Secret")
+		err = controllerutil.SetOwnerReference(instance, secret, r.Scheme)
+		if err != nil {
+			log.Error(err, "Failed to set owner reference on Secret")
+			return nil, err
 		}
 
 		// Create the Secret
@@ -53,108 +98,220 @@ func (r *CertificateReconciler) handleCreate(ctx context.Context, req ctrl.Reque
 		err = r.CreateOrUpdateSecret(ctx, secret)
 		if err != nil {
 			log.Error(err, "Failed to create Secret")
-			return 0, err
+			return nil, err
 		}
 
-		// Set owner reference on the Secret
-		log.Info("Setting owner reference on Secret")
-		err = controllerutil.SetOwnerReference(instance, secret, r.Scheme)
+		if err := r.cleanUpIssuance(ctx, instance); err != nil {
+			log.Error(err, "Failed to clean up issuance")
+			return nil, err
+		}
+	} else {
+		// If secret already exists, check if the certificate is due for renewal or expired
+		log.Info("Secret exists, checking if certificate is due for renewal..")
+		certificates, err := cert.ParseCertificates(secret.Data["tls.crt"])
 		if err != nil {
-			log.Error(err, "Failed to set owner reference on Secret")
-			return 0, err
+			log.Error(err, "Failed to parse certificate")
+			return nil, err
 		}
 
-		if instance.Spec.PurgeOnDelete {
-			// Add finalizer to the Certificate
-			log.Info("PurgeOnDelete is enabled, adding finalizer to Certificate")
-			controllerutil.AddFinalizer(instance, constants.Finalizer)
-			if err := r.Update(ctx, instance); err != nil {
-				log.Error(err, "Failed to add finalizer to Certificate")
-				return 0, err
-			}
+		renewalTime, err := getRenewalTime(&instance.Spec, certificates[0])
+		if err != nil {
+			log.Error(err, "Failed to compute renewal time")
+			return nil, err
 		}
 
-		if instance.Spec.ReloadOnChange {
-			// Add Env to deployments that use this secret
-			// This will reload the deployments that are using this secret
-			if err := r.addEnvToDeployments(ctx, req, instance, secret); err != nil {
-				log.Error(err, "Failed to add env to deployments")
-				return 0, err
+		if instance.Spec.RotateOnExpiry && !time.Now().Before(renewalTime) {
+			log.Info("Certificate is due for renewal, Regenerating..")
+
+			// Set the status to "Rotating"
+			err := r.SetStatus(ctx, instance, constants.StatusRotating, constants.StatusMessageRotating, req.Namespace, nil)
+			if err != nil {
+				log.Error(err, "Failed to set status")
+				return nil, err
+			}
+
+			// Have the configured issuer sign a new certificate for a new private key
+			cert, key, err := r.issueCertificate(ctx, instance, specHash)
+			if err != nil {
+				log.Error(err, "Failed to issue certificate")
+				return nil, err
+			}
+
+			// Update the Secret with the new certificate
+			if err := setCertificateData(secret, cert, key); err != nil {
+				log.Error(err, "Failed to write certificate")
+				return nil, err
+			}
+			setCombinedPEM(instance, secret)
+			if _, err := r.setKeystores(ctx, instance, secret); err != nil {
+				log.Error(err, "Failed to write keystores")
+				return nil, err
+			}
+			applySecretTemplate(instance, secret)
+
+			// Update the Secret
+			err = r.CreateOrUpdateSecret(ctx, secret)
+			if err != nil {
+				log.Error(err, "Failed to update Secret")
+				return nil, err
+			}
+
+			if err := r.cleanUpIssuance(ctx, instance); err != nil {
+				log.Error(err, "Failed to clean up issuance")
+				return nil, err
+			}
+		} else if time.Now().After(certificates[0].NotAfter) {
+			log.Info("Certificate is expired but RotateOnExpiry is disabled")
+			// Set the status to "Expired"
+			err := r.SetStatus(ctx, instance, constants.StatusExpired, constants.StatusMessageExpired, req.Namespace, certificates[0])
+			if err != nil {
+				log.Error(err, "Failed to set status")
+				return nil, err
 			}
 		}
-	} else {
-		// If secret already exists, check if the certificate is expired or not
-		log.Info("Secret exists, checking if certificate is expired..")
-		tlsCert, ok := secret.Data["tls.crt"]
-		if !ok {
-			log.Info("Secret does not contain tls.crt key")
-			return 0, nil
-		}
-
-		if expired, err := cert.IsCertificateExpired(tlsCert); err != nil {
-			log.Error(err, "Failed to check if certificate is expired")
-			return 0, err
-		} else if expired {
-			if instance.Spec.RotateOnExpiry {
-				log.Info("Certificate is expired, Regenerating..")
-
-				// Set the status to "Rotating"
-				err := r.SetStatus(ctx, instance, constants.StatusRotating, constants.StatusMessageRotating, req.Namespace, 0)
-				if err != nil {
-					log.Error(err, "Failed to set status")
-					return 0, err
-				}
-
-				// Generate a new self-signed certificate
-				cert, key, err := r.GenerateSelfSignedCertificate(ctx, instance)
-				if err != nil {
-					log.Error(err, "Failed to generate self-signed certificate")
-					return 0, err
-				}
-
-				// Update the Secret with the new certificate
-				secret.Data["tls.crt"] = cert
-				secret.Data["tls.key"] = key
-
-				// Update the Secret
-				err = r.CreateOrUpdateSecret(ctx, secret)
-				if err != nil {
-					log.Error(err, "Failed to update Secret")
-					return 0, err
-				}
-
-				if instance.Spec.ReloadOnChange {
-					// Add Env to deployments that use this secret
-					// This will reload the deployments using this secret
-					if err := r.addEnvToDeployments(ctx, req, instance, secret); err != nil {
-						log.Error(err, "Failed to add env to deployments")
-						return 0, err
-					}
-				}
-			} else {
-				log.Info("Certificate is expired but RotateOnExpiry is disabled")
-				// Set the status to "Expired"
-				err := r.SetStatus(ctx, instance, constants.StatusExpired, constants.StatusMessageExpired, req.Namespace, 0)
-				if err != nil {
-					log.Error(err, "Failed to set status")
-					return 0, err
-				}
+
+		// The combined PEM, keystores and the secret template are kept in sync without reissuing the certificate
+		changed := setCombinedPEM(instance, secret)
+		keystoresChanged, err := r.setKeystores(ctx, instance, secret)
+		if err != nil {
+			log.Error(err, "Failed to write keystores")
+			return nil, err
+		}
+		if applySecretTemplate(instance, secret) || keystoresChanged {
+			changed = true
+		}
+
+		// Secrets created before the owner reference was persisted are adopted
+		owners := len(secret.OwnerReferences)
+		if err := controllerutil.SetOwnerReference(instance, secret, r.Scheme); err != nil {
+			log.Error(err, "Failed to set owner reference on Secret")
+			return nil, err
+		}
+		if len(secret.OwnerReferences) != owners {
+			changed = true
+		}
+		if changed {
+			log.Info("Updating combined PEM, keystores, secret template and owner reference in Secret")
+			if err := r.CreateOrUpdateSecret(ctx, secret); err != nil {
+				log.Error(err, "Failed to update Secret")
+				return nil, err
 			}
 		}
 	}
-	return utils.ParseDuration(instance.Spec.Validity)
+
+	// Copy the secret to the namespaces selected by ReplicateTo and remove the copies that are no longer selected
+	if err := r.replicateSecret(ctx, instance, secret); err != nil {
+		log.Error(err, "Failed to replicate Secret")
+		return nil, err
+	}
+
+	// Reload the workloads that use this secret with ReloadOnChange or opted in to reloads for this Certificate
+	// Workloads that already run the certificate stored in the secret are left alone
+	if err := r.reloadWorkloads(ctx, req, instance, secret); err != nil {
+		log.Error(err, "Failed to reload workloads")
+		return nil, err
+	}
+
+	// Return the certificate that is stored in the Secret
+	certificates, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	if err != nil {
+		log.Error(err, "Failed to parse certificate")
+		return nil, err
+	}
+	return certificates[0], nil
 }
 
-// generateCertificate generates a self-signed certificate for the given DNS name
-func (r *CertificateReconciler) GenerateSelfSignedCertificate(ctx context.Context, instance *certsv1.Certificate) ([]byte, []byte, error) {
-	log := r.Log.WithValues("GenerateSelfSignedCertificate", "generating self-signed certificate")
-	log.Info("Generating self-signed certificate..")
+// getKeyOptions returns the private key options for the Certificate spec
+func getKeyOptions(spec *certsv1.CertificateSpec) cert.KeyOptions {
+	if spec.PrivateKey == nil {
+		return cert.KeyOptions{}
+	}
+	return cert.KeyOptions{
+		Algorithm: spec.PrivateKey.Algorithm,
+		Size:      spec.PrivateKey.Size,
+		Encoding:  spec.PrivateKey.Encoding,
+	}
+}
 
-	validity, err := utils.ParseDuration(instance.Spec.Validity)
+// getTemplateOptions returns the certificate template options for the Certificate spec
+func getTemplateOptions(spec *certsv1.CertificateSpec) (cert.TemplateOptions, error) {
+	validity, err := utils.ParseDuration(spec.Validity)
 	if err != nil {
-		log.Error(err, "Error while parsing validity")
-		return nil, nil, err
+		return cert.TemplateOptions{}, err
+	}
+
+	opts := cert.TemplateOptions{
+		DNSNames:       getDNSNames(spec),
+		EmailAddresses: spec.EmailAddresses,
+		Validity:       validity,
+		Usages:         getUsages(spec),
+		IsCA:           spec.IsCA,
+		MaxPathLen:     spec.MaxPathLen,
+	}
+	if len(opts.DNSNames) > 0 {
+		opts.CommonName = opts.DNSNames[0]
+	}
+	if spec.Subject != nil {
+		opts.Subject = pkix.Name{
+			Organization:       spec.Subject.Organizations,
+			OrganizationalUnit: spec.Subject.OrganizationalUnits,
+			Country:            spec.Subject.Countries,
+			Locality:           spec.Subject.Localities,
+			Province:           spec.Subject.Provinces,
+			StreetAddress:      spec.Subject.StreetAddresses,
+			PostalCode:         spec.Subject.PostalCodes,
+			SerialNumber:       spec.Subject.SerialNumber,
+		}
 	}
 
-	return cert.CreateSelfSignedCertificate(instance.Spec.DNSName, validity)
+	for _, ip := range spec.IPAddresses {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return cert.TemplateOptions{}, fmt.Errorf("invalid IP address %q", ip)
+		}
+		opts.IPAddresses = append(opts.IPAddresses, parsed)
+	}
+
+	for _, uri := range spec.URIs {
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			return cert.TemplateOptions{}, err
+		}
+		opts.URIs = append(opts.URIs, parsed)
+	}
+
+	return opts, nil
+}
+
+// stampSpecHash sets the spec hash annotation on a Secret without one when its certificate matches the spec
+// Secrets without a parsable certificate or whose certificate does not match are left alone and reissued
+func (r *CertificateReconciler) stampSpecHash(ctx context.Context, instance *certsv1.Certificate, secret *corev1.Secret, specHash string) error {
+	certificates, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	if err != nil {
+		return nil
+	}
+	matches, err := certificateMatchesSpec(&instance.Spec, certificates[0])
+	if err != nil || !matches {
+		return err
+	}
+
+	r.Log.Info("Stamping spec hash on Secret whose certificate matches the spec", "certificate", instance.Name, "secret", secret.Name)
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[constants.AnnotationSpecHash] = specHash
+	return r.CreateOrUpdateSecret(ctx, secret)
+}
+
+// hasUsableCertificate reports whether the Secret holds a certificate and the private key it was issued for
+func hasUsableCertificate(secret *corev1.Secret) bool {
+	certificates, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	if err != nil {
+		return false
+	}
+	key, err := cert.ParsePrivateKey(secret.Data["tls.key"])
+	if err != nil {
+		return false
+	}
+	return cert.CertificateMatches(certificates[0], key.Public())
 }
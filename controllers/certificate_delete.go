@@ -8,6 +8,9 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
 )
 
 func (r *CertificateReconciler) handleDelete(ctx context.Context, req ctrl.Request, instance *certsv1.Certificate) error {
@@ -39,3 +42,19 @@ func (r *CertificateReconciler) handleDelete(ctx context.Context, req ctrl.Reque
 	log.Info("Secret deleted successfully")
 	return nil
 }
+
+// syncFinalizer adds the finalizer to Certificates that purge their Secret or replicate it on delete and removes it from the others
+// Replicas are always deleted with the Certificate, owner references do not work across namespaces
+func (r *CertificateReconciler) syncFinalizer(ctx context.Context, instance *certsv1.Certificate) error {
+	var changed bool
+	if instance.Spec.PurgeOnDelete || instance.Spec.ReplicateTo != nil {
+		changed = controllerutil.AddFinalizer(instance, constants.Finalizer)
+	} else {
+		changed = controllerutil.RemoveFinalizer(instance, constants.Finalizer)
+	}
+	if !changed {
+		return nil
+	}
+	r.Log.Info("Updating finalizer of Certificate", "certificate", instance.Name)
+	return r.Update(ctx, instance)
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+)
+
+// signerBuilder builds the Signer of an issuer whose resources live in the given namespace for the CertificateRequest
+type signerBuilder func(ctx context.Context, r *CertificateRequestReconciler, instance *certsv1.CertificateRequest, namespace string, spec *certsv1.IssuerSpec) (cert.Signer, error)
+
+// signerBuilders maps every issuer type to the function that builds its Signer
+// Adding a backend only requires registering it here
+var signerBuilders = map[string]signerBuilder{
+	constants.IssuerTypeSelfSigned: buildSelfSignedSigner,
+	constants.IssuerTypeCA:         buildCASigner,
+	constants.IssuerTypeACME:       buildACMESigner,
+	constants.IssuerTypeVault:      buildVaultSigner,
+	constants.IssuerTypeWebhook:    buildWebhookSigner,
+}
+
+// issuerType returns the type of the issuer configured in the spec
+func issuerType(spec *certsv1.IssuerSpec) (string, error) {
+	var configured []string
+	if spec.SelfSigned != nil {
+		configured = append(configured, constants.IssuerTypeSelfSigned)
+	}
+	if spec.CA != nil {
+		configured = append(configured, constants.IssuerTypeCA)
+	}
+	if spec.ACME != nil {
+		configured = append(configured, constants.IssuerTypeACME)
+	}
+	if spec.Vault != nil {
+		configured = append(configured, constants.IssuerTypeVault)
+	}
+	if spec.Webhook != nil {
+		configured = append(configured, constants.IssuerTypeWebhook)
+	}
+
+	if len(configured) != 1 {
+		return "", fmt.Errorf("exactly one issuer type must be configured, found %d", len(configured))
+	}
+	return configured[0], nil
+}
+
+// getSigner returns the Signer of the issuer referenced by the CertificateRequest
+// CertificateRequests without an issuer reference are self-signed
+func (r *CertificateRequestReconciler) getSigner(ctx context.Context, instance *certsv1.CertificateRequest) (cert.Signer, error) {
+	ref := instance.Spec.IssuerRef
+	if ref == nil {
+		return buildSelfSignedSigner(ctx, r, instance, instance.Namespace, nil)
+	}
+
+	var spec *certsv1.IssuerSpec
+	var namespace string
+	switch ref.Kind {
+	case constants.KindIssuer, "":
+		issuer := &certsv1.Issuer{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: instance.Namespace}, issuer); err != nil {
+			return nil, fmt.Errorf("failed to get Issuer %s: %w", ref.Name, err)
+		}
+		spec, namespace = &issuer.Spec, issuer.Namespace
+	case constants.KindClusterIssuer:
+		issuer := &certsv1.ClusterIssuer{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name}, issuer); err != nil {
+			return nil, fmt.Errorf("failed to get ClusterIssuer %s: %w", ref.Name, err)
+		}
+		spec, namespace = &issuer.Spec, r.ClusterResourceNamespace
+	default:
+		return nil, fmt.Errorf("unsupported issuer kind %q", ref.Kind)
+	}
+
+	typ, err := issuerType(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuer %s: %w", ref.Name, err)
+	}
+
+	build, ok := signerBuilders[typ]
+	if !ok {
+		return nil, fmt.Errorf("unsupported issuer type %q", typ)
+	}
+	return build(ctx, r, instance, namespace, spec)
+}
+
+// buildSelfSignedSigner builds a Signer that signs the certificate with the private key named by the CertificateRequest
+func buildSelfSignedSigner(ctx context.Context, r *CertificateRequestReconciler, instance *certsv1.CertificateRequest, _ string, _ *certsv1.IssuerSpec) (cert.Signer, error) {
+	privateKey, err := r.getRequestPrivateKey(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+	return &privateKeySigner{signer: cert.SelfSignedSigner{}, privateKey: privateKey}, nil
+}
+
+// buildCASigner builds a Signer from the CA key pair stored in the Secret referenced by the issuer
+func buildCASigner(ctx context.Context, r *CertificateRequestReconciler, _ *certsv1.CertificateRequest, namespace string, spec *certsv1.IssuerSpec) (cert.Signer, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: spec.CA.SecretName, Namespace: namespace}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get CA Secret %s/%s: %w", namespace, spec.CA.SecretName, err)
+	}
+
+	signer, err := cert.NewCASigner(secret.Data["tls.crt"], secret.Data["tls.key"], secret.Data["ca.crt"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA Secret %s/%s: %w", namespace, spec.CA.SecretName, err)
+	}
+	return signer, nil
+}
+
+// newHTTPClient returns the HTTP client of an issuer backend that verifies the TLS certificate of the server with the PEM encoded CA bundle
+// The system roots are used when the bundle is empty, the client certificates are presented to servers that ask for one
+func newHTTPClient(caBundle []byte, clientCertificates ...tls.Certificate) (*http.Client, error) {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if len(caBundle) == 0 && len(clientCertificates) == 0 {
+		return httpClient, nil
+	}
+
+	tlsConfig := &tls.Config{Certificates: clientCertificates, MinVersion: tls.VersionTLS12}
+	if len(caBundle) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, errors.New("no certificates found")
+		}
+	}
+	httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	return httpClient, nil
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/keystore"
+)
+
+// keystoreAlias is the alias of the private key and certificate in the keystores
+const keystoreAlias = "certificate"
+
+// keystoreFormat is a keystore format with the Secret keys it is written to
+type keystoreFormat struct {
+	name             string
+	keystoreKey      string
+	truststoreKey    string
+	encodeKeystore   func(privateKey crypto.Signer, chain []*x509.Certificate, alias, password string) ([]byte, error)
+	encodeTruststore func(certificates []*x509.Certificate, password string) ([]byte, error)
+	spec             func(keystores *certsv1.Keystores) *certsv1.Keystore
+}
+
+// keystoreFormats are the supported keystore formats
+var keystoreFormats = []keystoreFormat{
+	{
+		name:             "pkcs12",
+		keystoreKey:      "keystore.p12",
+		truststoreKey:    "truststore.p12",
+		encodeKeystore:   keystore.EncodePKCS12,
+		encodeTruststore: keystore.EncodePKCS12TrustStore,
+		spec:             func(keystores *certsv1.Keystores) *certsv1.Keystore { return keystores.PKCS12 },
+	},
+	{
+		name:             "jks",
+		keystoreKey:      "keystore.jks",
+		truststoreKey:    "truststore.jks",
+		encodeKeystore:   keystore.EncodeJKS,
+		encodeTruststore: keystore.EncodeJKSTrustStore,
+		spec:             func(keystores *certsv1.Keystores) *certsv1.Keystore { return keystores.JKS },
+	},
+}
+
+// setKeystores writes the keystores configured by the Certificate to the data of the Secret and removes the others
+// Keystores are only regenerated when the certificate, the private key, the CA or a password changed, it reports whether the data changed
+func (r *CertificateReconciler) setKeystores(ctx context.Context, instance *certsv1.Certificate, secret *corev1.Secret) (bool, error) {
+	// The hash covers everything the keystores are built from, so it changes when they have to be regenerated
+	hash := sha256.New()
+	for _, key := range []string{"tls.crt", "tls.key", "ca.crt"} {
+		hash.Write(secret.Data[key])
+		hash.Write([]byte{0})
+	}
+
+	passwords := map[string]string{}
+	upToDate := true
+	for _, format := range keystoreFormats {
+		expected := map[string]bool{}
+		if instance.Spec.Keystores != nil && format.spec(instance.Spec.Keystores) != nil {
+			password, err := r.getKeystorePassword(ctx, instance.Namespace, format.spec(instance.Spec.Keystores))
+			if err != nil {
+				return false, err
+			}
+			passwords[format.name] = password
+			hash.Write([]byte(format.name))
+			hash.Write([]byte{0})
+			hash.Write([]byte(password))
+			hash.Write([]byte{0})
+
+			expected[format.keystoreKey] = true
+			expected[format.truststoreKey] = len(secret.Data["ca.crt"]) > 0
+		}
+
+		for _, key := range []string{format.keystoreKey, format.truststoreKey} {
+			if _, ok := secret.Data[key]; ok != expected[key] {
+				upToDate = false
+			}
+		}
+	}
+
+	keystoreHash := hex.EncodeToString(hash.Sum(nil))
+	if upToDate && (len(passwords) == 0 || secret.Annotations[constants.AnnotationKeystoreHash] == keystoreHash) {
+		return false, nil
+	}
+
+	for _, format := range keystoreFormats {
+		delete(secret.Data, format.keystoreKey)
+		delete(secret.Data, format.truststoreKey)
+	}
+	if len(passwords) == 0 {
+		return true, nil
+	}
+
+	privateKey, err := cert.ParsePrivateKey(secret.Data["tls.key"])
+	if err != nil {
+		return false, fmt.Errorf("failed to parse private key for keystores: %w", err)
+	}
+	chain, err := cert.ParseCertificates(secret.Data["tls.crt"])
+	if err != nil {
+		return false, fmt.Errorf("failed to parse certificate for keystores: %w", err)
+	}
+	var cas []*x509.Certificate
+	if len(secret.Data["ca.crt"]) > 0 {
+		if cas, err = cert.ParseCertificates(secret.Data["ca.crt"]); err != nil {
+			return false, fmt.Errorf("failed to parse CA certificate for keystores: %w", err)
+		}
+	}
+
+	for _, format := range keystoreFormats {
+		password, ok := passwords[format.name]
+		if !ok {
+			continue
+		}
+
+		data, err := format.encodeKeystore(privateKey, chain, keystoreAlias, password)
+		if err != nil {
+			return false, fmt.Errorf("failed to encode %s keystore: %w", format.name, err)
+		}
+		secret.Data[format.keystoreKey] = data
+
+		if len(cas) > 0 {
+			data, err := format.encodeTruststore(cas, password)
+			if err != nil {
+				return false, fmt.Errorf("failed to encode %s truststore: %w", format.name, err)
+			}
+			secret.Data[format.truststoreKey] = data
+		}
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[constants.AnnotationKeystoreHash] = keystoreHash
+	return true, nil
+}
+
+// getKeystorePassword returns the password of the keystore from the Secret it references
+func (r *CertificateReconciler) getKeystorePassword(ctx context.Context, namespace string, spec *certsv1.Keystore) (string, error) {
+	ref := spec.PasswordSecretRef
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+		return "", fmt.Errorf("failed to get keystore password Secret %s/%s: %w", namespace, ref.Name, err)
+	}
+	password := string(secret.Data[ref.Key])
+	if password == "" {
+		return "", fmt.Errorf("keystore password Secret %s/%s has no %s key", namespace, ref.Name, ref.Key)
+	}
+	return password, nil
+}
+
+// usesKeystorePasswordSecret reports whether a keystore of the Certificate takes its password from the named Secret
+func usesKeystorePasswordSecret(spec *certsv1.CertificateSpec, name string) bool {
+	if spec.Keystores == nil {
+		return false
+	}
+	for _, format := range keystoreFormats {
+		if keystoreSpec := format.spec(spec.Keystores); keystoreSpec != nil && keystoreSpec.PasswordSecretRef.Name == name {
+			return true
+		}
+	}
+	return false
+}
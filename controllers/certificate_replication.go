@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/objects"
+)
+
+// errReplicaConflict is returned for Secrets in a target namespace that are not a replica of the Certificate
+// Retrying does not help, the conflict is only recorded in the status
+var errReplicaConflict = errors.New("a Secret of the same name that is not a replica of the Certificate already exists")
+
+// replicaChangedPredicate passes every change to a replica, Secrets have no generation that changes with their data
+var replicaChangedPredicate = predicate.And(predicate.ResourceVersionChangedPredicate{}, predicate.NewPredicateFuncs(func(object client.Object) bool {
+	_, ok := object.GetLabels()[constants.LabelCertificateName]
+	return ok
+}))
+
+// replicateSecret writes copies of the Secret to the namespaces selected by ReplicateTo
+// Copies that were changed by others are overwritten, copies in namespaces that are no longer selected are removed
+// The state of every copy is recorded in the status of the Certificate instance
+func (r *CertificateReconciler) replicateSecret(ctx context.Context, instance *certsv1.Certificate, secret *corev1.Secret) error {
+	log := r.Log.WithValues("replicateSecret", instance.ObjectMeta.Name)
+
+	namespaces, err := r.getReplicaNamespaces(ctx, instance)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	var replicas []certsv1.SecretReplicaStatus
+	for _, namespace := range namespaces {
+		replica := certsv1.SecretReplicaStatus{Namespace: namespace, Synced: true}
+		if err := r.syncReplica(ctx, instance, secret, namespace); err != nil {
+			log.Error(err, "Failed to replicate Secret", "namespace", namespace)
+			replica.Synced = false
+			replica.Message = err.Error()
+			if !errors.Is(err, errReplicaConflict) {
+				errs = append(errs, err)
+			}
+		}
+		replicas = append(replicas, replica)
+	}
+
+	if err := r.deleteReplicas(ctx, instance, secret.Name, namespaces); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.setReplicaStatus(ctx, instance, replicas); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// getReplicaNamespaces returns the active namespaces selected by ReplicateTo in sorted order
+// Listed namespaces that do not exist yet are picked up once they are created
+func (r *CertificateReconciler) getReplicaNamespaces(ctx context.Context, instance *certsv1.Certificate) ([]string, error) {
+	replication := instance.Spec.ReplicateTo
+	if replication == nil {
+		return nil, nil
+	}
+
+	listed := map[string]bool{}
+	for _, namespace := range replication.Namespaces {
+		listed[namespace] = true
+	}
+	selector := labels.Nothing()
+	if replication.NamespaceSelector != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(replication.NamespaceSelector); err != nil {
+			return nil, err
+		}
+	}
+
+	namespaceList := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaceList); err != nil {
+		return nil, err
+	}
+	var namespaces []string
+	for _, namespace := range namespaceList.Items {
+		if namespace.Name == instance.Namespace || namespace.Status.Phase == corev1.NamespaceTerminating || namespace.DeletionTimestamp != nil {
+			continue
+		}
+		if listed[namespace.Name] || selector.Matches(labels.Set(namespace.Labels)) {
+			namespaces = append(namespaces, namespace.Name)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// syncReplica writes the data of the Secret to its copy in the namespace
+func (r *CertificateReconciler) syncReplica(ctx context.Context, instance *certsv1.Certificate, secret *corev1.Secret, namespace string) error {
+	replica := objects.Secret(secret.Name, namespace)
+	err := r.Get(ctx, client.ObjectKeyFromObject(replica), replica)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	if found && !isReplicaOf(replica, instance) {
+		return errReplicaConflict
+	}
+	if found && replica.Type == secret.Type && equality.Semantic.DeepEqual(replica.Data, secret.Data) {
+		return nil
+	}
+
+	// The type of a Secret is immutable, a replica of a different type is recreated
+	if found && replica.Type != secret.Type {
+		r.Log.Info("Recreating Secret replica of a different type", "certificate", instance.Name, "namespace", namespace)
+		if err := r.Delete(ctx, replica); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		replica = objects.Secret(secret.Name, namespace)
+		found = false
+	}
+
+	replica.Type = secret.Type
+	replica.Data = secret.Data
+	if replica.Labels == nil {
+		replica.Labels = map[string]string{}
+	}
+	replica.Labels[constants.LabelCertificateName] = instance.Name
+	replica.Labels[constants.LabelReplicaSourceNamespace] = instance.Namespace
+
+	if !found {
+		r.Log.Info("Creating Secret replica", "certificate", instance.Name, "namespace", namespace)
+		return r.Create(ctx, replica)
+	}
+	r.Log.Info("Updating Secret replica", "certificate", instance.Name, "namespace", namespace)
+	return r.Update(ctx, replica)
+}
+
+// deleteReplicas deletes the copies of the Secret that are not in one of the namespaces or are named differently
+func (r *CertificateReconciler) deleteReplicas(ctx context.Context, instance *certsv1.Certificate, secretName string, namespaces []string) error {
+	selected := map[string]bool{}
+	for _, namespace := range namespaces {
+		selected[namespace] = true
+	}
+
+	replicas := &corev1.SecretList{}
+	if err := r.List(ctx, replicas, client.MatchingLabels{
+		constants.LabelCertificateName:        instance.Name,
+		constants.LabelReplicaSourceNamespace: instance.Namespace,
+	}); err != nil {
+		return err
+	}
+	var errs []error
+	for i := range replicas.Items {
+		replica := &replicas.Items[i]
+		if selected[replica.Namespace] && replica.Name == secretName {
+			continue
+		}
+		r.Log.Info("Deleting Secret replica", "certificate", instance.Name, "namespace", replica.Namespace, "secret", replica.Name)
+		if err := r.Delete(ctx, replica); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete Secret replica %s/%s: %w", replica.Namespace, replica.Name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// setReplicaStatus records the state of the copies of the Secret in the status of the Certificate instance
+func (r *CertificateReconciler) setReplicaStatus(ctx context.Context, instance *certsv1.Certificate, replicas []certsv1.SecretReplicaStatus) error {
+	if equality.Semantic.DeepEqual(instance.Status.Replicas, replicas) {
+		return nil
+	}
+
+	patchBase := client.MergeFrom(instance.DeepCopy())
+	instance.Status.Replicas = replicas
+	return r.Status().Patch(ctx, instance, patchBase)
+}
+
+// isReplicaOf reports whether the Secret is a copy of the Secret of the Certificate
+func isReplicaOf(secret *corev1.Secret, instance *certsv1.Certificate) bool {
+	return secret.Labels[constants.LabelCertificateName] == instance.Name &&
+		secret.Labels[constants.LabelReplicaSourceNamespace] == instance.Namespace
+}
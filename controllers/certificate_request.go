@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/objects"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+)
+
+// errCertificateRequestConflict is returned when the CertificateRequest of a revision exists but is not controlled by the Certificate
+// Such a request was created by someone else, it is never approved or used and never deleted
+var errCertificateRequestConflict = stderrors.New("CertificateRequest is not controlled by the Certificate")
+
+// certificateRequestName returns the name of the CertificateRequest of the revision of the Certificate
+func certificateRequestName(instance *certsv1.Certificate, revision int) string {
+	return fmt.Sprintf("%s-%d", instance.Name, revision)
+}
+
+// nextPrivateKeySecretName returns the name of the Secret holding the private key while its certificate is being signed
+func nextPrivateKeySecretName(instance *certsv1.Certificate) string {
+	return instance.Name + "-next-private-key"
+}
+
+// issueCertificate has the issuer of the Certificate sign a certificate for a new private key through a CertificateRequest
+// It returns cert.ErrIssuancePending until the CertificateRequest is signed, then the signed certificate and the PEM encoded private key
+func (r *CertificateReconciler) issueCertificate(ctx context.Context, instance *certsv1.Certificate, specHash string) (*cert.SignedCertificate, []byte, error) {
+	log := r.Log.WithValues("certificate", types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace})
+	revision := instance.Status.Revision + 1
+
+	request := &certsv1.CertificateRequest{}
+	err := r.Get(ctx, types.NamespacedName{Name: certificateRequestName(instance, revision), Namespace: instance.Namespace}, request)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, nil, err
+	}
+	found := err == nil
+	if found && !metav1.IsControlledBy(request, instance) {
+		return nil, nil, fmt.Errorf("%w: %s", errCertificateRequestConflict, request.Name)
+	}
+
+	keySecret := objects.Secret(nextPrivateKeySecretName(instance), instance.Namespace)
+	err = r.Get(ctx, client.ObjectKeyFromObject(keySecret), keySecret)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, nil, err
+	}
+	keyFound := err == nil
+
+	// A request for an outdated spec or whose private key is gone can never complete the issuance, replace it
+	if found && (request.Annotations[constants.AnnotationSpecHash] != specHash || !keyFound) {
+		log.Info("Replacing outdated CertificateRequest", "certificaterequest", request.Name)
+		if err := r.Delete(ctx, request, client.Preconditions{UID: &request.UID}); err != nil && !errors.IsNotFound(err) {
+			return nil, nil, err
+		}
+		found = false
+	}
+
+	if !found {
+		if err := r.createCertificateRequest(ctx, instance, revision, specHash); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, cert.ErrIssuancePending
+	}
+
+	readyCondition := meta.FindStatusCondition(request.Status.Conditions, constants.ConditionReady)
+	switch {
+	case meta.IsStatusConditionTrue(request.Status.Conditions, constants.ConditionDenied):
+		return nil, nil, fmt.Errorf("CertificateRequest %s was denied", request.Name)
+	case !meta.IsStatusConditionTrue(request.Status.Conditions, constants.ConditionApproved):
+		// An earlier reconcile stopped before approving the request
+		if err := r.approveCertificateRequest(ctx, request); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, cert.ErrIssuancePending
+	case readyCondition == nil || readyCondition.Status != metav1.ConditionTrue:
+		if readyCondition != nil && (readyCondition.Reason == constants.ReasonFailed || readyCondition.Reason == constants.ReasonInvalidRequest) {
+			return nil, nil, fmt.Errorf("CertificateRequest %s failed: %s", request.Name, readyCondition.Message)
+		}
+		return nil, nil, cert.ErrIssuancePending
+	}
+
+	// The signed certificate must belong to the private key that is kept for it
+	privateKey, err := cert.ParsePrivateKey(keySecret.Data["tls.key"])
+	if err != nil {
+		return nil, nil, err
+	}
+	certificates, err := cert.ParseCertificates(request.Status.Certificate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CertificateRequest %s holds an invalid certificate: %w", request.Name, err)
+	}
+	if !cert.KeyMatches(privateKey, certificates[0].PublicKey) {
+		return nil, nil, fmt.Errorf("the certificate of CertificateRequest %s does not match the private key", request.Name)
+	}
+
+	// Record the revision first, so the next issuance never picks up this request again
+	patchBase := client.MergeFrom(instance.DeepCopy())
+	instance.Status.Revision = revision
+	instance.Status.CertificateRequest = request.Name
+	if err := r.Status().Patch(ctx, instance, patchBase); err != nil {
+		return nil, nil, err
+	}
+
+	return &cert.SignedCertificate{
+		Certificate: request.Status.Certificate,
+		CA:          request.Status.CA,
+	}, keySecret.Data["tls.key"], nil
+}
+
+// createCertificateRequest generates a new private key and requests a certificate for it from the issuer of the Certificate
+// The private key is kept in a Secret of its own until the certificate is signed, it is never part of the request
+func (r *CertificateReconciler) createCertificateRequest(ctx context.Context, instance *certsv1.Certificate, revision int, specHash string) error {
+	log := r.Log.WithValues("certificate", types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace})
+
+	opts, err := getTemplateOptions(&instance.Spec)
+	if err != nil {
+		return err
+	}
+	keyOpts := getKeyOptions(&instance.Spec)
+	privateKey, err := cert.GeneratePrivateKey(keyOpts.Algorithm, keyOpts.Size)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := cert.EncodePrivateKey(privateKey, keyOpts.Encoding)
+	if err != nil {
+		return err
+	}
+	csrPEM, err := cert.CreateCertificateRequest(privateKey, opts)
+	if err != nil {
+		return err
+	}
+
+	request := &certsv1.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      certificateRequestName(instance, revision),
+			Namespace: instance.Namespace,
+			Labels: map[string]string{
+				constants.LabelCertificateName: instance.Name,
+			},
+			Annotations: map[string]string{
+				constants.AnnotationSpecHash:             specHash,
+				constants.AnnotationCertificateRevision:  strconv.Itoa(revision),
+				constants.AnnotationPrivateKeySecretName: nextPrivateKeySecretName(instance),
+			},
+		},
+		Spec: certsv1.CertificateRequestSpec{
+			Request:    csrPEM,
+			IssuerRef:  instance.Spec.IssuerRef.DeepCopy(),
+			Duration:   instance.Spec.Validity,
+			Usages:     instance.Spec.Usages,
+			IsCA:       instance.Spec.IsCA,
+			MaxPathLen: instance.Spec.MaxPathLen,
+		},
+	}
+	if err := controllerutil.SetControllerReference(instance, request, r.Scheme); err != nil {
+		return err
+	}
+
+	// A request that already exists was created by an earlier reconcile, its private key is kept
+	log.Info("Creating CertificateRequest", "certificaterequest", request.Name)
+	if err := r.Create(ctx, request); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	}
+
+	keySecret := objects.Secret(nextPrivateKeySecretName(instance), instance.Namespace)
+	keySecret.Data = map[string][]byte{"tls.key": keyPEM}
+	if err := controllerutil.SetControllerReference(instance, keySecret, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.CreateOrUpdateSecret(ctx, keySecret); err != nil {
+		return err
+	}
+
+	return r.approveCertificateRequest(ctx, request)
+}
+
+// approveCertificateRequest approves a CertificateRequest of the Certificate
+// Requests of a Certificate are approved by the Certificate controller, which owns their private key
+func (r *CertificateReconciler) approveCertificateRequest(ctx context.Context, request *certsv1.CertificateRequest) error {
+	patchBase := client.MergeFrom(request.DeepCopy())
+	setRequestCondition(request, constants.ConditionApproved, metav1.ConditionTrue, constants.ReasonApproved, "Approved by the Certificate controller")
+	return r.Status().Patch(ctx, request, patchBase)
+}
+
+// cleanUpIssuance removes the private key Secret and the CertificateRequests of earlier revisions once a certificate is stored
+// Only the CertificateRequest of the latest issuance is kept
+func (r *CertificateReconciler) cleanUpIssuance(ctx context.Context, instance *certsv1.Certificate) error {
+	keySecret := objects.Secret(nextPrivateKeySecretName(instance), instance.Namespace)
+	if err := r.Delete(ctx, keySecret); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	requests := &certsv1.CertificateRequestList{}
+	if err := r.List(ctx, requests, client.InNamespace(instance.Namespace), client.MatchingLabels{constants.LabelCertificateName: instance.Name}); err != nil {
+		return err
+	}
+	for i := range requests.Items {
+		request := &requests.Items[i]
+		revision, err := strconv.Atoi(request.Annotations[constants.AnnotationCertificateRevision])
+		if err != nil || revision >= instance.Status.Revision || !metav1.IsControlledBy(request, instance) {
+			continue
+		}
+		if err := r.Delete(ctx, request); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+)
+
+// combinedPEMKey is the Secret key of the private key followed by the certificate chain
+const combinedPEMKey = "tls-combined.pem"
+
+// setCertificateData writes the issued certificate chain, its private key and the CA certificate to the data of the Secret
+// Issuers that do not return their CA, such as ACME servers, get the top of the chain in ca.crt
+func setCertificateData(secret *corev1.Secret, signed *cert.SignedCertificate, key []byte) error {
+	ca := signed.CA
+	if len(bytes.TrimSpace(ca)) == 0 {
+		var err error
+		if ca, err = cert.ChainCA(signed.Certificate); err != nil {
+			return fmt.Errorf("failed to parse issued certificate chain: %w", err)
+		}
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data["tls.crt"] = signed.Certificate
+	secret.Data["tls.key"] = key
+	if len(ca) > 0 {
+		secret.Data["ca.crt"] = ca
+	} else {
+		delete(secret.Data, "ca.crt")
+	}
+	return nil
+}
+
+// setCombinedPEM writes the private key followed by the certificate chain to tls-combined.pem when CombinedPEM is enabled
+// and removes it otherwise, it reports whether the data changed
+func setCombinedPEM(instance *certsv1.Certificate, secret *corev1.Secret) bool {
+	existing, ok := secret.Data[combinedPEMKey]
+	if !instance.Spec.CombinedPEM {
+		delete(secret.Data, combinedPEMKey)
+		return ok
+	}
+
+	combined := append(append([]byte{}, secret.Data["tls.key"]...), secret.Data["tls.crt"]...)
+	if ok && bytes.Equal(existing, combined) {
+		return false
+	}
+	secret.Data[combinedPEMKey] = combined
+	return true
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+)
+
+// managedMetadata lists the labels, annotations and key aliases the secret template of a Certificate set on its Secret
+// It is stored in an annotation of the Secret, so entries removed from the template can be removed without touching
+// the labels and annotations that other controllers added
+type managedMetadata struct {
+	Labels      []string `json:"labels,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+	Keys        []string `json:"keys,omitempty"`
+}
+
+// getManagedMetadata returns the metadata the secret template set on the Secret before
+func getManagedMetadata(secret *corev1.Secret) managedMetadata {
+	managed := managedMetadata{}
+	if value, ok := secret.Annotations[constants.AnnotationSecretTemplate]; ok {
+		// An invalid annotation is treated as empty, its entries are left alone
+		_ = json.Unmarshal([]byte(value), &managed)
+	}
+	return managed
+}
+
+// applySecretTemplate sets the labels, annotations and key aliases of the secret template on the Secret
+// Entries the template set before but no longer contains are removed, it reports whether the Secret changed
+func applySecretTemplate(instance *certsv1.Certificate, secret *corev1.Secret) bool {
+	template := instance.Spec.SecretTemplate
+	if template == nil {
+		template = &certsv1.SecretTemplate{}
+	}
+	before := secret.DeepCopy()
+	previous := getManagedMetadata(secret)
+
+	secret.Labels = applyMetadata(secret.Labels, template.Labels, previous.Labels)
+	secret.Annotations = applyMetadata(secret.Annotations, template.Annotations, previous.Annotations)
+
+	for _, key := range previous.Keys {
+		if _, ok := template.KeyAliases[key]; !ok {
+			delete(secret.Data, key)
+		}
+	}
+	for alias, source := range template.KeyAliases {
+		if value, ok := secret.Data[source]; ok {
+			secret.Data[alias] = value
+		} else {
+			delete(secret.Data, alias)
+		}
+	}
+
+	managed := managedMetadata{
+		Labels:      sortedKeys(template.Labels),
+		Annotations: sortedKeys(template.Annotations),
+		Keys:        sortedKeys(template.KeyAliases),
+	}
+	if reflect.DeepEqual(managed, managedMetadata{}) {
+		delete(secret.Annotations, constants.AnnotationSecretTemplate)
+	} else {
+		value, _ := json.Marshal(managed)
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[constants.AnnotationSecretTemplate] = string(value)
+	}
+
+	return !reflect.DeepEqual(before.Labels, secret.Labels) ||
+		!reflect.DeepEqual(before.Annotations, secret.Annotations) ||
+		!reflect.DeepEqual(before.Data, secret.Data)
+}
+
+// applyMetadata removes the previously managed keys from the labels or annotations and sets the desired ones
+func applyMetadata(metadata, desired map[string]string, previous []string) map[string]string {
+	for _, key := range previous {
+		if _, ok := desired[key]; !ok {
+			delete(metadata, key)
+		}
+	}
+	if len(desired) > 0 && metadata == nil {
+		metadata = map[string]string{}
+	}
+	for key, value := range desired {
+		metadata[key] = value
+	}
+	return metadata
+}
+
+// removeUnmanagedMetadata removes the labels and annotations from the existing Secret that its secret template
+// managed before, but that are no longer managed by the updated Secret
+func removeUnmanagedMetadata(existing, updated *corev1.Secret) {
+	previous := getManagedMetadata(existing)
+	for _, key := range previous.Labels {
+		if _, ok := updated.Labels[key]; !ok {
+			delete(existing.Labels, key)
+		}
+	}
+	for _, key := range previous.Annotations {
+		if _, ok := updated.Annotations[key]; !ok {
+			delete(existing.Annotations, key)
+		}
+	}
+	if _, ok := updated.Annotations[constants.AnnotationSecretTemplate]; !ok {
+		delete(existing.Annotations, constants.AnnotationSecretTemplate)
+	}
+}
+
+// sortedKeys returns the keys of the map in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return nil
+	}
+	return keys
+}
@@ -2,130 +2,317 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
 	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
 )
 
-// Event is a global variable to store the event type
-var Event string
+// SetStatus sets the status of the Certificate instance
+// The certificate details are taken from the given certificate stored in the Secret, they are left unchanged when it is nil
+func (r *CertificateReconciler) SetStatus(ctx context.Context, instance *certsv1.Certificate, status string, message string, deployedNamespace string, certificate *x509.Certificate) error {
+	log := r.Log.WithValues("SetStatus", instance.ObjectMeta.Name)
+	log.Info("Setting status to " + status)
 
-// getDeploymentsWithMountedSecret returns a list of Deployments that have the secret mounted
-func (r *CertificateReconciler) getDeploymentsWithMountedSecret(ctx context.Context, req ctrl.Request, instance *certsv1.Certificate) ([]appsv1.Deployment, error) {
-	log := r.Log.WithValues("getDeploymentsWithMountedSecret", instance.ObjectMeta.Name)
-	log.Info("Getting deployments with mounted secret")
+	patchBase := client.MergeFrom(instance.DeepCopy())
+	instance.Status.Status = status
+	instance.Status.Message = message
+	instance.Status.DeployedNamespace = deployedNamespace
+	if certificate != nil {
+		setCertificateDetails(instance, certificate)
+	}
+	instance.Status.ObservedGeneration = instance.Generation
+	setConditions(instance, status, message)
+	if certificate != nil {
+		setExpiringCondition(instance, certificate)
+	}
+	if err := r.Status().Patch(ctx, instance, patchBase); err != nil {
+		log.Error(err, "Failed to patch Certificate status")
+		return err
+	}
 
-	deployments := &appsv1.DeploymentList{}
-	err := r.List(ctx, deployments, client.InNamespace(req.Namespace))
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+// setCertificateDetails records the details of the certificate stored in the Secret in the status of the Certificate instance
+func setCertificateDetails(instance *certsv1.Certificate, certificate *x509.Certificate) {
+	notBefore := metav1.NewTime(certificate.NotBefore)
+	notAfter := metav1.NewTime(certificate.NotAfter)
+	instance.Status.ExpiryDate = notAfter
+	instance.Status.NotBefore = &notBefore
+	instance.Status.NotAfter = &notAfter
+	instance.Status.SerialNumber = cert.SerialNumber(certificate)
+	instance.Status.Fingerprint = cert.Fingerprint(certificate)
+	instance.Status.Issuer = certificate.Issuer.String()
+	instance.Status.SubjectAlternativeNames = cert.SubjectAlternativeNames(certificate)
+	instance.Status.KeyAlgorithm, instance.Status.KeySize = cert.KeyAlgorithm(certificate)
+}
+
+// setConditions maps the status of the Certificate instance to its Ready, Issuing and Expired conditions
+// meta.SetStatusCondition keeps the lastTransitionTime of conditions whose status did not change
+func setConditions(instance *certsv1.Certificate, status string, message string) {
+	setCondition := func(conditionType string, conditionStatus metav1.ConditionStatus, reason string) {
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:               conditionType,
+			Status:             conditionStatus,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: instance.Generation,
+		})
 	}
 
-	var deploymentsWithMountedSecret []appsv1.Deployment
-	for _, deployment := range deployments.Items {
-		for _, volume := range deployment.Spec.Template.Spec.Volumes {
-			if volume.Secret != nil && volume.Secret.SecretName == instance.Spec.SecretRef.Name {
-				deploymentsWithMountedSecret = append(deploymentsWithMountedSecret, deployment)
-				break
-			}
-		}
+	switch status {
+	case constants.StatusIssuing:
+		setCondition(constants.ConditionIssuing, metav1.ConditionTrue, constants.ReasonIssuing)
+	case constants.StatusRotating:
+		setCondition(constants.ConditionIssuing, metav1.ConditionTrue, constants.ReasonRenewing)
+	case constants.StatusDeployed:
+		setCondition(constants.ConditionReady, metav1.ConditionTrue, constants.ReasonIssued)
+		setCondition(constants.ConditionIssuing, metav1.ConditionFalse, constants.ReasonIssued)
+		setCondition(constants.ConditionExpired, metav1.ConditionFalse, constants.ReasonValid)
+	case constants.StatusExpired:
+		setCondition(constants.ConditionReady, metav1.ConditionFalse, constants.ReasonExpired)
+		setCondition(constants.ConditionIssuing, metav1.ConditionFalse, constants.ReasonExpired)
+		setCondition(constants.ConditionExpired, metav1.ConditionTrue, constants.ReasonExpired)
+	case constants.StatusInvalid:
+		setCondition(constants.ConditionReady, metav1.ConditionFalse, constants.ReasonInvalidSpec)
+		setCondition(constants.ConditionIssuing, metav1.ConditionFalse, constants.ReasonInvalidSpec)
+	case constants.StatusFailed:
+		setCondition(constants.ConditionReady, metav1.ConditionFalse, constants.ReasonFailed)
+		setCondition(constants.ConditionIssuing, metav1.ConditionFalse, constants.ReasonFailed)
+	case constants.StatusConflict:
+		setCondition(constants.ConditionReady, metav1.ConditionFalse, constants.ReasonConflict)
+		setCondition(constants.ConditionIssuing, metav1.ConditionFalse, constants.ReasonConflict)
+	case constants.StatusDeleting:
+		setCondition(constants.ConditionReady, metav1.ConditionFalse, constants.ReasonDeleting)
+	}
+}
+
+// setExpiringCondition sets the Expiring condition of the Certificate instance from the renewal time of the certificate
+// It is true from the renewal time until the certificate expires, certificates that are not rotated stay in that window
+func setExpiringCondition(instance *certsv1.Certificate, certificate *x509.Certificate) {
+	renewalTime, err := getRenewalTime(&instance.Spec, certificate)
+	if err != nil {
+		return
 	}
 
-	return deploymentsWithMountedSecret, nil
+	condition := metav1.Condition{
+		Type:               constants.ConditionExpiring,
+		Status:             metav1.ConditionFalse,
+		Reason:             constants.ReasonValid,
+		Message:            fmt.Sprintf("Certificate is due for renewal at %s", renewalTime.UTC().Format(time.RFC3339)),
+		ObservedGeneration: instance.Generation,
+	}
+	now := time.Now()
+	if now.After(certificate.NotAfter) {
+		condition.Reason = constants.ReasonExpired
+		condition.Message = constants.StatusMessageExpired
+	} else if !now.Before(renewalTime) {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = constants.ReasonExpiring
+		condition.Message = fmt.Sprintf("Certificate expires at %s", certificate.NotAfter.UTC().Format(time.RFC3339))
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
 }
 
-// addEnvToDeployments adds an ENV to all deployments that use the secret and updates the deployment
-func (r *CertificateReconciler) addEnvToDeployments(ctx context.Context, req ctrl.Request, instance *certsv1.Certificate, secret *corev1.Secret) error {
-	log := r.Log.WithValues("addENVToDeployments", instance.ObjectMeta.Name)
-	log.Info("ReloadOnChange is enabled, adding ENV to deployments")
+// CreateOrUpdateSecret creates or updates the Secret object
+func (r *CertificateReconciler) CreateOrUpdateSecret(ctx context.Context, secret *corev1.Secret) error {
 
-	deployments, err := r.getDeploymentsWithMountedSecret(ctx, req, instance)
-	if err != nil {
+	// Check if the secret already exists, fetching into a separate object so the new data is kept
+	existing := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(secret), existing)
+	if err != nil && !errors.IsNotFound(err) {
 		return err
 	}
 
-	for _, deployment := range deployments {
-		// Update the deployment
-		deploymentCopy := deployment.DeepCopy() // Copy the deployment to avoid modifying the original
-		for i, container := range deploymentCopy.Spec.Template.Spec.Containers {
-			// 	// Adding ResourceVersion helps identify if the secret has been updated and the deployment needs to be reloaded
-			var found bool
-			for j, env := range container.Env {
-				if env.Name == constants.CertificateENVName {
-					// update the value of the env
-					deploymentCopy.Spec.Template.Spec.Containers[i].Env[j].Value = secret.ResourceVersion
-					found = true
-					break
-				}
-			}
-			if !found {
-				deploymentCopy.Spec.Template.Spec.Containers[i].Env = append(container.Env, corev1.EnvVar{
-					Name:  constants.CertificateENVName,
-					Value: secret.ResourceVersion,
-				})
-			}
+	// If the secret does not exist, create it
+	if errors.IsNotFound(err) {
+		return r.Create(ctx, secret)
+	}
+
+	// Otherwise, update the data, labels and annotations of the existing secret
+	// Labels and annotations added by others are kept, only those the secret template no longer sets are removed
+	removeUnmanagedMetadata(existing, secret)
+	existing.Data = secret.Data
+	for key, value := range secret.Labels {
+		if existing.Labels == nil {
+			existing.Labels = map[string]string{}
+		}
+		existing.Labels[key] = value
+	}
+	for key, value := range secret.Annotations {
+		if existing.Annotations == nil {
+			existing.Annotations = map[string]string{}
 		}
+		existing.Annotations[key] = value
+	}
+	for _, owner := range secret.OwnerReferences {
+		existing.OwnerReferences = upsertOwnerReference(existing.OwnerReferences, owner)
+	}
+	if err := r.Update(ctx, existing); err != nil {
+		return err
+	}
+	existing.DeepCopyInto(secret)
+	return nil
+}
 
-		// Patch the deployment
-		if err := r.Patch(ctx, deploymentCopy, client.MergeFrom(&deployment)); err != nil {
-			return err
+// upsertOwnerReference adds the owner reference or replaces the reference to the same owner
+func upsertOwnerReference(owners []metav1.OwnerReference, owner metav1.OwnerReference) []metav1.OwnerReference {
+	for i := range owners {
+		if owners[i].UID == owner.UID {
+			owners[i] = owner
+			return owners
 		}
+	}
+	return append(owners, owner)
+}
+
+// issuanceSpec holds the fields of the Certificate spec that the issued certificate depends on
+type issuanceSpec struct {
+	DNSNames       []string            `json:"dnsNames,omitempty"`
+	IPAddresses    []string            `json:"ipAddresses,omitempty"`
+	URIs           []string            `json:"uris,omitempty"`
+	EmailAddresses []string            `json:"emailAddresses,omitempty"`
+	Validity       string              `json:"validity"`
+	Subject        *certsv1.Subject    `json:"subject,omitempty"`
+	PrivateKey     *certsv1.PrivateKey `json:"privateKey,omitempty"`
+	IssuerRef      *certsv1.IssuerRef  `json:"issuerRef,omitempty"`
+	Usages         []certsv1.KeyUsage  `json:"usages,omitempty"`
+	IsCA           bool                `json:"isCA,omitempty"`
+	MaxPathLen     *int                `json:"maxPathLen,omitempty"`
+}
 
+// getSpecHash returns a hash of the fields of the Certificate spec that the issued certificate depends on
+// A certificate is reissued when the hash differs from the one stored on its Secret
+func getSpecHash(spec *certsv1.CertificateSpec) (string, error) {
+	data, err := json.Marshal(issuanceSpec{
+		DNSNames:       getDNSNames(spec),
+		IPAddresses:    spec.IPAddresses,
+		URIs:           spec.URIs,
+		EmailAddresses: spec.EmailAddresses,
+		Validity:       spec.Validity,
+		Subject:        spec.Subject,
+		PrivateKey:     spec.PrivateKey,
+		IssuerRef:      spec.IssuerRef,
+		Usages:         spec.Usages,
+		IsCA:           spec.IsCA,
+		MaxPathLen:     spec.MaxPathLen,
+	})
+	if err != nil {
+		return "", err
 	}
-	return nil
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
 }
 
-// SetStatus sets the status of the Certificate instance
-func (r *CertificateReconciler) SetStatus(ctx context.Context, instance *certsv1.Certificate, status string, message string, deployedNamespace string, expiryDate time.Duration) error {
-	log := r.Log.WithValues("SetStatus", instance.ObjectMeta.Name)
-	log.Info("Setting status to " + status)
+// certificateMatchesSpec reports whether the certificate was issued for the names, subject, key and usages of the spec
+// The validity and issuer are not compared, the certificate is renewed with them once it is due
+func certificateMatchesSpec(spec *certsv1.CertificateSpec, certificate *x509.Certificate) (bool, error) {
+	opts, err := getTemplateOptions(spec)
+	if err != nil {
+		return false, err
+	}
+	template, err := cert.GetTemplate(opts)
+	if err != nil {
+		return false, err
+	}
 
-	patchBase := client.MergeFrom(instance.DeepCopy())
-	instance.Status.Status = status
-	instance.Status.Message = message
-	instance.Status.DeployedNamespace = deployedNamespace
-	instance.Status.ExpiryDate = metav1.NewTime(time.Now().Add(expiryDate))
-	if err := r.Status().Patch(ctx, instance, patchBase); err != nil {
-		log.Error(err, "Failed to patch Certificate status")
-		return err
+	algorithm, size := cert.KeyAlgorithm(certificate)
+	keyOpts := getKeyOptions(spec)
+	if keyOpts.Algorithm == "" {
+		keyOpts.Algorithm = constants.KeyAlgorithmRSA
+	}
+	if algorithm != keyOpts.Algorithm || (keyOpts.Size != 0 && size != keyOpts.Size) {
+		return false, nil
 	}
 
-	return nil
+	// Key encipherment is not set on certificates for keys other than RSA
+	if algorithm != constants.KeyAlgorithmRSA {
+		template.KeyUsage &^= x509.KeyUsageKeyEncipherment
+	}
+
+	expectedNames := cert.SubjectAlternativeNames(&template)
+	names := cert.SubjectAlternativeNames(certificate)
+	sort.Strings(expectedNames)
+	sort.Strings(names)
+
+	return template.Subject.String() == certificate.Subject.String() &&
+		strings.Join(expectedNames, ",") == strings.Join(names, ",") &&
+		strings.Join(cert.UsageNames(template.KeyUsage, template.ExtKeyUsage), ",") == strings.Join(cert.UsageNames(certificate.KeyUsage, certificate.ExtKeyUsage), ",") &&
+		template.IsCA == certificate.IsCA, nil
 }
 
-// CreateOrUpdateSecret creates or updates the Secret object
-func (r *CertificateReconciler) CreateOrUpdateSecret(ctx context.Context, secret *corev1.Secret) error {
+// getRenewalTime returns the time at which the certificate should be renewed according to renewBefore
+// A renewBefore that is not shorter than the lifetime of the issued certificate, for example because
+// the issuer capped the lifetime, falls back to renewing after two thirds of the lifetime
+func getRenewalTime(spec *certsv1.CertificateSpec, certificate *x509.Certificate) (time.Time, error) {
+	if spec.RenewBefore == "" {
+		return certificate.NotAfter, nil
+	}
 
-	// Check if the secret already exists
-	err := r.Get(ctx, client.ObjectKeyFromObject(secret), secret)
-	if err != nil && !errors.IsNotFound(err) {
-		return err
+	lifetime := certificate.NotAfter.Sub(certificate.NotBefore)
+	renewBefore, err := parseRenewBefore(spec.RenewBefore, lifetime)
+	if err != nil {
+		return time.Time{}, err
 	}
+	if renewBefore >= lifetime {
+		renewBefore = lifetime / 3
+	}
+	return certificate.NotAfter.Add(-renewBefore), nil
+}
 
-	// If the secret does not exist, create it
-	if errors.IsNotFound(err) {
-		return r.Create(ctx, secret)
+// parseRenewBefore parses a renewBefore duration or percentage of the lifetime
+// Durations must be positive and percentages between 0 and 100, both exclusive
+func parseRenewBefore(renewBefore string, lifetime time.Duration) (time.Duration, error) {
+	if percentage, ok := strings.CutSuffix(renewBefore, "%"); ok {
+		value, err := strconv.Atoi(percentage)
+		if err != nil {
+			return 0, fmt.Errorf("invalid renewBefore %q: %w", renewBefore, err)
+		}
+		if value <= 0 || value >= 100 {
+			return 0, fmt.Errorf("invalid renewBefore %q: the percentage must be between 0%% and 100%%", renewBefore)
+		}
+		return lifetime * time.Duration(value) / 100, nil
 	}
 
-	// Otherwise, update the secret
-	return r.Update(ctx, secret)
+	duration, err := utils.ParseDuration(renewBefore)
+	if err != nil {
+		return 0, fmt.Errorf("invalid renewBefore %q: %w", renewBefore, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("invalid renewBefore %q: the duration must be positive", renewBefore)
+	}
+	return duration, nil
 }
 
 // MapSecretsToCertificates maps the secret names to the Certificate names
 func MapSecretsToCertificates(object client.Object, client client.Client, log logr.Logger) []reconcile.Request {
 	secret := object.(*corev1.Secret)
 
+	// Replicas belong to the Certificate named by their labels
+	if namespace, ok := secret.Labels[constants.LabelReplicaSourceNamespace]; ok {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: secret.Labels[constants.LabelCertificateName], Namespace: namespace}}}
+	}
+
 	// Get all Certificates
 	certificates := &certsv1.CertificateList{}
 	err := client.List(context.Background(), certificates)
@@ -134,21 +321,40 @@ func MapSecretsToCertificates(object client.Object, client client.Client, log lo
 		return nil
 	}
 
-	// Check if the secret is referenced by any Certificates
+	// Check if the secret is referenced by any Certificates in its namespace
+	var requests []reconcile.Request
 	for _, certificate := range certificates.Items {
-		if certificate.Spec.SecretRef.Name == secret.Name {
+		if certificate.Namespace != secret.Namespace {
+			continue
+		}
+		if certificate.Spec.SecretRef.Name == secret.Name || usesKeystorePasswordSecret(&certificate.Spec, secret.Name) {
 			log.Info("Found Certificate referencing secret", "Certificate", certificate.Name)
-			requests := []reconcile.Request{
-				{
-					NamespacedName: types.NamespacedName{
-						Name:      certificate.Name,
-						Namespace: certificate.Namespace,
-					},
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      certificate.Name,
+					Namespace: certificate.Namespace,
 				},
-			}
-			return requests
+			})
 		}
 	}
 
-	return nil
+	return requests
+}
+
+// MapNamespacesToReplicatingCertificates returns the Certificates that replicate their Secret to other namespaces
+// Any of them may select a new or relabeled namespace
+func MapNamespacesToReplicatingCertificates(client client.Client, log logr.Logger) []reconcile.Request {
+	certificates := &certsv1.CertificateList{}
+	if err := client.List(context.Background(), certificates); err != nil {
+		log.Error(err, "Failed to list Certificates")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, certificate := range certificates.Items {
+		if certificate.Spec.ReplicateTo != nil {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: certificate.Name, Namespace: certificate.Namespace}})
+		}
+	}
+	return requests
 }
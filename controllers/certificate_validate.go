@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils"
+)
+
+// validateCertificateSpec validates the parts of the Certificate spec the CRD schema can not
+func validateCertificateSpec(spec *certsv1.CertificateSpec) error {
+	var errs []error
+
+	dnsNames := getDNSNames(spec)
+	if len(dnsNames)+len(spec.IPAddresses)+len(spec.URIs)+len(spec.EmailAddresses) == 0 {
+		errs = append(errs, errors.New("at least one of dnsName, dnsNames, ipAddresses, uris or emailAddresses must be set"))
+	}
+
+	for _, dnsName := range dnsNames {
+		var msgs []string
+		if strings.HasPrefix(dnsName, "*.") {
+			msgs = validation.IsWildcardDNS1123Subdomain(dnsName)
+		} else {
+			msgs = validation.IsDNS1123Subdomain(dnsName)
+		}
+		if len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("invalid DNS name %q: %s", dnsName, strings.Join(msgs, ", ")))
+		}
+	}
+
+	for _, ip := range spec.IPAddresses {
+		if net.ParseIP(ip) == nil {
+			errs = append(errs, fmt.Errorf("invalid IP address %q", ip))
+		}
+	}
+
+	for _, uri := range spec.URIs {
+		if parsed, err := url.Parse(uri); err != nil || parsed.Scheme == "" {
+			errs = append(errs, fmt.Errorf("invalid URI %q: an absolute URI is required", uri))
+		}
+	}
+
+	for _, email := range spec.EmailAddresses {
+		if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+			errs = append(errs, fmt.Errorf("invalid email address %q", email))
+		}
+	}
+
+	if spec.RenewBefore != "" {
+		if err := validateRenewBefore(spec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if spec.PrivateKey != nil {
+		if err := validatePrivateKey(spec.PrivateKey); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	errs = append(errs, validateUsages(spec)...)
+
+	if spec.SecretTemplate != nil {
+		errs = append(errs, validateSecretTemplate(spec.SecretTemplate)...)
+	}
+
+	if spec.ReplicateTo != nil {
+		for _, namespace := range spec.ReplicateTo.Namespaces {
+			if msgs := validation.IsDNS1123Label(namespace); len(msgs) > 0 {
+				errs = append(errs, fmt.Errorf("invalid replicateTo namespace %q: %s", namespace, strings.Join(msgs, ", ")))
+			}
+		}
+		if _, err := metav1.LabelSelectorAsSelector(spec.ReplicateTo.NamespaceSelector); err != nil {
+			errs = append(errs, fmt.Errorf("invalid replicateTo namespaceSelector: %w", err))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateRenewBefore validates a renewBefore percentage or a renewBefore duration that is shorter than the validity
+func validateRenewBefore(spec *certsv1.CertificateSpec) error {
+	validity, err := utils.ParseDuration(spec.Validity)
+	if err != nil {
+		return fmt.Errorf("invalid validity %q: %w", spec.Validity, err)
+	}
+	renewBefore, err := parseRenewBefore(spec.RenewBefore, validity)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(spec.RenewBefore, "%") && renewBefore >= validity {
+		return fmt.Errorf("renewBefore %q must be shorter than validity %q", spec.RenewBefore, spec.Validity)
+	}
+	return nil
+}
+
+// validatePrivateKey validates the combination of private key algorithm and size
+func validatePrivateKey(privateKey *certsv1.PrivateKey) error {
+	switch privateKey.Algorithm {
+	case constants.KeyAlgorithmRSA, "":
+		if privateKey.Size != 0 && privateKey.Size != 2048 && privateKey.Size != 3072 && privateKey.Size != 4096 {
+			return fmt.Errorf("invalid RSA key size %d, must be 2048, 3072 or 4096", privateKey.Size)
+		}
+	case constants.KeyAlgorithmECDSA:
+		if privateKey.Size != 0 && privateKey.Size != 256 && privateKey.Size != 384 {
+			return fmt.Errorf("invalid ECDSA key size %d, must be 256 or 384", privateKey.Size)
+		}
+	case constants.KeyAlgorithmEd25519:
+		if privateKey.Size != 0 {
+			return errors.New("Ed25519 keys do not have a configurable size")
+		}
+	}
+	return nil
+}
+
+// validateUsages validates the combination of usages, isCA, maxPathLen and the private key algorithm
+func validateUsages(spec *certsv1.CertificateSpec) []error {
+	var errs []error
+
+	usages := map[string]bool{}
+	for _, usage := range getUsages(spec) {
+		usages[usage] = true
+	}
+
+	if usages[constants.UsageCertSign] && !spec.IsCA {
+		errs = append(errs, fmt.Errorf("usage %q requires isCA", constants.UsageCertSign))
+	}
+	if spec.MaxPathLen != nil && !spec.IsCA {
+		errs = append(errs, errors.New("maxPathLen requires isCA"))
+	}
+	if (usages[constants.UsageEncipherOnly] || usages[constants.UsageDecipherOnly]) && !usages[constants.UsageKeyAgreement] {
+		errs = append(errs, fmt.Errorf("usages %q and %q require %q", constants.UsageEncipherOnly, constants.UsageDecipherOnly, constants.UsageKeyAgreement))
+	}
+	if usages[constants.UsageEncipherOnly] && usages[constants.UsageDecipherOnly] {
+		errs = append(errs, fmt.Errorf("usages %q and %q are mutually exclusive", constants.UsageEncipherOnly, constants.UsageDecipherOnly))
+	}
+
+	// Key encipherment is only explicitly allowed for RSA keys, it is dropped from the default usages otherwise
+	if len(spec.Usages) > 0 && usages[constants.UsageKeyEncipherment] &&
+		spec.PrivateKey != nil && spec.PrivateKey.Algorithm != "" && spec.PrivateKey.Algorithm != constants.KeyAlgorithmRSA {
+		errs = append(errs, fmt.Errorf("usage %q requires an RSA private key", constants.UsageKeyEncipherment))
+	}
+
+	return errs
+}
+
+// validateSecretTemplate validates the labels, annotations and key aliases of the secret template
+func validateSecretTemplate(template *certsv1.SecretTemplate) []error {
+	var errs []error
+
+	for key, value := range template.Labels {
+		if msgs := validation.IsQualifiedName(key); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("invalid secret template label %q: %s", key, strings.Join(msgs, ", ")))
+		}
+		if msgs := validation.IsValidLabelValue(value); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("invalid value of secret template label %q: %s", key, strings.Join(msgs, ", ")))
+		}
+	}
+
+	for key := range template.Annotations {
+		if msgs := validation.IsQualifiedName(key); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("invalid secret template annotation %q: %s", key, strings.Join(msgs, ", ")))
+		}
+		switch key {
+		case constants.AnnotationSpecHash, constants.AnnotationKeystoreHash, constants.AnnotationSecretTemplate:
+			errs = append(errs, fmt.Errorf("secret template annotation %q is managed by the controller", key))
+		}
+	}
+
+	// Aliases can only copy the keys the controller writes, and must not overwrite them
+	sources := map[string]bool{"tls.crt": true, "tls.key": true, "ca.crt": true, combinedPEMKey: true}
+	for _, format := range keystoreFormats {
+		sources[format.keystoreKey] = true
+		sources[format.truststoreKey] = true
+	}
+	for alias, source := range template.KeyAliases {
+		if msgs := validation.IsConfigMapKey(alias); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("invalid secret template key alias %q: %s", alias, strings.Join(msgs, ", ")))
+		}
+		if sources[alias] {
+			errs = append(errs, fmt.Errorf("secret template key alias %q must not overwrite a key written by the controller", alias))
+		}
+		if !sources[source] {
+			errs = append(errs, fmt.Errorf("secret template key alias %q has unknown source key %q", alias, source))
+		}
+	}
+
+	return errs
+}
+
+// getUsages returns the usages of the Certificate as strings, nil when the defaults apply
+func getUsages(spec *certsv1.CertificateSpec) []string {
+	var usages []string
+	for _, usage := range spec.Usages {
+		usages = append(usages, string(usage))
+	}
+	return usages
+}
+
+// getDNSNames returns the DNS names of the Certificate, merging the legacy dnsName field into dnsNames
+func getDNSNames(spec *certsv1.CertificateSpec) []string {
+	var dnsNames []string
+	seen := map[string]bool{}
+	for _, dnsName := range append([]string{spec.DNSName}, spec.DNSNames...) {
+		if dnsName == "" || seen[dnsName] {
+			continue
+		}
+		seen[dnsName] = true
+		dnsNames = append(dnsNames, dnsName)
+	}
+	return dnsNames
+}
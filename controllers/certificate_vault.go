@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+	"github.com/sheryarbutt/certificate-manager/pkg/vault"
+)
+
+const (
+	// vaultTokenKey is the key of the Vault token in the Secret referenced by tokenSecretRef
+	vaultTokenKey = "token"
+
+	// vaultAudience is the audience of the ServiceAccount tokens that log in with the Kubernetes auth method
+	vaultAudience = "vault"
+
+	// vaultTokenExpirationSeconds is the lifetime of the ServiceAccount tokens that log in with the Kubernetes auth method
+	vaultTokenExpirationSeconds = 600
+)
+
+// TokenRequester requests a token for the ServiceAccount, the token is written to the status of the TokenRequest
+type TokenRequester func(ctx context.Context, serviceAccount *corev1.ServiceAccount, tokenRequest *authenticationv1.TokenRequest) error
+
+// NewTokenRequester returns a TokenRequester that creates TokenRequests with the token subresource of ServiceAccounts
+func NewTokenRequester(c client.Client) TokenRequester {
+	return func(ctx context.Context, serviceAccount *corev1.ServiceAccount, tokenRequest *authenticationv1.TokenRequest) error {
+		return c.SubResource("token").Create(ctx, serviceAccount, tokenRequest)
+	}
+}
+
+// vaultSigner has a role of the Vault PKI secrets engine sign certificates
+type vaultSigner struct {
+	client *vault.Client
+	path   string
+}
+
+// buildVaultSigner builds a Signer that is authenticated to Vault with the token or the Kubernetes auth method of the issuer
+func buildVaultSigner(ctx context.Context, r *CertificateRequestReconciler, _ *certsv1.CertificateRequest, namespace string, spec *certsv1.IssuerSpec) (cert.Signer, error) {
+	issuer := spec.Vault
+	if (issuer.Auth.TokenSecretRef == nil) == (issuer.Auth.Kubernetes == nil) {
+		return nil, errors.New("vault auth must configure exactly one of tokenSecretRef and kubernetes")
+	}
+
+	httpClient, err := newHTTPClient(issuer.CABundle)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Vault caBundle: %w", err)
+	}
+	client := &vault.Client{
+		Address:    issuer.Server,
+		Namespace:  issuer.Namespace,
+		HTTPClient: httpClient,
+	}
+
+	if ref := issuer.Auth.TokenSecretRef; ref != nil {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+			return nil, fmt.Errorf("failed to get Vault token Secret %s/%s: %w", namespace, ref.Name, err)
+		}
+		client.Token = strings.TrimSpace(string(secret.Data[vaultTokenKey]))
+		if client.Token == "" {
+			return nil, fmt.Errorf("vault token Secret %s/%s has no %s key", namespace, ref.Name, vaultTokenKey)
+		}
+		return &vaultSigner{client: client, path: issuer.Path}, nil
+	}
+
+	kubernetes := issuer.Auth.Kubernetes
+	jwt, err := r.requestServiceAccountToken(ctx, namespace, kubernetes.ServiceAccountName)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.LoginKubernetes(ctx, kubernetes.MountPath, kubernetes.Role, jwt); err != nil {
+		return nil, fmt.Errorf("failed to log in to Vault with role %s: %w", kubernetes.Role, err)
+	}
+	return &vaultSigner{client: client, path: issuer.Path}, nil
+}
+
+// requestServiceAccountToken requests a short-lived token with the Vault audience for the ServiceAccount
+func (r *CertificateRequestReconciler) requestServiceAccountToken(ctx context.Context, namespace, name string) (string, error) {
+	if r.RequestToken == nil {
+		return "", errors.New("requesting ServiceAccount tokens is not configured")
+	}
+
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	expirationSeconds := int64(vaultTokenExpirationSeconds)
+	tokenRequest := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         []string{vaultAudience},
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}
+	if err := r.RequestToken(ctx, serviceAccount, tokenRequest); err != nil {
+		return "", fmt.Errorf("failed to request a token for ServiceAccount %s/%s: %w", namespace, name, err)
+	}
+	return tokenRequest.Status.Token, nil
+}
+
+// Sign has the PKI role sign the CSR of the request for the names and lifetime of the template
+func (s *vaultSigner) Sign(ctx context.Context, request *cert.SigningRequest) (*cert.SignedCertificate, error) {
+	if request.CSR == nil {
+		return nil, errors.New("vault issuers require a certificate signing request")
+	}
+	template := request.Template
+	if template.IsCA {
+		return nil, errors.New("vault issuers do not issue CA certificates")
+	}
+
+	var ipSANs, uriSANs []string
+	for _, ip := range template.IPAddresses {
+		ipSANs = append(ipSANs, ip.String())
+	}
+	for _, uri := range template.URIs {
+		uriSANs = append(uriSANs, uri.String())
+	}
+
+	response, err := s.client.Sign(ctx, s.path, &vault.SignRequest{
+		CSR:        string(pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificateRequest, Bytes: request.CSR.Raw})),
+		CommonName: template.Subject.CommonName,
+		AltNames:   strings.Join(append(append([]string{}, template.DNSNames...), template.EmailAddresses...), ","),
+		IPSANs:     strings.Join(ipSANs, ","),
+		URISANs:    strings.Join(uriSANs, ","),
+		TTL:        vault.TTL(template.NotAfter.Sub(template.NotBefore)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with Vault: %w", err)
+	}
+
+	// The chain holds the issuing CA followed by the CAs above it, its last certificate is the CA of the certificate
+	chain := response.CAChain
+	if len(chain) == 0 && response.IssuingCA != "" {
+		chain = []string{response.IssuingCA}
+	}
+	signed := &cert.SignedCertificate{Certificate: joinPEM(append([]string{response.Certificate}, chain...))}
+	if len(chain) > 0 {
+		signed.CA = joinPEM(chain[len(chain)-1:])
+	}
+	return signed, nil
+}
+
+// joinPEM joins the PEM encoded certificates, each on lines of its own
+func joinPEM(certificates []string) []byte {
+	var joined []byte
+	for _, certificate := range certificates {
+		joined = append(joined, strings.TrimSpace(certificate)...)
+		joined = append(joined, '\n')
+	}
+	return joined
+}
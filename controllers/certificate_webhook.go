@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+	"github.com/sheryarbutt/certificate-manager/pkg/webhook"
+)
+
+// webhookSigner has an external signing service sign the certificates of a CertificateRequest
+type webhookSigner struct {
+	client  *webhook.Client
+	request *certsv1.CertificateRequest
+}
+
+// buildWebhookSigner builds a Signer that calls the signing service of the issuer with its client certificate
+func buildWebhookSigner(ctx context.Context, r *CertificateRequestReconciler, instance *certsv1.CertificateRequest, namespace string, spec *certsv1.IssuerSpec) (cert.Signer, error) {
+	issuer := spec.Webhook
+
+	var clientCertificates []tls.Certificate
+	if ref := issuer.ClientCertificateSecretRef; ref != nil {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+			return nil, fmt.Errorf("failed to get client certificate Secret %s/%s: %w", namespace, ref.Name, err)
+		}
+		clientCertificate, err := tls.X509KeyPair(secret.Data["tls.crt"], secret.Data["tls.key"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate Secret %s/%s: %w", namespace, ref.Name, err)
+		}
+		clientCertificates = append(clientCertificates, clientCertificate)
+	}
+
+	httpClient, err := newHTTPClient(issuer.CABundle, clientCertificates...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook caBundle: %w", err)
+	}
+	return &webhookSigner{client: &webhook.Client{URL: issuer.URL, HTTPClient: httpClient}, request: instance}, nil
+}
+
+// Sign sends the CSR with the usages and duration of the template to the signing service
+// The request is retried with the same UID while the service answers that the issuance is pending
+func (s *webhookSigner) Sign(ctx context.Context, request *cert.SigningRequest) (*cert.SignedCertificate, error) {
+	if request.CSR == nil {
+		return nil, errors.New("webhook issuers require a certificate signing request")
+	}
+	template := request.Template
+
+	response, err := s.client.Sign(ctx, &webhook.SignRequest{
+		UID:             string(s.request.UID),
+		Namespace:       s.request.Namespace,
+		Name:            s.request.Name,
+		CSR:             string(pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificateRequest, Bytes: request.CSR.Raw})),
+		Usages:          cert.UsageNames(template.KeyUsage, template.ExtKeyUsage),
+		DurationSeconds: int64(template.NotAfter.Sub(template.NotBefore).Seconds()),
+		IsCA:            template.IsCA,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with webhook: %w", err)
+	}
+	if response.Status == webhook.StatusPending {
+		return nil, cert.ErrIssuancePending
+	}
+
+	// The service must return a certificate for the key of the CSR, anything else could not be used with the private key
+	chain, err := cert.ParseCertificates([]byte(response.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("webhook returned an invalid certificate: %w", err)
+	}
+	if !cert.CertificateMatches(chain[0], request.PublicKey) {
+		return nil, errors.New("webhook returned a certificate for a different public key")
+	}
+	return &cert.SignedCertificate{Certificate: []byte(response.Certificate), CA: []byte(response.CA)}, nil
+}
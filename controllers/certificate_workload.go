@@ -0,0 +1,570 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+)
+
+// WorkloadKind is a kind of workload that runs pods from a pod template and is reloaded when a Secret changes
+type WorkloadKind struct {
+	// GroupVersionKind is the group, version and kind of the workload
+	GroupVersionKind schema.GroupVersionKind
+
+	// PodTemplatePath is the path of the pod template in the workload, such as spec.template
+	PodTemplatePath []string
+}
+
+// DefaultWorkloadKinds are the workload kinds that are always reloaded
+var DefaultWorkloadKinds = []WorkloadKind{
+	{
+		GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		PodTemplatePath:  []string{"spec", "template"},
+	},
+	{
+		GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+		PodTemplatePath:  []string{"spec", "template"},
+	},
+	{
+		GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+		PodTemplatePath:  []string{"spec", "template"},
+	},
+}
+
+// ParseWorkloadKinds parses a comma separated list of workload kinds in the form group/version/Kind=pod.template.path
+// The group is omitted for the core group, for example "argoproj.io/v1alpha1/Rollout=spec.template"
+func ParseWorkloadKinds(value string) ([]WorkloadKind, error) {
+	var kinds []WorkloadKind
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		gvkString, path, ok := strings.Cut(entry, "=")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid workload kind %q: the pod template path is missing", entry)
+		}
+
+		separator := strings.LastIndex(gvkString, "/")
+		if separator < 0 {
+			return nil, fmt.Errorf("invalid workload kind %q: expected group/version/Kind", entry)
+		}
+		groupVersion, err := schema.ParseGroupVersion(gvkString[:separator])
+		if err != nil {
+			return nil, fmt.Errorf("invalid workload kind %q: %w", entry, err)
+		}
+		kind := gvkString[separator+1:]
+		if kind == "" || groupVersion.Version == "" {
+			return nil, fmt.Errorf("invalid workload kind %q: expected group/version/Kind", entry)
+		}
+
+		kinds = append(kinds, WorkloadKind{
+			GroupVersionKind: groupVersion.WithKind(kind),
+			PodTemplatePath:  strings.Split(path, "."),
+		})
+	}
+	return kinds, nil
+}
+
+// workload is a workload resource together with the path of its pod template
+type workload struct {
+	object          *unstructured.Unstructured
+	podTemplatePath []string
+}
+
+// podTemplate returns a copy of the pod template of the workload
+func (w *workload) podTemplate() (*corev1.PodTemplateSpec, error) {
+	content, found, err := unstructured.NestedMap(w.object.Object, w.podTemplatePath...)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s %s has no pod template at %s", w.object.GetKind(), w.object.GetName(), strings.Join(w.podTemplatePath, "."))
+	}
+
+	template := &corev1.PodTemplateSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// setPodTemplate replaces the pod template of the workload
+func (w *workload) setPodTemplate(template *corev1.PodTemplateSpec) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(template)
+	if err != nil {
+		return err
+	}
+	return unstructured.SetNestedMap(w.object.Object, content, w.podTemplatePath...)
+}
+
+// workloadKinds returns the default workload kinds followed by the configured extra workload kinds
+func (r *CertificateReconciler) workloadKinds() []WorkloadKind {
+	return append(append([]WorkloadKind{}, DefaultWorkloadKinds...), r.ExtraWorkloadKinds...)
+}
+
+// reloadRequeueInterval is how often a Certificate is requeued while its workloads are restarted with a ReloadStrategy
+const reloadRequeueInterval = 10 * time.Second
+
+// reloadCertificatesIndex is the field index of workloads by the Certificates named in their reload-certificates annotation
+const reloadCertificatesIndex = "reloadCertificates"
+
+// indexReloadCertificates returns the Certificates a workload opts in to be reloaded for
+func indexReloadCertificates(object client.Object) []string {
+	var names []string
+	for _, name := range strings.Split(object.GetAnnotations()[constants.AnnotationReloadCertificates], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// indexWorkloads registers the reload-certificates field index for all workload kinds
+// Kinds that are not installed in the cluster are skipped
+func (r *CertificateReconciler) indexWorkloads(ctx context.Context, indexer client.FieldIndexer) error {
+	for _, kind := range r.workloadKinds() {
+		object := &unstructured.Unstructured{}
+		object.SetGroupVersionKind(kind.GroupVersionKind)
+		if err := indexer.IndexField(ctx, object, reloadCertificatesIndex, indexReloadCertificates); err != nil {
+			if meta.IsNoMatchError(err) {
+				r.Log.Info("Workload kind is not installed, skipping", "kind", kind.GroupVersionKind.String())
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// listWorkloads lists the workloads of all workload kinds in the namespace
+// Kinds that are not installed in the cluster are skipped
+func (r *CertificateReconciler) listWorkloads(ctx context.Context, namespace string, opts ...client.ListOption) ([]workload, error) {
+	var workloads []workload
+	for _, kind := range r.workloadKinds() {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(kind.GroupVersionKind.GroupVersion().WithKind(kind.GroupVersionKind.Kind + "List"))
+		if err := r.List(ctx, list, append([]client.ListOption{client.InNamespace(namespace)}, opts...)...); err != nil {
+			if meta.IsNoMatchError(err) {
+				r.Log.Info("Workload kind is not installed, skipping", "kind", kind.GroupVersionKind.String())
+				continue
+			}
+			return nil, err
+		}
+
+		// Sort the workloads by name, so they are always restarted in the same order
+		sort.Slice(list.Items, func(i, j int) bool {
+			return list.Items[i].GetName() < list.Items[j].GetName()
+		})
+		for i := range list.Items {
+			workloads = append(workloads, workload{
+				object:          &list.Items[i],
+				podTemplatePath: kind.PodTemplatePath,
+			})
+		}
+	}
+	return workloads, nil
+}
+
+// getWorkloadsToReload returns the workloads to reload for the Certificate together with the reasons they were matched
+// With ReloadOnChange these are the workloads whose pod template references the secret, in addition workloads opt in
+// with the reload-certificates annotation, which is looked up by field index, and opt out with the reload annotation
+func (r *CertificateReconciler) getWorkloadsToReload(ctx context.Context, req ctrl.Request, instance *certsv1.Certificate) ([]workload, []certsv1.WorkloadReference, error) {
+	log := r.Log.WithValues("getWorkloadsToReload", instance.ObjectMeta.Name)
+	log.Info("Getting workloads to reload")
+
+	// Without ReloadOnChange only the workloads that opted in are of interest
+	var opts []client.ListOption
+	if !instance.Spec.ReloadOnChange {
+		opts = append(opts, client.MatchingFields{reloadCertificatesIndex: instance.Name})
+	}
+	workloads, err := r.listWorkloads(ctx, req.Namespace, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var workloadsToReload []workload
+	var references []certsv1.WorkloadReference
+	for _, w := range workloads {
+		if w.object.GetAnnotations()[constants.AnnotationReload] == "false" {
+			log.Info("Workload opted out of reloads, skipping", "kind", w.object.GetKind(), "name", w.object.GetName())
+			continue
+		}
+
+		template, err := w.podTemplate()
+		if err != nil {
+			log.Error(err, "Failed to read pod template, skipping", "kind", w.object.GetKind(), "name", w.object.GetName())
+			continue
+		}
+
+		var reasons []string
+		if instance.Spec.ReloadOnChange {
+			reasons = getSecretReferences(&template.Spec, instance.Spec.SecretRef.Name)
+		}
+		for _, name := range indexReloadCertificates(w.object) {
+			if name == instance.Name {
+				reasons = append(reasons, fmt.Sprintf("annotation %q", constants.AnnotationReloadCertificates))
+				break
+			}
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+
+		log.Info("Found workload to reload", "kind", w.object.GetKind(), "name", w.object.GetName(), "reasons", reasons)
+		workloadsToReload = append(workloadsToReload, w)
+		references = append(references, certsv1.WorkloadReference{
+			APIVersion: w.object.GetAPIVersion(),
+			Kind:       w.object.GetKind(),
+			Name:       w.object.GetName(),
+			Reasons:    reasons,
+		})
+	}
+
+	return workloadsToReload, references, nil
+}
+
+// getSecretReferences returns the places in the pod spec that reference the secret
+// Secret and projected volumes, envFrom and env secretKeyRef of all containers, init containers and ephemeral containers are checked
+func getSecretReferences(podSpec *corev1.PodSpec, secretName string) []string {
+	var reasons []string
+
+	for _, volume := range podSpec.Volumes {
+		if volume.Secret != nil && volume.Secret.SecretName == secretName {
+			reasons = append(reasons, fmt.Sprintf("volume %q", volume.Name))
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil && source.Secret.Name == secretName {
+					reasons = append(reasons, fmt.Sprintf("projected volume %q", volume.Name))
+					break
+				}
+			}
+		}
+	}
+
+	checkContainer := func(containerType, name string, envFrom []corev1.EnvFromSource, env []corev1.EnvVar) {
+		for _, source := range envFrom {
+			if source.SecretRef != nil && source.SecretRef.Name == secretName {
+				reasons = append(reasons, fmt.Sprintf("envFrom of %s %q", containerType, name))
+			}
+		}
+		for _, envVar := range env {
+			if envVar.ValueFrom != nil && envVar.ValueFrom.SecretKeyRef != nil && envVar.ValueFrom.SecretKeyRef.Name == secretName {
+				reasons = append(reasons, fmt.Sprintf("env %q of %s %q", envVar.Name, containerType, name))
+			}
+		}
+	}
+	for _, container := range podSpec.InitContainers {
+		checkContainer("init container", container.Name, container.EnvFrom, container.Env)
+	}
+	for _, container := range podSpec.Containers {
+		checkContainer("container", container.Name, container.EnvFrom, container.Env)
+	}
+	for _, container := range podSpec.EphemeralContainers {
+		checkContainer("ephemeral container", container.Name, container.EnvFrom, container.Env)
+	}
+
+	return reasons
+}
+
+// setReloadStatus records the reloaded workloads and the reload progress in the status of the Certificate instance
+func (r *CertificateReconciler) setReloadStatus(ctx context.Context, instance *certsv1.Certificate, references []certsv1.WorkloadReference, reload *certsv1.ReloadStatus) error {
+	if equality.Semantic.DeepEqual(instance.Status.Workloads, references) && equality.Semantic.DeepEqual(instance.Status.Reload, reload) {
+		return nil
+	}
+
+	patchBase := client.MergeFrom(instance.DeepCopy())
+	instance.Status.Workloads = references
+	instance.Status.Reload = reload
+	return r.Status().Patch(ctx, instance, patchBase)
+}
+
+// reloadWorkloads restarts the workloads to reload that do not run the current data of the secret yet
+// With a ReloadStrategy at most MaxConcurrent workloads are restarting at the same time, the rest follow on later reconciles
+// The progress is derived from the pod templates and the status of the workloads, so it survives a restart of the controller
+// The reloaded workloads and the progress are recorded in the status of the Certificate instance
+func (r *CertificateReconciler) reloadWorkloads(ctx context.Context, req ctrl.Request, instance *certsv1.Certificate, secret *corev1.Secret) error {
+	log := r.Log.WithValues("reloadWorkloads", instance.ObjectMeta.Name)
+	log.Info("Reloading workloads", "mode", instance.Spec.ReloadMode)
+
+	workloads, references, err := r.getWorkloadsToReload(ctx, req, instance)
+	if err != nil {
+		return err
+	}
+	if len(workloads) == 0 {
+		return r.setReloadStatus(ctx, instance, references, nil)
+	}
+
+	maxConcurrent := len(workloads)
+	var waitForAvailable bool
+	if strategy := instance.Spec.ReloadStrategy; strategy != nil {
+		if strategy.MaxConcurrent != nil {
+			maxConcurrent = *strategy.MaxConcurrent
+		}
+		waitForAvailable = strategy.WaitForAvailable
+	}
+
+	reload := &certsv1.ReloadStatus{
+		Revision: getReloadRevision(instance, secret),
+		Total:    len(workloads),
+	}
+
+	// Count the workloads that already run the revision, those that did not become available yet are still restarting
+	var pending []workload
+	for _, w := range workloads {
+		template, err := w.podTemplate()
+		if err != nil {
+			return err
+		}
+
+		var changed bool
+		if instance.Spec.ReloadMode == constants.ReloadModeEnv {
+			changed = setReloadEnv(template, secret)
+		} else {
+			// Workloads without a checksum already run the current certificate, it is recorded without restarting them
+			stored := getStoredChecksum(w.object, template, secret.Name)
+			if stored == "" {
+				if err := r.recordChecksum(ctx, w, secret); err != nil {
+					return err
+				}
+				reload.Updated++
+				reload.Completed++
+				continue
+			}
+			changed = stored != getSecretChecksum(secret)
+		}
+		if changed {
+			pending = append(pending, w)
+			continue
+		}
+
+		reload.Updated++
+		if waitForAvailable && !isRolledOut(w.object) {
+			reload.Restarting = append(reload.Restarting, workloadName(w))
+			continue
+		}
+		reload.Completed++
+	}
+
+	// Restart the pending workloads while there is room for them
+	for _, w := range pending {
+		if len(reload.Restarting) >= maxConcurrent {
+			log.Info("Maximum number of workloads are restarting, waiting", "restarting", reload.Restarting)
+			break
+		}
+
+		original := w.object.DeepCopy() // Copy the workload to patch from the original
+		template, err := w.podTemplate()
+		if err != nil {
+			return err
+		}
+		if instance.Spec.ReloadMode == constants.ReloadModeEnv {
+			setReloadEnv(template, secret)
+		} else {
+			setReloadAnnotation(template, secret)
+			setStoredChecksum(w.object, secret)
+		}
+		if err := w.setPodTemplate(template); err != nil {
+			return err
+		}
+
+		// Patch the workload
+		log.Info("Reloading workload", "kind", w.object.GetKind(), "name", w.object.GetName())
+		if err := r.Patch(ctx, w.object, client.MergeFrom(original)); err != nil {
+			return err
+		}
+		reload.Updated++
+		reload.Restarting = append(reload.Restarting, workloadName(w))
+	}
+
+	// Without waiting a restarted workload is done once it has been patched
+	if !waitForAvailable {
+		reload.Completed += len(reload.Restarting)
+		reload.Restarting = nil
+	}
+
+	// Keep the start time while restarting for the same revision
+	now := metav1.Now()
+	reload.StartTime = &now
+	if previous := instance.Status.Reload; previous != nil && previous.Revision == reload.Revision {
+		reload.StartTime = previous.StartTime
+		reload.CompletionTime = previous.CompletionTime
+	}
+	if reload.Completed < reload.Total {
+		reload.CompletionTime = nil
+	} else if reload.CompletionTime == nil {
+		reload.CompletionTime = &now
+	}
+
+	return r.setReloadStatus(ctx, instance, references, reload)
+}
+
+// getReloadRevision returns the revision of the secret that is set on the pod templates by the reload mode of the Certificate
+func getReloadRevision(instance *certsv1.Certificate, secret *corev1.Secret) string {
+	if instance.Spec.ReloadMode == constants.ReloadModeEnv {
+		return secret.ResourceVersion
+	}
+	return getSecretChecksum(secret)
+}
+
+// workloadName returns the kind and name of the workload
+func workloadName(w workload) string {
+	return w.object.GetKind() + "/" + w.object.GetName()
+}
+
+// isRolledOut reports whether the rollout of the workload completed and all of its pods are available
+// The replica counts are checked for the apps/v1 workloads, as in kubectl rollout status Deployments and StatefulSets
+// must not run any pods of an old revision. Any workload must have observed its latest generation and must not
+// report an Available condition that is not true
+func isRolledOut(object *unstructured.Unstructured) bool {
+	status := func(fields ...string) int64 {
+		value, _, _ := unstructured.NestedInt64(object.Object, append([]string{"status"}, fields...)...)
+		return value
+	}
+
+	if observedGeneration, found, _ := unstructured.NestedInt64(object.Object, "status", "observedGeneration"); found && observedGeneration < object.GetGeneration() {
+		return false
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Available" && condition["status"] != string(corev1.ConditionTrue) {
+			return false
+		}
+	}
+
+	replicas, found, _ := unstructured.NestedInt64(object.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	switch object.GetKind() {
+	case "Deployment", "StatefulSet":
+		return status("updatedReplicas") >= replicas && status("replicas") == status("updatedReplicas") && status("availableReplicas") >= replicas
+	case "ReplicaSet":
+		return status("availableReplicas") >= replicas
+	case "DaemonSet":
+		desired := status("desiredNumberScheduled")
+		return status("updatedNumberScheduled") >= desired && status("numberAvailable") >= desired
+	}
+	return true
+}
+
+// setReloadAnnotation sets the checksum of the certificate in the secret in a pod template annotation, like kubectl rollout restart does
+// It returns false when the annotation already holds the checksum, so workloads only roll when the certificate changed
+func setReloadAnnotation(template *corev1.PodTemplateSpec, secret *corev1.Secret) bool {
+	key := checksumAnnotationKey(secret.Name)
+	checksum := getSecretChecksum(secret)
+	if template.Annotations[key] == checksum {
+		return false
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[key] = checksum
+	return true
+}
+
+// getStoredChecksum returns the checksum of the certificate the workload runs, recorded on the workload or set on its pod template
+// It is empty for workloads that were never reloaded for the secret
+func getStoredChecksum(object *unstructured.Unstructured, template *corev1.PodTemplateSpec, secretName string) string {
+	key := checksumAnnotationKey(secretName)
+	if checksum := object.GetAnnotations()[key]; checksum != "" {
+		return checksum
+	}
+	return template.Annotations[key]
+}
+
+// setStoredChecksum records the checksum of the certificate in the secret on the workload, which does not restart it
+func setStoredChecksum(object *unstructured.Unstructured, secret *corev1.Secret) {
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[checksumAnnotationKey(secret.Name)] = getSecretChecksum(secret)
+	object.SetAnnotations(annotations)
+}
+
+// recordChecksum patches the checksum of the certificate in the secret onto the workload without restarting it
+func (r *CertificateReconciler) recordChecksum(ctx context.Context, w workload, secret *corev1.Secret) error {
+	original := w.object.DeepCopy()
+	setStoredChecksum(w.object, secret)
+	r.Log.Info("Recording certificate checksum on workload", "kind", w.object.GetKind(), "name", w.object.GetName())
+	return r.Patch(ctx, w.object, client.MergeFrom(original))
+}
+
+// setReloadEnv sets the resource version of the secret in an ENV of every container
+// It returns false when all containers already have the resource version
+func setReloadEnv(template *corev1.PodTemplateSpec, secret *corev1.Secret) bool {
+	var changed bool
+	for i, container := range template.Spec.Containers {
+		// Adding ResourceVersion helps identify if the secret has been updated and the workload needs to be reloaded
+		var found bool
+		for j, env := range container.Env {
+			if env.Name == constants.CertificateENVName {
+				// update the value of the env
+				if env.Value != secret.ResourceVersion {
+					template.Spec.Containers[i].Env[j].Value = secret.ResourceVersion
+					changed = true
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			template.Spec.Containers[i].Env = append(container.Env, corev1.EnvVar{
+				Name:  constants.CertificateENVName,
+				Value: secret.ResourceVersion,
+			})
+			changed = true
+		}
+	}
+	return changed
+}
+
+// checksumKeys are the keys of the secret that make up its checksum, in the order they are hashed
+// Keystores, key aliases and the combined PEM are derived from them, so they do not roll workloads on their own
+var checksumKeys = []string{"tls.crt", "tls.key", "ca.crt"}
+
+// getSecretChecksum returns the SHA-256 checksum of the certificate, private key and CA of the secret
+func getSecretChecksum(secret *corev1.Secret) string {
+	hash := sha256.New()
+	for _, key := range checksumKeys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write(secret.Data[key])
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// checksumAnnotationKey returns the pod template annotation key holding the checksum of the secret
+// Every secret gets its own key so workloads using several certificates do not flip between them
+// Secret names that do not fit into the 63 characters of an annotation name are shortened with a hash suffix
+func checksumAnnotationKey(secretName string) string {
+	name := secretName
+	if len(name) > 63 {
+		sum := sha256.Sum256([]byte(secretName))
+		name = strings.TrimRight(name[:54], ".-_") + "-" + hex.EncodeToString(sum[:4])
+	}
+	return constants.AnnotationChecksumPrefix + name
+}
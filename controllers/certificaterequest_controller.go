@@ -0,0 +1,282 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto"
+	stderrors "errors"
+	"fmt"
+
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/acme"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/k8s"
+)
+
+// defaultCertificateRequestDuration is the validity of certificates whose CertificateRequest does not set a duration
+const defaultCertificateRequestDuration = "90d"
+
+// CertificateRequestReconciler signs approved CertificateRequests with the issuer they reference
+type CertificateRequestReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+
+	// ClusterResourceNamespace is the namespace in which Secrets referenced by ClusterIssuers are looked up
+	ClusterResourceNamespace string
+
+	// ACMEHTTP01SolverImage is the image of the Pods that solve http-01 challenges, DefaultACMEHTTP01SolverImage when empty
+	ACMEHTTP01SolverImage string
+
+	// ACMESelfCheck checks presented ACME challenges before they are accepted, they are checked over the network when nil
+	ACMESelfCheck *acme.SelfCheck
+
+	// AutoApprove approves every CertificateRequest that is neither approved nor denied
+	// CertificateRequests created by Certificates are always approved by the Certificate controller
+	AutoApprove bool
+
+	// RequestToken requests the ServiceAccount tokens that Vault issuers log in with
+	RequestToken TokenRequester
+}
+
+// +kubebuilder:rbac:groups=certs.k8c.io,resources=certificaterequests,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=certs.k8c.io,resources=certificaterequests/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=certs.k8c.io,resources=issuers;clusterissuers,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups="",resources=pods;services,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups="",resources=serviceaccounts/token,verbs=create
+func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("certificaterequest", req.NamespacedName)
+	log.Info("Request received to reconcile CertificateRequest")
+
+	instance := &certsv1.CertificateRequest{}
+	if err := r.Get(ctx, req.NamespacedName, instance); err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("CertificateRequest resource not found. Ignoring since object must be deleted")
+			return k8s.DoNotRequeue()
+		}
+		log.Error(err, "Failed to get CertificateRequest")
+		return k8s.RequeueWithError(err)
+	}
+	if instance.DeletionTimestamp != nil {
+		return k8s.DoNotRequeue()
+	}
+
+	// Signed and denied requests are final
+	if meta.IsStatusConditionTrue(instance.Status.Conditions, constants.ConditionReady) {
+		log.Info("CertificateRequest is already signed")
+		return k8s.DoNotRequeue()
+	}
+	if meta.IsStatusConditionTrue(instance.Status.Conditions, constants.ConditionDenied) {
+		log.Info("CertificateRequest was denied")
+		if err := r.setReady(ctx, instance, metav1.ConditionFalse, constants.ReasonDenied, "CertificateRequest was denied"); err != nil {
+			return k8s.RequeueWithError(err)
+		}
+		return k8s.DoNotRequeue()
+	}
+
+	// Only approved requests are signed, approving or denying a request updates its status and triggers a reconcile
+	if !meta.IsStatusConditionTrue(instance.Status.Conditions, constants.ConditionApproved) {
+		if !r.AutoApprove {
+			log.Info("CertificateRequest is waiting for approval")
+			if err := r.setReady(ctx, instance, metav1.ConditionFalse, constants.ReasonPending, "Waiting for the CertificateRequest to be approved"); err != nil {
+				return k8s.RequeueWithError(err)
+			}
+			return k8s.DoNotRequeue()
+		}
+
+		log.Info("Approving CertificateRequest")
+		patchBase := client.MergeFrom(instance.DeepCopy())
+		setRequestCondition(instance, constants.ConditionApproved, metav1.ConditionTrue, constants.ReasonAutoApproved, "Approved by the CertificateRequest controller")
+		if err := r.Status().Patch(ctx, instance, patchBase); err != nil {
+			log.Error(err, "Failed to approve CertificateRequest")
+			return k8s.RequeueWithError(err)
+		}
+	}
+
+	// An invalid request is not retried until it changes
+	signingRequest, err := getSigningRequest(&instance.Spec)
+	if err != nil {
+		log.Error(err, "Invalid CertificateRequest")
+		if err := r.setReady(ctx, instance, metav1.ConditionFalse, constants.ReasonInvalidRequest, err.Error()); err != nil {
+			return k8s.RequeueWithError(err)
+		}
+		return k8s.DoNotRequeue()
+	}
+
+	signed, err := r.sign(ctx, instance, signingRequest)
+	if stderrors.Is(err, cert.ErrIssuancePending) {
+		log.Info("Certificate issuance is pending, requeueing")
+		if err := r.setReady(ctx, instance, metav1.ConditionFalse, constants.ReasonPending, constants.StatusMessageIssuing); err != nil {
+			return k8s.RequeueWithError(err)
+		}
+		return k8s.RequeueAfter(issuancePendingRequeueInterval)
+	}
+	if err != nil {
+		log.Error(err, "Failed to sign CertificateRequest")
+		if err := r.setReady(ctx, instance, metav1.ConditionFalse, constants.ReasonFailed, err.Error()); err != nil {
+			log.Error(err, "Failed to set status to failed")
+		}
+		return k8s.RequeueWithError(err)
+	}
+
+	log.Info("Recording signed certificate")
+	patchBase := client.MergeFrom(instance.DeepCopy())
+	instance.Status.Certificate = signed.Certificate
+	instance.Status.CA = signed.CA
+	setRequestCondition(instance, constants.ConditionReady, metav1.ConditionTrue, constants.ReasonIssued, "Certificate is signed")
+	if err := r.Status().Patch(ctx, instance, patchBase); err != nil {
+		log.Error(err, "Failed to record signed certificate")
+		return k8s.RequeueWithError(err)
+	}
+
+	log.Info("Reconciliation successful")
+	return k8s.DoNotRequeue()
+}
+
+// sign has the issuer referenced by the CertificateRequest sign the certificate
+func (r *CertificateRequestReconciler) sign(ctx context.Context, instance *certsv1.CertificateRequest, request *cert.SigningRequest) (*cert.SignedCertificate, error) {
+	signer, err := r.getSigner(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Sign(ctx, request)
+}
+
+// getSigningRequest returns the signing request for the CSR and the requested duration, usages and CA fields
+func getSigningRequest(spec *certsv1.CertificateRequestSpec) (*cert.SigningRequest, error) {
+	csr, err := cert.ParseCertificateRequest(spec.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := spec.Duration
+	if duration == "" {
+		duration = defaultCertificateRequestDuration
+	}
+	validity, err := utils.ParseDuration(duration)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.MaxPathLen != nil && !spec.IsCA {
+		return nil, stderrors.New("maxPathLen requires isCA")
+	}
+
+	var usages []string
+	for _, usage := range spec.Usages {
+		usages = append(usages, string(usage))
+	}
+
+	template, err := cert.GetRequestTemplate(csr, cert.TemplateOptions{
+		Validity:   validity,
+		Usages:     usages,
+		IsCA:       spec.IsCA,
+		MaxPathLen: spec.MaxPathLen,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert.SigningRequest{
+		Template:  &template,
+		PublicKey: csr.PublicKey,
+		CSR:       csr,
+	}, nil
+}
+
+// getRequestPrivateKey returns the private key of the CSR from the Secret named by the private key annotation
+func (r *CertificateRequestReconciler) getRequestPrivateKey(ctx context.Context, instance *certsv1.CertificateRequest) (crypto.Signer, error) {
+	name := instance.Annotations[constants.AnnotationPrivateKeySecretName]
+	if name == "" {
+		return nil, fmt.Errorf("self-signed certificates require the %s annotation", constants.AnnotationPrivateKeySecretName)
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: instance.Namespace}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get private key Secret %s/%s: %w", instance.Namespace, name, err)
+	}
+	key, err := cert.ParsePrivateKey(secret.Data["tls.key"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key Secret %s/%s: %w", instance.Namespace, name, err)
+	}
+	return key, nil
+}
+
+// privateKeySigner passes the private key of the CertificateRequest to a Signer that signs with the certificate's own key
+type privateKeySigner struct {
+	signer     cert.Signer
+	privateKey crypto.Signer
+}
+
+// Sign issues the certificate after checking that the private key belongs to the CSR
+func (s *privateKeySigner) Sign(ctx context.Context, request *cert.SigningRequest) (*cert.SignedCertificate, error) {
+	if !cert.KeyMatches(s.privateKey, request.PublicKey) {
+		return nil, stderrors.New("the private key does not match the certificate request")
+	}
+	request.PrivateKey = s.privateKey
+	return s.signer.Sign(ctx, request)
+}
+
+// setReady sets the Ready condition of the CertificateRequest and patches its status
+func (r *CertificateRequestReconciler) setReady(ctx context.Context, instance *certsv1.CertificateRequest, status metav1.ConditionStatus, reason, message string) error {
+	patchBase := client.MergeFrom(instance.DeepCopy())
+	setRequestCondition(instance, constants.ConditionReady, status, reason, message)
+	if reason == constants.ReasonFailed || reason == constants.ReasonInvalidRequest {
+		now := metav1.Now()
+		instance.Status.FailureTime = &now
+	}
+	if err := r.Status().Patch(ctx, instance, patchBase); err != nil {
+		r.Log.Error(err, "Failed to patch CertificateRequest status", "certificaterequest", instance.Name)
+		return err
+	}
+	return nil
+}
+
+// setRequestCondition sets a condition of the CertificateRequest
+// meta.SetStatusCondition keeps the lastTransitionTime of conditions whose status did not change
+func setRequestCondition(instance *certsv1.CertificateRequest, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: instance.Generation,
+	})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CertificateRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&certsv1.CertificateRequest{}).
+		Complete(r)
+}
@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	certsv1 "github.com/sheryarbutt/certificate-manager/api/v1"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+)
+
+func TestCertificateRequestController(t *testing.T) {
+	t.Run("CertificateRequestWaitsForApproval", TestCertificateRequestWaitsForApproval)
+	t.Run("CertificateRequestWithAutoApprove", TestCertificateRequestWithAutoApprove)
+	t.Run("DeniedCertificateRequest", TestDeniedCertificateRequest)
+	t.Run("InvalidCertificateRequest", TestInvalidCertificateRequest)
+	t.Run("SelfSignedCertificateRequestWithoutPrivateKey", TestSelfSignedCertificateRequestWithoutPrivateKey)
+	t.Run("CertificateIssuedThroughCertificateRequest", TestCertificateIssuedThroughCertificateRequest)
+	t.Run("CertificateWithForeignCertificateRequest", TestCertificateWithForeignCertificateRequest)
+}
+
+// setupRequestTestEnv sets up the test environment of the CertificateRequest controller
+func setupRequestTestEnv(autoApprove bool) *CertificateRequestReconciler {
+	r := setupTestEnv()
+	return &CertificateRequestReconciler{
+		Client:      r.Client,
+		Log:         r.Log,
+		Scheme:      r.Scheme,
+		AutoApprove: autoApprove,
+	}
+}
+
+// TestCertificateRequestWaitsForApproval tests a CertificateRequest submitted with a CSR of its own
+// The request should only be signed by the CA Issuer once it is approved
+func TestCertificateRequestWaitsForApproval(t *testing.T) {
+	// Setup the test environment
+	r := setupRequestTestEnv(false)
+	caCert := createRequestCAIssuer(t, r)
+
+	instance := getCertificateRequestTemplate(t, "test-request", "default", "example.k8c.io")
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "CertificateRequest should be created")
+
+	err = triggerRequestReconcile(r, "test-request", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	request := getCertificateRequest(t, r, "test-request", "default")
+	assert.Empty(t, request.Status.Certificate, "Certificate should not be signed before approval")
+	readyCondition := meta.FindStatusCondition(request.Status.Conditions, constants.ConditionReady)
+	if assert.NotNil(t, readyCondition, "Ready condition should be set") {
+		assert.Equal(t, metav1.ConditionFalse, readyCondition.Status, "Ready condition should be false")
+		assert.Equal(t, constants.ReasonPending, readyCondition.Reason, "Ready condition should be pending")
+	}
+
+	// Approve the request like an approver would
+	setRequestCondition(request, constants.ConditionApproved, metav1.ConditionTrue, constants.ReasonApproved, "Approved by the test")
+	err = r.Status().Update(context.Background(), request)
+	assert.NoError(t, err, "CertificateRequest should be approved")
+
+	err = triggerRequestReconcile(r, "test-request", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	request = getCertificateRequest(t, r, "test-request", "default")
+	assert.True(t, meta.IsStatusConditionTrue(request.Status.Conditions, constants.ConditionReady), "CertificateRequest should be ready")
+	assert.Equal(t, caCert, request.Status.CA, "CA should be recorded")
+
+	chain, err := cert.ParseCertificates(request.Status.Certificate)
+	assert.NoError(t, err, "Status should contain a certificate")
+	assert.Equal(t, []string{"example.k8c.io"}, chain[0].DNSNames, "DNS names should be taken from the CSR")
+	assert.InDelta(t, float64(time.Hour), float64(chain[0].NotAfter.Sub(chain[0].NotBefore)), float64(time.Minute), "Validity should be the requested duration")
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caCert)
+	_, err = chain[0].Verify(x509.VerifyOptions{DNSName: "example.k8c.io", Roots: roots})
+	assert.NoError(t, err, "Certificate should be signed by the CA")
+}
+
+// TestCertificateRequestWithAutoApprove tests the signing of a CertificateRequest by a controller that approves every request
+func TestCertificateRequestWithAutoApprove(t *testing.T) {
+	// Setup the test environment
+	r := setupRequestTestEnv(true)
+	createRequestCAIssuer(t, r)
+
+	instance := getCertificateRequestTemplate(t, "test-request", "default", "example.k8c.io")
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "CertificateRequest should be created")
+
+	err = triggerRequestReconcile(r, "test-request", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	request := getCertificateRequest(t, r, "test-request", "default")
+	approvedCondition := meta.FindStatusCondition(request.Status.Conditions, constants.ConditionApproved)
+	if assert.NotNil(t, approvedCondition, "Approved condition should be set") {
+		assert.Equal(t, metav1.ConditionTrue, approvedCondition.Status, "Approved condition should be true")
+		assert.Equal(t, constants.ReasonAutoApproved, approvedCondition.Reason, "Approved condition should be set by the controller")
+	}
+	assert.True(t, meta.IsStatusConditionTrue(request.Status.Conditions, constants.ConditionReady), "CertificateRequest should be ready")
+	assert.NotEmpty(t, request.Status.Certificate, "Certificate should be signed")
+}
+
+// TestDeniedCertificateRequest tests a denied CertificateRequest, which should never be signed
+func TestDeniedCertificateRequest(t *testing.T) {
+	// Setup the test environment
+	r := setupRequestTestEnv(true)
+	createRequestCAIssuer(t, r)
+
+	instance := getCertificateRequestTemplate(t, "test-request", "default", "example.k8c.io")
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "CertificateRequest should be created")
+
+	setRequestCondition(instance, constants.ConditionDenied, metav1.ConditionTrue, constants.ReasonDenied, "Denied by the test")
+	err = r.Status().Update(context.Background(), instance)
+	assert.NoError(t, err, "CertificateRequest should be denied")
+
+	err = triggerRequestReconcile(r, "test-request", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	request := getCertificateRequest(t, r, "test-request", "default")
+	assert.Empty(t, request.Status.Certificate, "Certificate should not be signed")
+	assert.False(t, meta.IsStatusConditionTrue(request.Status.Conditions, constants.ConditionApproved), "Denied request should not be approved")
+	readyCondition := meta.FindStatusCondition(request.Status.Conditions, constants.ConditionReady)
+	if assert.NotNil(t, readyCondition, "Ready condition should be set") {
+		assert.Equal(t, metav1.ConditionFalse, readyCondition.Status, "Ready condition should be false")
+		assert.Equal(t, constants.ReasonDenied, readyCondition.Reason, "Ready condition should be denied")
+	}
+}
+
+// TestInvalidCertificateRequest tests a CertificateRequest whose CSR can not be parsed
+// The request should be marked invalid without being retried
+func TestInvalidCertificateRequest(t *testing.T) {
+	// Setup the test environment
+	r := setupRequestTestEnv(true)
+	createRequestCAIssuer(t, r)
+
+	instance := getCertificateRequestTemplate(t, "test-request", "default", "example.k8c.io")
+	instance.Spec.Request = []byte("invalid")
+	instance.Spec.IssuerRef = &certsv1.IssuerRef{Name: "test-issuer", Kind: constants.KindIssuer}
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "CertificateRequest should be created")
+
+	err = triggerRequestReconcile(r, "test-request", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	request := getCertificateRequest(t, r, "test-request", "default")
+	assert.Empty(t, request.Status.Certificate, "Certificate should not be signed")
+	assert.NotNil(t, request.Status.FailureTime, "FailureTime should be set")
+	readyCondition := meta.FindStatusCondition(request.Status.Conditions, constants.ConditionReady)
+	if assert.NotNil(t, readyCondition, "Ready condition should be set") {
+		assert.Equal(t, constants.ReasonInvalidRequest, readyCondition.Reason, "Ready condition should be invalid")
+	}
+}
+
+// TestSelfSignedCertificateRequestWithoutPrivateKey tests a CertificateRequest without an issuer and without the private key annotation
+// A self-signed certificate can not be signed without the private key, so the request should fail
+func TestSelfSignedCertificateRequestWithoutPrivateKey(t *testing.T) {
+	// Setup the test environment
+	r := setupRequestTestEnv(true)
+
+	instance := getCertificateRequestTemplate(t, "test-request", "default", "example.k8c.io")
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "CertificateRequest should be created")
+
+	err = triggerRequestReconcile(r, "test-request", "default")
+	assert.Error(t, err, "Reconcile should return an error")
+
+	request := getCertificateRequest(t, r, "test-request", "default")
+	assert.Empty(t, request.Status.Certificate, "Certificate should not be signed")
+	readyCondition := meta.FindStatusCondition(request.Status.Conditions, constants.ConditionReady)
+	if assert.NotNil(t, readyCondition, "Ready condition should be set") {
+		assert.Equal(t, constants.ReasonFailed, readyCondition.Reason, "Ready condition should be failed")
+		assert.Contains(t, readyCondition.Message, constants.AnnotationPrivateKeySecretName, "Message should name the missing annotation")
+	}
+}
+
+// TestCertificateIssuedThroughCertificateRequest tests that a Certificate is issued through a CertificateRequest
+// Only the request of the latest issuance and no private key Secret should be kept
+func TestCertificateIssuedThroughCertificateRequest(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Equal(t, 1, certificate.Status.Revision, "Revision should be set")
+	assert.Equal(t, "test-certificate-1", certificate.Status.CertificateRequest, "CertificateRequest should be recorded")
+
+	request := &certsv1.CertificateRequest{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate-1", Namespace: "default"}, request)
+	assert.NoError(t, err, "CertificateRequest should exist")
+	assert.True(t, metav1.IsControlledBy(request, certificate), "CertificateRequest should be owned by the Certificate")
+
+	// The Secret should hold the signed certificate of the request and the private key of its CSR
+	secret := &corev1.Secret{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, secret)
+	assert.NoError(t, err, "Secret should be created")
+	assert.Equal(t, request.Status.Certificate, secret.Data["tls.crt"], "Secret should contain the signed certificate")
+	csr, err := cert.ParseCertificateRequest(request.Spec.Request)
+	assert.NoError(t, err, "CertificateRequest should contain a CSR")
+	privateKey, err := cert.ParsePrivateKey(secret.Data["tls.key"])
+	assert.NoError(t, err, "Secret should contain a private key")
+	assert.True(t, cert.KeyMatches(privateKey, csr.PublicKey), "Private key should belong to the CSR")
+
+	err = r.Get(context.Background(), types.NamespacedName{Name: nextPrivateKeySecretName(certificate), Namespace: "default"}, &corev1.Secret{})
+	assert.Error(t, err, "Private key Secret should be removed")
+
+	// A spec change issues a new revision and removes the earlier request
+	certificate.Spec.DNSName = "changed.k8c.io"
+	err = r.Update(context.Background(), certificate)
+	assert.NoError(t, err, "Certificate instance should be updated")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	requests := &certsv1.CertificateRequestList{}
+	err = r.List(context.Background(), requests)
+	assert.NoError(t, err, "CertificateRequests should be listed")
+	if assert.Len(t, requests.Items, 1, "Only the latest CertificateRequest should be kept") {
+		assert.Equal(t, "test-certificate-2", requests.Items[0].Name, "CertificateRequest of the new revision should be kept")
+	}
+}
+
+// TestCertificateWithForeignCertificateRequest tests a Certificate whose next CertificateRequest was created by someone else
+// The request should neither be approved nor used and the Certificate should report the conflict
+func TestCertificateWithForeignCertificateRequest(t *testing.T) {
+	// Setup the test environment
+	r := setupTestEnv()
+
+	instance := getCertificateTemplate("test-certificate", "default", "test-secret", "1h", false, false, false)
+	specHash, err := getSpecHash(&instance.Spec)
+	assert.NoError(t, err, "Spec hash should be computed")
+
+	// The foreign request has the predictable name and the spec hash of the Certificate, but no owner
+	foreign := getCertificateRequestTemplate(t, "test-certificate-1", "default", "test.k8c.io")
+	foreign.Labels = map[string]string{constants.LabelCertificateName: "test-certificate"}
+	foreign.Annotations = map[string]string{constants.AnnotationSpecHash: specHash}
+	err = r.Create(context.Background(), foreign)
+	assert.NoError(t, err, "Foreign CertificateRequest should be created")
+
+	err = r.Create(context.Background(), instance)
+	assert.NoError(t, err, "Certificate instance should be created")
+
+	err = triggerReconcile(r, "test-certificate", "default")
+	assert.Error(t, err, "Reconcile should return an error")
+
+	request := &certsv1.CertificateRequest{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate-1", Namespace: "default"}, request)
+	assert.NoError(t, err, "Foreign CertificateRequest should be kept")
+	assert.False(t, meta.IsStatusConditionTrue(request.Status.Conditions, constants.ConditionApproved), "Foreign CertificateRequest should not be approved")
+
+	certificate := &certsv1.Certificate{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-certificate", Namespace: "default"}, certificate)
+	assert.NoError(t, err, "Certificate instance should exist")
+	assert.Equal(t, constants.StatusConflict, certificate.Status.Status, "Certificate status should be conflict")
+	readyCondition := meta.FindStatusCondition(certificate.Status.Conditions, constants.ConditionReady)
+	if assert.NotNil(t, readyCondition, "Ready condition should be set") {
+		assert.Equal(t, constants.ReasonConflict, readyCondition.Reason, "Ready condition should report the conflict")
+	}
+
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-secret", Namespace: "default"}, &corev1.Secret{})
+	assert.Error(t, err, "Secret should not be created")
+}
+
+// triggerRequestReconcile triggers the Reconcile function of the CertificateRequest controller
+func triggerRequestReconcile(r *CertificateRequestReconciler, name, namespace string) error {
+	_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}})
+	return err
+}
+
+// getCertificateRequest returns the CertificateRequest
+func getCertificateRequest(t *testing.T, r *CertificateRequestReconciler, name, namespace string) *certsv1.CertificateRequest {
+	request := &certsv1.CertificateRequest{}
+	err := r.Get(context.Background(), types.NamespacedName{Name: name, Namespace: namespace}, request)
+	assert.NoError(t, err, "CertificateRequest should exist")
+	return request
+}
+
+// createRequestCAIssuer creates the test-issuer CA Issuer and returns the PEM encoded CA certificate
+func createRequestCAIssuer(t *testing.T, r *CertificateRequestReconciler) []byte {
+	caCert, caKey := getCAKeyPair(t, true)
+	caSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-ca", Namespace: "default"},
+		Data:       map[string][]byte{"tls.crt": caCert, "tls.key": caKey},
+	}
+	err := r.Create(context.Background(), caSecret)
+	assert.NoError(t, err, "CA Secret should be created")
+
+	issuer := &certsv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-issuer", Namespace: "default"},
+		Spec:       certsv1.IssuerSpec{CA: &certsv1.CAIssuer{SecretName: "test-ca"}},
+	}
+	err = r.Create(context.Background(), issuer)
+	assert.NoError(t, err, "Issuer should be created")
+	return caCert
+}
+
+// getCertificateRequestTemplate returns a CertificateRequest with a CSR for the DNS name
+func getCertificateRequestTemplate(t *testing.T, name, namespace, dnsName string) *certsv1.CertificateRequest {
+	privateKey, err := cert.GeneratePrivateKey(constants.KeyAlgorithmECDSA, 256)
+	assert.NoError(t, err, "Private key should be generated")
+	csr, err := cert.CreateCertificateRequest(privateKey, cert.TemplateOptions{CommonName: dnsName, DNSNames: []string{dnsName}})
+	assert.NoError(t, err, "CSR should be created")
+
+	return &certsv1.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: certsv1.CertificateRequestSpec{
+			Request:  csr,
+			Duration: "1h",
+		},
+	}
+}
@@ -0,0 +1,360 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/k8s"
+)
+
+// defaultCSRDuration is the validity of certificates whose CertificateSigningRequest does not set expirationSeconds
+const defaultCSRDuration = 365 * 24 * time.Hour
+
+// csrUsageAliases maps the CertificateSigningRequest usages that have no x509 name of their own to the usage they stand for
+var csrUsageAliases = map[certificatesv1.KeyUsage]string{
+	certificatesv1.UsageSigning: constants.UsageDigitalSignature,
+	certificatesv1.UsageSMIME:   constants.UsageEmailProtection,
+}
+
+// approvableUsages are the usages of CertificateSigningRequests that an approval policy may approve
+var approvableUsages = map[string]bool{
+	constants.UsageDigitalSignature: true,
+	constants.UsageKeyEncipherment:  true,
+	constants.UsageKeyAgreement:     true,
+	constants.UsageServerAuth:       true,
+	constants.UsageClientAuth:       true,
+}
+
+// CSRApprovalPolicy approves CertificateSigningRequests of the configured signers without an approver
+type CSRApprovalPolicy struct {
+	// Groups are the groups of the requesters whose CertificateSigningRequests are approved, the policy is off when empty
+	Groups []string
+
+	// DNSSuffixes restrict the DNS names and the common name of approved requests
+	// Every name must be one of the suffixes or a subdomain of one, requests for any name are approved when empty
+	DNSSuffixes []string
+
+	// AllowIPAddresses approves requests with IP address subject alternative names
+	AllowIPAddresses bool
+
+	// AllowURIs approves requests with URI subject alternative names
+	AllowURIs bool
+
+	// AllowEmailAddresses approves requests with email subject alternative names
+	AllowEmailAddresses bool
+}
+
+// CertificateSigningRequestReconciler signs native CertificateSigningRequests of the configured signer names
+type CertificateSigningRequestReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+
+	// ClusterResourceNamespace is the namespace in which the CA Secrets of the signers are stored
+	ClusterResourceNamespace string
+
+	// Signers maps the signer names this controller signs for to the name of their CA Secret
+	Signers map[string]string
+
+	// ApprovalPolicy approves matching CertificateSigningRequests, unmatched requests wait for an approver
+	ApprovalPolicy CSRApprovalPolicy
+}
+
+// ParseCSRSigners parses a comma separated list of signers in the form signerName=secretName
+// Signer names are qualified by a domain, for example "k8c.io/kubelet-serving=kubelet-serving-ca"
+func ParseCSRSigners(value string) (map[string]string, error) {
+	signers := map[string]string{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		signerName, secretName, ok := strings.Cut(entry, "=")
+		if !ok || secretName == "" {
+			return nil, fmt.Errorf("invalid signer %q: the CA Secret name is missing", entry)
+		}
+		domain, name, ok := strings.Cut(signerName, "/")
+		if !ok || domain == "" || name == "" {
+			return nil, fmt.Errorf("invalid signer %q: expected domain/name", entry)
+		}
+		if domain == "kubernetes.io" || strings.HasSuffix(domain, ".kubernetes.io") {
+			return nil, fmt.Errorf("invalid signer %q: signers of kubernetes.io are reserved", entry)
+		}
+		signers[signerName] = secretName
+	}
+	return signers, nil
+}
+
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=get;list;watch
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests/status;certificatesigningrequests/approval,verbs=update
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=signers,verbs=approve;sign
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+func (r *CertificateSigningRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("certificatesigningrequest", req.Name)
+
+	instance := &certificatesv1.CertificateSigningRequest{}
+	if err := r.Get(ctx, req.NamespacedName, instance); err != nil {
+		if errors.IsNotFound(err) {
+			return k8s.DoNotRequeue()
+		}
+		log.Error(err, "Failed to get CertificateSigningRequest")
+		return k8s.RequeueWithError(err)
+	}
+
+	// Requests of other signers are left to them, signed, denied and failed requests are final
+	secretName, ok := r.Signers[instance.Spec.SignerName]
+	if !ok || len(instance.Status.Certificate) > 0 {
+		return k8s.DoNotRequeue()
+	}
+	if csrHasCondition(instance, certificatesv1.CertificateDenied) || csrHasCondition(instance, certificatesv1.CertificateFailed) {
+		return k8s.DoNotRequeue()
+	}
+	log.Info("Request received to reconcile CertificateSigningRequest")
+
+	csr, template, csrErr := getCSRTemplate(instance)
+	if !csrHasCondition(instance, certificatesv1.CertificateApproved) {
+		// Only valid requests are approved, approving a request updates it and triggers a reconcile
+		if csrErr != nil || !r.ApprovalPolicy.matches(instance, csr) {
+			log.Info("CertificateSigningRequest is waiting for approval")
+			return k8s.DoNotRequeue()
+		}
+
+		log.Info("Approving CertificateSigningRequest")
+		setCSRCondition(instance, certificatesv1.CertificateApproved, constants.ReasonAutoApproved, "Approved by the approval policy of certificate-manager")
+		if err := r.SubResource("approval").Update(ctx, instance); err != nil {
+			log.Error(err, "Failed to approve CertificateSigningRequest")
+			return k8s.RequeueWithError(err)
+		}
+	}
+
+	// An approved request that can not be signed is marked failed, it is never retried
+	if csrErr != nil {
+		log.Error(csrErr, "Invalid CertificateSigningRequest")
+		setCSRCondition(instance, certificatesv1.CertificateFailed, constants.ReasonInvalidRequest, csrErr.Error())
+		if err := r.Status().Update(ctx, instance); err != nil {
+			return k8s.RequeueWithError(err)
+		}
+		return k8s.DoNotRequeue()
+	}
+
+	signer, err := r.getCASigner(ctx, secretName)
+	if err != nil {
+		log.Error(err, "Failed to get the CA of the signer", "signer", instance.Spec.SignerName)
+		return k8s.RequeueWithError(err)
+	}
+	signed, err := signer.Sign(ctx, &cert.SigningRequest{Template: template, PublicKey: csr.PublicKey, CSR: csr})
+	if err != nil {
+		log.Error(err, "Failed to sign CertificateSigningRequest")
+		return k8s.RequeueWithError(err)
+	}
+
+	log.Info("Recording signed certificate")
+	instance.Status.Certificate = signed.Certificate
+	if err := r.Status().Update(ctx, instance); err != nil {
+		log.Error(err, "Failed to record signed certificate")
+		return k8s.RequeueWithError(err)
+	}
+
+	log.Info("Reconciliation successful")
+	return k8s.DoNotRequeue()
+}
+
+// getCSRTemplate parses the CSR of the CertificateSigningRequest and returns the template of its certificate
+// The validity is taken from expirationSeconds and the usages from the request, like cert.GetTemplate does for Certificates
+func getCSRTemplate(instance *certificatesv1.CertificateSigningRequest) (*x509.CertificateRequest, *x509.Certificate, error) {
+	csr, err := cert.ParseCertificateRequest(instance.Spec.Request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	validity := defaultCSRDuration
+	if instance.Spec.ExpirationSeconds != nil {
+		validity = time.Duration(*instance.Spec.ExpirationSeconds) * time.Second
+	}
+
+	template, err := cert.GetRequestTemplate(csr, cert.TemplateOptions{
+		Validity: validity,
+		Usages:   csrUsages(instance),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return csr, &template, nil
+}
+
+// csrUsages returns the usage names of the CertificateSigningRequest
+func csrUsages(instance *certificatesv1.CertificateSigningRequest) []string {
+	var usages []string
+	for _, usage := range instance.Spec.Usages {
+		if alias, ok := csrUsageAliases[usage]; ok {
+			usages = append(usages, alias)
+			continue
+		}
+		usages = append(usages, string(usage))
+	}
+	return usages
+}
+
+// getCASigner returns the Signer of the CA key pair stored in the Secret
+func (r *CertificateSigningRequestReconciler) getCASigner(ctx context.Context, secretName string) (cert.Signer, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: r.ClusterResourceNamespace}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get CA Secret %s/%s: %w", r.ClusterResourceNamespace, secretName, err)
+	}
+
+	signer, err := cert.NewCASigner(secret.Data["tls.crt"], secret.Data["tls.key"], secret.Data["ca.crt"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA Secret %s/%s: %w", r.ClusterResourceNamespace, secretName, err)
+	}
+	return signer, nil
+}
+
+// matches reports whether the policy approves the CertificateSigningRequest
+// The requester must be in one of the groups, only end entity usages and the allowed kinds of names are approved
+// The common name and every DNS name must match a suffix
+func (p CSRApprovalPolicy) matches(instance *certificatesv1.CertificateSigningRequest, csr *x509.CertificateRequest) bool {
+	if !hasAnyGroup(instance.Spec.Groups, p.Groups) {
+		return false
+	}
+	for _, usage := range csrUsages(instance) {
+		if !approvableUsages[usage] {
+			return false
+		}
+	}
+	if (len(csr.IPAddresses) > 0 && !p.AllowIPAddresses) ||
+		(len(csr.URIs) > 0 && !p.AllowURIs) ||
+		(len(csr.EmailAddresses) > 0 && !p.AllowEmailAddresses) {
+		return false
+	}
+	if len(p.DNSSuffixes) == 0 {
+		return true
+	}
+	if commonName := csr.Subject.CommonName; commonName != "" && !hasAnySuffix(commonName, p.DNSSuffixes) {
+		return false
+	}
+	for _, dnsName := range csr.DNSNames {
+		if !hasAnySuffix(dnsName, p.DNSSuffixes) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasAnyGroup reports whether any of the groups is one of the wanted groups
+func hasAnyGroup(groups, wanted []string) bool {
+	for _, group := range groups {
+		for _, w := range wanted {
+			if group == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasAnySuffix reports whether the DNS name is one of the suffixes or a subdomain of one
+// A leading dot of a suffix is ignored, so both ".example.com" and "example.com" match "www.example.com" but not "wwwexample.com"
+func hasAnySuffix(dnsName string, suffixes []string) bool {
+	dnsName = strings.ToLower(dnsName)
+	for _, suffix := range suffixes {
+		suffix = strings.ToLower(strings.TrimPrefix(suffix, "."))
+		if suffix == "" {
+			continue
+		}
+		if dnsName == suffix || strings.HasSuffix(dnsName, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// csrHasCondition reports whether the CertificateSigningRequest has the condition set to true
+func csrHasCondition(instance *certificatesv1.CertificateSigningRequest, conditionType certificatesv1.RequestConditionType) bool {
+	for _, condition := range instance.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// setCSRCondition sets the condition of the CertificateSigningRequest with the status true
+// An existing condition of the same type is updated in place, its lastUpdateTime only changes when the condition changed
+func setCSRCondition(instance *certificatesv1.CertificateSigningRequest, conditionType certificatesv1.RequestConditionType, reason, message string) {
+	now := metav1.Now()
+	for i := range instance.Status.Conditions {
+		condition := &instance.Status.Conditions[i]
+		if condition.Type != conditionType {
+			continue
+		}
+		if condition.Status != corev1.ConditionTrue {
+			condition.Status = corev1.ConditionTrue
+			condition.LastTransitionTime = now
+		} else if condition.Reason == reason && condition.Message == message {
+			return
+		}
+		condition.Reason = reason
+		condition.Message = message
+		condition.LastUpdateTime = now
+		return
+	}
+
+	instance.Status.Conditions = append(instance.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+		Type:               conditionType,
+		Status:             corev1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		LastUpdateTime:     now,
+		LastTransitionTime: now,
+	})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// Only CertificateSigningRequests of the configured signers are watched
+func (r *CertificateSigningRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&certificatesv1.CertificateSigningRequest{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			csr, ok := object.(*certificatesv1.CertificateSigningRequest)
+			if !ok {
+				return false
+			}
+			_, ok = r.Signers[csr.Spec.SignerName]
+			return ok
+		}))).
+		Complete(r)
+}
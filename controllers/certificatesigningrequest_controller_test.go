@@ -0,0 +1,384 @@
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+)
+
+const testSignerName = "k8c.io/test-signer"
+
+func TestCertificateSigningRequestController(t *testing.T) {
+	t.Run("ApprovedCertificateSigningRequest", TestApprovedCertificateSigningRequest)
+	t.Run("CertificateSigningRequestOfOtherSigner", TestCertificateSigningRequestOfOtherSigner)
+	t.Run("CertificateSigningRequestApprovalPolicy", TestCertificateSigningRequestApprovalPolicy)
+	t.Run("DeniedCertificateSigningRequest", TestDeniedCertificateSigningRequest)
+	t.Run("InvalidCertificateSigningRequest", TestInvalidCertificateSigningRequest)
+	t.Run("ReconcileCertificateSigningRequestTwice", TestReconcileCertificateSigningRequestTwice)
+}
+
+// setupCSRTestEnv sets up the test environment of the CertificateSigningRequest controller with the CA of the test signer
+// It returns the PEM encoded CA certificate
+func setupCSRTestEnv(t *testing.T, policy CSRApprovalPolicy) (*CertificateSigningRequestReconciler, []byte) {
+	env := setupTestEnv()
+	r := &CertificateSigningRequestReconciler{
+		Client:                   env.Client,
+		Log:                      env.Log,
+		Scheme:                   env.Scheme,
+		ClusterResourceNamespace: "certificate-manager",
+		Signers:                  map[string]string{testSignerName: "test-signer-ca"},
+		ApprovalPolicy:           policy,
+	}
+
+	caCert, caKey := getCAKeyPair(t, true)
+	caSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-signer-ca", Namespace: "certificate-manager"},
+		Data:       map[string][]byte{"tls.crt": caCert, "tls.key": caKey},
+	}
+	err := r.Create(context.Background(), caSecret)
+	assert.NoError(t, err, "CA Secret should be created")
+	return r, caCert
+}
+
+// TestApprovedCertificateSigningRequest tests the signing of an approved CertificateSigningRequest of a configured signer
+func TestApprovedCertificateSigningRequest(t *testing.T) {
+	// Setup the test environment
+	r, caCert := setupCSRTestEnv(t, CSRApprovalPolicy{})
+
+	instance := getCertificateSigningRequestTemplate(t, "test-csr", testSignerName, "node.k8c.io")
+	instance.Spec.Usages = []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageServerAuth}
+	expirationSeconds := int32(3600)
+	instance.Spec.ExpirationSeconds = &expirationSeconds
+	createCSR(t, r, instance, certificatesv1.CertificateApproved)
+
+	err := triggerCSRReconcile(r, "test-csr")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	csr := getCSR(t, r, "test-csr")
+	chain, err := cert.ParseCertificates(csr.Status.Certificate)
+	assert.NoError(t, err, "Status should contain a certificate")
+	assert.Equal(t, []string{"node.k8c.io"}, chain[0].DNSNames, "DNS names should be taken from the CSR")
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, chain[0].ExtKeyUsage, "Usages should be taken from the request")
+	assert.InDelta(t, float64(time.Hour), float64(chain[0].NotAfter.Sub(chain[0].NotBefore)), float64(time.Minute), "Validity should be expirationSeconds")
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caCert)
+	_, err = chain[0].Verify(x509.VerifyOptions{DNSName: "node.k8c.io", Roots: roots})
+	assert.NoError(t, err, "Certificate should be signed by the CA of the signer")
+}
+
+// TestCertificateSigningRequestOfOtherSigner tests that CertificateSigningRequests of other signers are left alone
+func TestCertificateSigningRequestOfOtherSigner(t *testing.T) {
+	// Setup the test environment
+	r, _ := setupCSRTestEnv(t, CSRApprovalPolicy{Groups: []string{"system:nodes"}})
+
+	instance := getCertificateSigningRequestTemplate(t, "test-csr", certificatesv1.KubeletServingSignerName, "node.k8c.io")
+	createCSR(t, r, instance, certificatesv1.CertificateApproved)
+
+	err := triggerCSRReconcile(r, "test-csr")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	csr := getCSR(t, r, "test-csr")
+	assert.Empty(t, csr.Status.Certificate, "Certificate should not be signed")
+}
+
+// TestCertificateSigningRequestApprovalPolicy tests that CertificateSigningRequests matching the approval policy are approved and signed
+// Requests that do not match the policy should wait for an approver
+func TestCertificateSigningRequestApprovalPolicy(t *testing.T) {
+	policy := CSRApprovalPolicy{Groups: []string{"system:nodes"}, DNSSuffixes: []string{".nodes.k8c.io"}}
+	tests := []struct {
+		name     string
+		policy   *CSRApprovalPolicy
+		groups   []string
+		options  cert.TemplateOptions
+		usages   []certificatesv1.KeyUsage
+		approved bool
+	}{
+		{
+			name:     "Matching request",
+			groups:   []string{"system:authenticated", "system:nodes"},
+			options:  cert.TemplateOptions{CommonName: "node-1.nodes.k8c.io", DNSNames: []string{"node-1.nodes.k8c.io"}},
+			approved: true,
+		},
+		{
+			name:    "Requester outside the groups",
+			groups:  []string{"system:authenticated"},
+			options: cert.TemplateOptions{CommonName: "node-1.nodes.k8c.io", DNSNames: []string{"node-1.nodes.k8c.io"}},
+		},
+		{
+			name:    "DNS name outside the suffixes",
+			groups:  []string{"system:nodes"},
+			options: cert.TemplateOptions{CommonName: "node-1.nodes.k8c.io", DNSNames: []string{"example.k8c.io"}},
+		},
+		{
+			name:    "DNS name sharing the characters of a suffix",
+			policy:  &CSRApprovalPolicy{Groups: []string{"system:nodes"}, DNSSuffixes: []string{"nodes.k8c.io"}},
+			groups:  []string{"system:nodes"},
+			options: cert.TemplateOptions{DNSNames: []string{"evilnodes.k8c.io"}},
+		},
+		{
+			name:     "DNS name equal to a suffix",
+			policy:   &CSRApprovalPolicy{Groups: []string{"system:nodes"}, DNSSuffixes: []string{"nodes.k8c.io"}},
+			groups:   []string{"system:nodes"},
+			options:  cert.TemplateOptions{DNSNames: []string{"nodes.k8c.io"}},
+			approved: true,
+		},
+		{
+			name:    "Common name outside the suffixes",
+			groups:  []string{"system:nodes"},
+			options: cert.TemplateOptions{CommonName: "kubernetes.default.svc", DNSNames: []string{"node-1.nodes.k8c.io"}},
+		},
+		{
+			name:    "IP address",
+			groups:  []string{"system:nodes"},
+			options: cert.TemplateOptions{DNSNames: []string{"node-1.nodes.k8c.io"}, IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}},
+		},
+		{
+			name:     "Allowed IP address",
+			policy:   &CSRApprovalPolicy{Groups: []string{"system:nodes"}, DNSSuffixes: []string{".nodes.k8c.io"}, AllowIPAddresses: true},
+			groups:   []string{"system:nodes"},
+			options:  cert.TemplateOptions{DNSNames: []string{"node-1.nodes.k8c.io"}, IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}},
+			approved: true,
+		},
+		{
+			name:    "URI",
+			groups:  []string{"system:nodes"},
+			options: cert.TemplateOptions{DNSNames: []string{"node-1.nodes.k8c.io"}, URIs: []*url.URL{{Scheme: "spiffe", Host: "k8c.io", Path: "/admin"}}},
+		},
+		{
+			name:    "Email address",
+			groups:  []string{"system:nodes"},
+			options: cert.TemplateOptions{DNSNames: []string{"node-1.nodes.k8c.io"}, EmailAddresses: []string{"admin@k8c.io"}},
+		},
+		{
+			name:    "CA usage",
+			groups:  []string{"system:nodes"},
+			options: cert.TemplateOptions{CommonName: "node-1.nodes.k8c.io", DNSNames: []string{"node-1.nodes.k8c.io"}},
+			usages:  []certificatesv1.KeyUsage{certificatesv1.UsageCertSign},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testPolicy := policy
+			if tt.policy != nil {
+				testPolicy = *tt.policy
+			}
+			r, _ := setupCSRTestEnv(t, testPolicy)
+
+			instance := getCertificateSigningRequestWithOptions(t, "test-csr", testSignerName, tt.options)
+			instance.Spec.Groups = tt.groups
+			if tt.usages != nil {
+				instance.Spec.Usages = tt.usages
+			}
+			createCSR(t, r, instance, "")
+
+			err := triggerCSRReconcile(r, "test-csr")
+			assert.NoError(t, err, "Reconcile should not return an error")
+
+			csr := getCSR(t, r, "test-csr")
+			assert.Equal(t, tt.approved, csrHasCondition(csr, certificatesv1.CertificateApproved), "Approval should match the policy")
+			assert.Equal(t, tt.approved, len(csr.Status.Certificate) > 0, "Only approved requests should be signed")
+		})
+	}
+}
+
+// TestDeniedCertificateSigningRequest tests that a denied CertificateSigningRequest is not signed, even when it matches the approval policy
+func TestDeniedCertificateSigningRequest(t *testing.T) {
+	// Setup the test environment
+	r, _ := setupCSRTestEnv(t, CSRApprovalPolicy{Groups: []string{"system:nodes"}})
+
+	instance := getCertificateSigningRequestTemplate(t, "test-csr", testSignerName, "node.k8c.io")
+	instance.Spec.Groups = []string{"system:nodes"}
+	createCSR(t, r, instance, certificatesv1.CertificateDenied)
+
+	err := triggerCSRReconcile(r, "test-csr")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	csr := getCSR(t, r, "test-csr")
+	assert.Empty(t, csr.Status.Certificate, "Certificate should not be signed")
+	assert.False(t, csrHasCondition(csr, certificatesv1.CertificateApproved), "Request should not be approved")
+}
+
+// TestInvalidCertificateSigningRequest tests that an approved CertificateSigningRequest with an invalid CSR is marked failed
+func TestInvalidCertificateSigningRequest(t *testing.T) {
+	// Setup the test environment
+	r, _ := setupCSRTestEnv(t, CSRApprovalPolicy{})
+
+	instance := getCertificateSigningRequestTemplate(t, "test-csr", testSignerName, "node.k8c.io")
+	instance.Spec.Request = []byte("invalid")
+	createCSR(t, r, instance, certificatesv1.CertificateApproved)
+
+	err := triggerCSRReconcile(r, "test-csr")
+	assert.NoError(t, err, "Reconcile should not return an error")
+
+	csr := getCSR(t, r, "test-csr")
+	assert.Empty(t, csr.Status.Certificate, "Certificate should not be signed")
+	assert.True(t, csrHasCondition(csr, certificatesv1.CertificateFailed), "Request should be failed")
+}
+
+func TestParseCSRSigners(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "Empty value",
+			value:    "",
+			expected: map[string]string{},
+		},
+		{
+			name:  "Several signers",
+			value: "k8c.io/serving=serving-ca, k8c.io/client=client-ca",
+			expected: map[string]string{
+				"k8c.io/serving": "serving-ca",
+				"k8c.io/client":  "client-ca",
+			},
+		},
+		{
+			name:    "Missing Secret name",
+			value:   "k8c.io/serving",
+			wantErr: true,
+		},
+		{
+			name:    "Signer name without domain",
+			value:   "serving=serving-ca",
+			wantErr: true,
+		},
+		{
+			name:    "Reserved signer name",
+			value:   "kubernetes.io/kubelet-serving=serving-ca",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signers, err := ParseCSRSigners(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, signers)
+		})
+	}
+}
+
+// triggerCSRReconcile triggers the Reconcile function of the CertificateSigningRequest controller
+func triggerCSRReconcile(r *CertificateSigningRequestReconciler, name string) error {
+	_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Name: name}})
+	return err
+}
+
+// createCSR creates the CertificateSigningRequest and sets the condition like an approver would
+func createCSR(t *testing.T, r *CertificateSigningRequestReconciler, instance *certificatesv1.CertificateSigningRequest, conditionType certificatesv1.RequestConditionType) {
+	err := r.Create(context.Background(), instance)
+	assert.NoError(t, err, "CertificateSigningRequest should be created")
+	if conditionType == "" {
+		return
+	}
+
+	setCSRCondition(instance, conditionType, "Test", "Set by the test")
+	err = r.Status().Update(context.Background(), instance)
+	assert.NoError(t, err, "CertificateSigningRequest condition should be set")
+}
+
+// getCSR returns the CertificateSigningRequest
+func getCSR(t *testing.T, r *CertificateSigningRequestReconciler, name string) *certificatesv1.CertificateSigningRequest {
+	csr := &certificatesv1.CertificateSigningRequest{}
+	err := r.Get(context.Background(), types.NamespacedName{Name: name}, csr)
+	assert.NoError(t, err, "CertificateSigningRequest should exist")
+	return csr
+}
+
+// getCertificateSigningRequestTemplate returns a CertificateSigningRequest of the signer with a CSR for the DNS name
+func getCertificateSigningRequestTemplate(t *testing.T, name, signerName, dnsName string) *certificatesv1.CertificateSigningRequest {
+	return getCertificateSigningRequestWithOptions(t, name, signerName, cert.TemplateOptions{CommonName: dnsName, DNSNames: []string{dnsName}})
+}
+
+// getCertificateSigningRequestWithOptions returns a CertificateSigningRequest of the signer with a CSR for the subject and names of the options
+func getCertificateSigningRequestWithOptions(t *testing.T, name, signerName string, options cert.TemplateOptions) *certificatesv1.CertificateSigningRequest {
+	privateKey, err := cert.GeneratePrivateKey(constants.KeyAlgorithmECDSA, 256)
+	assert.NoError(t, err, "Private key should be generated")
+	request, err := cert.CreateCertificateRequest(privateKey, options)
+	assert.NoError(t, err, "CSR should be created")
+
+	return &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    request,
+			SignerName: signerName,
+			Usages:     []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageServerAuth},
+		},
+	}
+}
+
+// TestSetCSRCondition tests that a condition of the same type is updated in place instead of being appended again
+func TestSetCSRCondition(t *testing.T) {
+	instance := &certificatesv1.CertificateSigningRequest{}
+	setCSRCondition(instance, certificatesv1.CertificateApproved, constants.ReasonAutoApproved, "Approved")
+	assert.Len(t, instance.Status.Conditions, 1, "Condition should be added")
+	past := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	instance.Status.Conditions[0].LastUpdateTime = past
+	instance.Status.Conditions[0].LastTransitionTime = past
+
+	// Setting the same condition again leaves it unchanged
+	setCSRCondition(instance, certificatesv1.CertificateApproved, constants.ReasonAutoApproved, "Approved")
+	assert.Len(t, instance.Status.Conditions, 1, "Condition should not be duplicated")
+	assert.Equal(t, past, instance.Status.Conditions[0].LastUpdateTime, "LastUpdateTime should not change")
+
+	// A changed message updates the condition, the transition time is kept as the status did not change
+	setCSRCondition(instance, certificatesv1.CertificateApproved, constants.ReasonAutoApproved, "Approved again")
+	assert.Len(t, instance.Status.Conditions, 1, "Condition should not be duplicated")
+	assert.Equal(t, "Approved again", instance.Status.Conditions[0].Message, "Message should be updated")
+	assert.True(t, instance.Status.Conditions[0].LastUpdateTime.After(past.Time), "LastUpdateTime should change")
+	assert.Equal(t, past, instance.Status.Conditions[0].LastTransitionTime, "LastTransitionTime should not change")
+
+	// A condition of another type is added next to it
+	setCSRCondition(instance, certificatesv1.CertificateFailed, constants.ReasonInvalidRequest, "Invalid")
+	assert.Len(t, instance.Status.Conditions, 2, "Condition of another type should be added")
+}
+
+// TestReconcileCertificateSigningRequestTwice tests that reconciling an approved request again does not duplicate its conditions
+func TestReconcileCertificateSigningRequestTwice(t *testing.T) {
+	// Setup the test environment
+	r, _ := setupCSRTestEnv(t, CSRApprovalPolicy{})
+
+	instance := getCertificateSigningRequestTemplate(t, "test-csr", testSignerName, "node.k8c.io")
+	instance.Spec.Request = []byte("invalid")
+	createCSR(t, r, instance, certificatesv1.CertificateApproved)
+
+	// The request is approved again by the test, like an approver that retries
+	csr := getCSR(t, r, "test-csr")
+	setCSRCondition(csr, certificatesv1.CertificateApproved, "Test", "Set by the test")
+	err := r.Status().Update(context.Background(), csr)
+	assert.NoError(t, err, "CertificateSigningRequest condition should be set")
+
+	for i := 0; i < 2; i++ {
+		err = triggerCSRReconcile(r, "test-csr")
+		assert.NoError(t, err, "Reconcile should not return an error")
+	}
+
+	csr = getCSR(t, r, "test-csr")
+	counts := map[certificatesv1.RequestConditionType]int{}
+	for _, condition := range csr.Status.Conditions {
+		counts[condition.Type]++
+	}
+	assert.Equal(t, map[certificatesv1.RequestConditionType]int{certificatesv1.CertificateApproved: 1, certificatesv1.CertificateFailed: 1}, counts, "Each condition should exist once")
+}
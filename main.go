@@ -19,6 +19,7 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -28,6 +29,7 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -52,11 +54,46 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var clusterResourceNamespace string
+	var maxConcurrentReconciles int
+	var extraWorkloadKinds string
+	var acmeHTTP01SolverImage string
+	var autoApproveCertificateRequests bool
+	var csrSigners string
+	var csrAutoApproveGroups string
+	var csrAutoApproveDNSSuffixes string
+	var csrAutoApproveIPAddresses bool
+	var csrAutoApproveURIs bool
+	var csrAutoApproveEmailAddresses bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", "certificate-manager",
+		"The namespace in which Secrets referenced by ClusterIssuers are stored.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The maximum number of Certificates that are reconciled concurrently.")
+	flag.StringVar(&extraWorkloadKinds, "extra-workload-kinds", "",
+		"A comma separated list of additional workload kinds to reload, in the form group/version/Kind=pod.template.path.")
+	flag.StringVar(&acmeHTTP01SolverImage, "acme-http01-solver-image", controllers.DefaultACMEHTTP01SolverImage,
+		"The image of the Pods that solve ACME http-01 challenges, it needs a shell and busybox httpd.")
+	flag.BoolVar(&autoApproveCertificateRequests, "auto-approve-certificate-requests", false,
+		"Approve every CertificateRequest, requests created by Certificates are always approved.")
+	flag.StringVar(&csrSigners, "csr-signers", "",
+		"A comma separated list of CertificateSigningRequest signer names to sign for, in the form signerName=secretName. "+
+			"The CA Secrets are stored in the cluster resource namespace.")
+	flag.StringVar(&csrAutoApproveGroups, "csr-auto-approve-groups", "",
+		"A comma separated list of groups whose CertificateSigningRequests for the configured signers are approved.")
+	flag.StringVar(&csrAutoApproveDNSSuffixes, "csr-auto-approve-dns-suffixes", "",
+		"A comma separated list of DNS suffixes, auto-approved CertificateSigningRequests may only request a common name and DNS names "+
+			"that are one of them or a subdomain of one.")
+	flag.BoolVar(&csrAutoApproveIPAddresses, "csr-auto-approve-ip-addresses", false,
+		"Auto-approve CertificateSigningRequests with IP address subject alternative names.")
+	flag.BoolVar(&csrAutoApproveURIs, "csr-auto-approve-uris", false,
+		"Auto-approve CertificateSigningRequests with URI subject alternative names.")
+	flag.BoolVar(&csrAutoApproveEmailAddresses, "csr-auto-approve-email-addresses", false,
+		"Auto-approve CertificateSigningRequests with email subject alternative names.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -65,6 +102,18 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	workloadKinds, err := controllers.ParseWorkloadKinds(extraWorkloadKinds)
+	if err != nil {
+		setupLog.Error(err, "unable to parse extra workload kinds")
+		os.Exit(1)
+	}
+
+	signers, err := controllers.ParseCSRSigners(csrSigners)
+	if err != nil {
+		setupLog.Error(err, "unable to parse CertificateSigningRequest signers")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -72,6 +121,8 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "693cd1b9.k8c.io",
+		// Workloads are read as unstructured objects, serve them from the cache so their field index can be used
+		NewClient: cluster.ClientBuilderWithOptions(cluster.ClientOptions{CacheUnstructured: true}),
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -93,10 +144,56 @@ func main() {
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 		Log:    ctrl.Log.WithName("controllers").WithName("Certificate"),
+
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		ExtraWorkloadKinds:      workloadKinds,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Certificate")
 		os.Exit(1)
 	}
+	if err = (&controllers.CertificateRequestReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Log:    ctrl.Log.WithName("controllers").WithName("CertificateRequest"),
+
+		ClusterResourceNamespace: clusterResourceNamespace,
+		ACMEHTTP01SolverImage:    acmeHTTP01SolverImage,
+		AutoApprove:              autoApproveCertificateRequests,
+		RequestToken:             controllers.NewTokenRequester(mgr.GetClient()),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CertificateRequest")
+		os.Exit(1)
+	}
+	if err = (&controllers.BundleReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Log:    ctrl.Log.WithName("controllers").WithName("Bundle"),
+
+		ClusterResourceNamespace: clusterResourceNamespace,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Bundle")
+		os.Exit(1)
+	}
+	if len(signers) > 0 {
+		if err = (&controllers.CertificateSigningRequestReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+			Log:    ctrl.Log.WithName("controllers").WithName("CertificateSigningRequest"),
+
+			ClusterResourceNamespace: clusterResourceNamespace,
+			Signers:                  signers,
+			ApprovalPolicy: controllers.CSRApprovalPolicy{
+				Groups:              splitList(csrAutoApproveGroups),
+				DNSSuffixes:         splitList(csrAutoApproveDNSSuffixes),
+				AllowIPAddresses:    csrAutoApproveIPAddresses,
+				AllowURIs:           csrAutoApproveURIs,
+				AllowEmailAddresses: csrAutoApproveEmailAddresses,
+			},
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CertificateSigningRequest")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -114,3 +211,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma separated flag value, ignoring empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
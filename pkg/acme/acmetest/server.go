@@ -0,0 +1,620 @@
+// Package acmetest provides an in-process ACME server in the style of Pebble and a DNS stub for tests
+package acmetest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/acme"
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+)
+
+// Server is an in-process ACME server that validates challenges and issues certificates from its own CA
+// Challenges are validated synchronously when they are accepted, so orders are ready right after
+type Server struct {
+	*httptest.Server
+
+	// Resolver looks up the TXT records of dns-01 challenges, net.DefaultResolver when nil
+	Resolver acme.Resolver
+
+	// HTTP01 fetches the key authorization of a http-01 challenge
+	// By default it is fetched from http://<domain>/.well-known/acme-challenge/<token>
+	HTTP01 func(ctx context.Context, domain, token string) (string, error)
+
+	mu             sync.Mutex
+	nextID         int
+	nonces         map[string]bool
+	accounts       map[string]*ecdsa.PublicKey
+	accountsByJWK  map[string]string
+	orders         map[string]*order
+	authorizations map[string]*authorization
+	challenges     map[string]*authorization
+	certificates   map[string][]byte
+
+	rootPEM         []byte
+	intermediate    *x509.Certificate
+	intermediatePEM []byte
+	intermediateKey *ecdsa.PrivateKey
+}
+
+// order is an order together with the account it belongs to
+type order struct {
+	acme.Order
+	account string
+}
+
+// authorization is an authorization together with the order it belongs to
+type authorization struct {
+	acme.Authorization
+	order *order
+}
+
+// NewServer starts a Server with a freshly generated root and intermediate CA
+// The server uses TLS, its certificate is returned by TLSCertificatePEM
+func NewServer() (*Server, error) {
+	s := &Server{
+		nonces:         map[string]bool{},
+		accounts:       map[string]*ecdsa.PublicKey{},
+		accountsByJWK:  map[string]string{},
+		orders:         map[string]*order{},
+		authorizations: map[string]*authorization{},
+		challenges:     map[string]*authorization{},
+		certificates:   map[string][]byte{},
+	}
+	if err := s.generateCA(); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", s.handleDirectory)
+	mux.HandleFunc("/new-nonce", s.handleNewNonce)
+	mux.HandleFunc("/new-account", s.handleNewAccount)
+	mux.HandleFunc("/new-order", s.handleNewOrder)
+	mux.HandleFunc("/order/", s.handleOrder)
+	mux.HandleFunc("/authz/", s.handleAuthorization)
+	mux.HandleFunc("/chall/", s.handleChallenge)
+	mux.HandleFunc("/finalize/", s.handleFinalize)
+	mux.HandleFunc("/cert/", s.handleCertificate)
+	s.Server = httptest.NewTLSServer(mux)
+	return s, nil
+}
+
+// DirectoryURL returns the URL of the directory of the server
+func (s *Server) DirectoryURL() string {
+	return s.URL + "/directory"
+}
+
+// TLSCertificatePEM returns the PEM encoded certificate the server uses for TLS
+func (s *Server) TLSCertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: s.Certificate().Raw})
+}
+
+// RootPEM returns the PEM encoded root certificate of the issued certificates
+func (s *Server) RootPEM() []byte {
+	return s.rootPEM
+}
+
+// generateCA generates the root CA and the intermediate CA that signs the certificates
+func (s *Server) generateCA() error {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	root := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "acmetest root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, root, root, rootKey.Public(), rootKey)
+	if err != nil {
+		return err
+	}
+	root, err = x509.ParseCertificate(rootDER)
+	if err != nil {
+		return err
+	}
+
+	s.intermediateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	intermediate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "acmetest intermediate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	intermediateDER, err := x509.CreateCertificate(rand.Reader, intermediate, root, s.intermediateKey.Public(), rootKey)
+	if err != nil {
+		return err
+	}
+	s.intermediate, err = x509.ParseCertificate(intermediateDER)
+	if err != nil {
+		return err
+	}
+
+	s.rootPEM = pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: rootDER})
+	s.intermediatePEM = pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: intermediateDER})
+	return nil
+}
+
+// newID returns the next resource ID, the lock must be held
+func (s *Server) newID() string {
+	s.nextID++
+	return fmt.Sprint(s.nextID)
+}
+
+// newNonce returns a new replay nonce, the lock must be held
+func (s *Server) newNonce() string {
+	data := make([]byte, 16)
+	_, _ = rand.Read(data)
+	nonce := base64.RawURLEncoding.EncodeToString(data)
+	s.nonces[nonce] = true
+	return nonce
+}
+
+// writeJSON writes the value as JSON with a fresh replay nonce, the lock must be held
+func (s *Server) writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// writeProblem writes an ACME problem document, the lock must be held
+func (s *Server) writeProblem(w http.ResponseWriter, status int, problemType, detail string) {
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(acme.Problem{
+		Type:   "urn:ietf:params:acme:error:" + problemType,
+		Detail: detail,
+		Status: status,
+	})
+}
+
+// verify verifies the signature, nonce and URL of a request, the lock must be held
+// It writes a problem and returns nil when the request is not valid
+func (s *Server) verify(w http.ResponseWriter, r *http.Request) *acme.SignedRequest {
+	if r.Method != http.MethodPost {
+		s.writeProblem(w, http.StatusMethodNotAllowed, "malformed", "only POST requests are allowed")
+		return nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.writeProblem(w, http.StatusBadRequest, "malformed", err.Error())
+		return nil
+	}
+
+	request, err := acme.VerifyJWS(body, func(keyID string) (*ecdsa.PublicKey, error) {
+		key, ok := s.accounts[keyID]
+		if !ok {
+			return nil, fmt.Errorf("account %s does not exist", keyID)
+		}
+		return key, nil
+	})
+	if err != nil {
+		s.writeProblem(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		return nil
+	}
+	if !s.nonces[request.Nonce] {
+		s.writeProblem(w, http.StatusBadRequest, "badNonce", "invalid nonce")
+		return nil
+	}
+	delete(s.nonces, request.Nonce)
+	if request.URL != s.URL+r.URL.Path {
+		s.writeProblem(w, http.StatusUnauthorized, "unauthorized", "request URL does not match the signed URL")
+		return nil
+	}
+	return request
+}
+
+func (s *Server) handleDirectory(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeJSON(w, http.StatusOK, acme.Directory{
+		NewNonce:   s.URL + "/new-nonce",
+		NewAccount: s.URL + "/new-account",
+		NewOrder:   s.URL + "/new-order",
+	})
+}
+
+func (s *Server) handleNewNonce(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleNewAccount(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request := s.verify(w, r)
+	if request == nil {
+		return
+	}
+	if request.JWK == nil {
+		s.writeProblem(w, http.StatusBadRequest, "malformed", "new accounts must embed their key")
+		return
+	}
+
+	// Existing accounts are looked up by their key
+	thumbprint := request.JWK.Thumbprint()
+	status := http.StatusOK
+	url, ok := s.accountsByJWK[thumbprint]
+	if !ok {
+		var account struct {
+			TermsOfServiceAgreed bool `json:"termsOfServiceAgreed"`
+		}
+		if err := json.Unmarshal(request.Payload, &account); err != nil || !account.TermsOfServiceAgreed {
+			s.writeProblem(w, http.StatusBadRequest, "malformed", "terms of service must be agreed to")
+			return
+		}
+		key, err := request.JWK.PublicKey()
+		if err != nil {
+			s.writeProblem(w, http.StatusBadRequest, "badPublicKey", err.Error())
+			return
+		}
+		url = s.URL + "/account/" + s.newID()
+		s.accounts[url] = key
+		s.accountsByJWK[thumbprint] = url
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Location", url)
+	s.writeJSON(w, status, map[string]string{"status": acme.StatusValid})
+}
+
+func (s *Server) handleNewOrder(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request := s.verify(w, r)
+	if request == nil {
+		return
+	}
+
+	var payload struct {
+		Identifiers []acme.Identifier `json:"identifiers"`
+	}
+	if err := json.Unmarshal(request.Payload, &payload); err != nil || len(payload.Identifiers) == 0 {
+		s.writeProblem(w, http.StatusBadRequest, "malformed", "an order needs identifiers")
+		return
+	}
+
+	id := s.newID()
+	o := &order{account: request.KeyID}
+	o.URL = s.URL + "/order/" + id
+	o.Status = acme.StatusPending
+	o.Identifiers = payload.Identifiers
+	o.Finalize = s.URL + "/finalize/" + id
+	for _, identifier := range payload.Identifiers {
+		a := &authorization{order: o}
+		a.URL = s.URL + "/authz/" + s.newID()
+		a.Status = acme.StatusPending
+		a.Identifier = identifier
+
+		// Wildcards are authorized for their base domain and can only be validated with dns-01
+		types := []string{acme.ChallengeHTTP01, acme.ChallengeDNS01}
+		if strings.HasPrefix(identifier.Value, "*.") {
+			a.Identifier.Value = strings.TrimPrefix(identifier.Value, "*.")
+			a.Wildcard = true
+			types = []string{acme.ChallengeDNS01}
+		} else if identifier.Type == acme.IdentifierIP {
+			types = []string{acme.ChallengeHTTP01}
+		}
+		for _, challengeType := range types {
+			challengeID := s.newID()
+			a.Challenges = append(a.Challenges, acme.Challenge{
+				Type:   challengeType,
+				URL:    s.URL + "/chall/" + challengeID,
+				Status: acme.StatusPending,
+				Token:  base64.RawURLEncoding.EncodeToString([]byte("token-" + challengeID)),
+			})
+			s.challenges[s.URL+"/chall/"+challengeID] = a
+		}
+
+		s.authorizations[a.URL] = a
+		o.Authorizations = append(o.Authorizations, a.URL)
+	}
+	s.orders[o.URL] = o
+
+	w.Header().Set("Location", o.URL)
+	s.writeJSON(w, http.StatusCreated, o.Order)
+}
+
+func (s *Server) handleOrder(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request := s.verify(w, r)
+	if request == nil {
+		return
+	}
+
+	o, ok := s.orders[request.URL]
+	if !ok || o.account != request.KeyID {
+		s.writeProblem(w, http.StatusNotFound, "malformed", "order not found")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, o.Order)
+}
+
+func (s *Server) handleAuthorization(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request := s.verify(w, r)
+	if request == nil {
+		return
+	}
+
+	a, ok := s.authorizations[request.URL]
+	if !ok || a.order.account != request.KeyID {
+		s.writeProblem(w, http.StatusNotFound, "malformed", "authorization not found")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, a.Authorization)
+}
+
+func (s *Server) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request := s.verify(w, r)
+	if request == nil {
+		return
+	}
+
+	a, ok := s.challenges[request.URL]
+	if !ok || a.order.account != request.KeyID {
+		s.writeProblem(w, http.StatusNotFound, "malformed", "challenge not found")
+		return
+	}
+	var challenge *acme.Challenge
+	for i := range a.Challenges {
+		if a.Challenges[i].URL == request.URL {
+			challenge = &a.Challenges[i]
+		}
+	}
+
+	// A POST-as-GET only returns the challenge, any payload accepts it
+	if len(request.Payload) > 0 && challenge.Status == acme.StatusPending && a.Status == acme.StatusPending {
+		s.validate(r.Context(), a, challenge)
+	}
+	w.Header().Add("Link", fmt.Sprintf("<%s>;rel=\"up\"", a.URL))
+	s.writeJSON(w, http.StatusOK, challenge)
+}
+
+// validate validates the challenge and updates the authorization and its order, the lock must be held
+func (s *Server) validate(ctx context.Context, a *authorization, challenge *acme.Challenge) {
+	thumbprint := ""
+	if key, ok := s.accounts[a.order.account]; ok {
+		if jwk, err := acme.NewJWK(key); err == nil {
+			thumbprint = jwk.Thumbprint()
+		}
+	}
+	keyAuthorization := challenge.Token + "." + thumbprint
+
+	check := &acme.SelfCheck{HTTP01: s.HTTP01, Resolver: s.Resolver}
+	if err := check.Check(ctx, a.Identifier.Value, challenge, keyAuthorization); err != nil {
+		challenge.Status = acme.StatusInvalid
+		challenge.Error = &acme.Problem{Type: "urn:ietf:params:acme:error:incorrectResponse", Detail: err.Error(), Status: http.StatusForbidden}
+		a.Status = acme.StatusInvalid
+		a.order.Status = acme.StatusInvalid
+		a.order.Error = challenge.Error
+		return
+	}
+
+	challenge.Status = acme.StatusValid
+	a.Status = acme.StatusValid
+	for _, url := range a.order.Authorizations {
+		if s.authorizations[url].Status != acme.StatusValid {
+			return
+		}
+	}
+	a.order.Status = acme.StatusReady
+}
+
+func (s *Server) handleFinalize(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request := s.verify(w, r)
+	if request == nil {
+		return
+	}
+
+	o, ok := s.orders[strings.Replace(request.URL, "/finalize/", "/order/", 1)]
+	if !ok || o.account != request.KeyID {
+		s.writeProblem(w, http.StatusNotFound, "malformed", "order not found")
+		return
+	}
+	if o.Status != acme.StatusReady {
+		s.writeProblem(w, http.StatusForbidden, "orderNotReady", "order is "+o.Status)
+		return
+	}
+
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(request.Payload, &payload); err != nil {
+		s.writeProblem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	der, err := base64.RawURLEncoding.DecodeString(payload.CSR)
+	if err != nil {
+		s.writeProblem(w, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err == nil {
+		err = checkNames(o.Identifiers, csr)
+	}
+	if err != nil {
+		s.writeProblem(w, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+
+	chain, err := s.issue(csr)
+	if err != nil {
+		s.writeProblem(w, http.StatusInternalServerError, "serverInternal", err.Error())
+		return
+	}
+	o.Certificate = s.URL + "/cert/" + s.newID()
+	o.Status = acme.StatusValid
+	s.certificates[o.Certificate] = chain
+
+	w.Header().Set("Location", o.URL)
+	s.writeJSON(w, http.StatusOK, o.Order)
+}
+
+// checkNames checks that the CSR requests exactly the identifiers of the order
+func checkNames(identifiers []acme.Identifier, csr *x509.CertificateRequest) error {
+	var ordered, requested []string
+	for _, identifier := range identifiers {
+		ordered = append(ordered, identifier.Value)
+	}
+	requested = append(requested, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		requested = append(requested, ip.String())
+	}
+	sort.Strings(ordered)
+	sort.Strings(requested)
+	if strings.Join(ordered, ",") != strings.Join(requested, ",") {
+		return fmt.Errorf("CSR names %v do not match the order identifiers %v", requested, ordered)
+	}
+	return nil
+}
+
+// issue issues a certificate for the CSR from the intermediate CA and returns the PEM encoded chain
+func (s *Server) issue(csr *x509.CertificateRequest) ([]byte, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		DNSNames:     csr.DNSNames,
+		IPAddresses:  csr.IPAddresses,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if len(csr.DNSNames) > 0 {
+		template.Subject.CommonName = csr.DNSNames[0]
+	}
+	// The certificate never outlives the intermediate, like with the CA issuer
+	if template.NotAfter.After(s.intermediate.NotAfter) {
+		template.NotAfter = s.intermediate.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, s.intermediate, csr.PublicKey, s.intermediateKey)
+	if err != nil {
+		return nil, err
+	}
+	leaf := pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: der})
+	return append(leaf, s.intermediatePEM...), nil
+}
+
+func (s *Server) handleCertificate(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request := s.verify(w, r)
+	if request == nil {
+		return
+	}
+
+	chain, ok := s.certificates[request.URL]
+	if !ok {
+		s.writeProblem(w, http.StatusNotFound, "malformed", "certificate not found")
+		return
+	}
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	_, _ = w.Write(chain)
+}
+
+// DNSStub is an in-memory DNS zone that serves as both the DNS provider and the resolver of dns-01 challenges
+type DNSStub struct {
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+// NewDNSStub returns an empty DNSStub
+func NewDNSStub() *DNSStub {
+	return &DNSStub{records: map[string][]string{}}
+}
+
+// Present adds the value to the TXT record
+func (d *DNSStub) Present(_ context.Context, fqdn, value string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.records[fqdn] = append(d.records[fqdn], value)
+	return nil
+}
+
+// CleanUp removes the value from the TXT record
+func (d *DNSStub) CleanUp(_ context.Context, fqdn, value string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var values []string
+	for _, v := range d.records[fqdn] {
+		if v != value {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		delete(d.records, fqdn)
+	} else {
+		d.records[fqdn] = values
+	}
+	return nil
+}
+
+// LookupTXT returns the values of the TXT record
+func (d *DNSStub) LookupTXT(_ context.Context, name string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	values, ok := d.records[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return append([]string(nil), values...), nil
+}
+
+// Records returns the names of all TXT records
+func (d *DNSStub) Records() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	names := make([]string, 0, len(d.records))
+	for name := range d.records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
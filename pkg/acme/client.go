@@ -0,0 +1,406 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Order, authorization and challenge statuses
+const (
+	StatusPending     = "pending"
+	StatusReady       = "ready"
+	StatusProcessing  = "processing"
+	StatusValid       = "valid"
+	StatusInvalid     = "invalid"
+	StatusDeactivated = "deactivated"
+	StatusExpired     = "expired"
+	StatusRevoked     = "revoked"
+)
+
+// Challenge types
+const (
+	ChallengeHTTP01 = "http-01"
+	ChallengeDNS01  = "dns-01"
+)
+
+// Identifier types
+const (
+	IdentifierDNS = "dns"
+	IdentifierIP  = "ip"
+)
+
+// Directory holds the URLs of the ACME server resources
+type Directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+	RevokeCert string `json:"revokeCert,omitempty"`
+	KeyChange  string `json:"keyChange,omitempty"`
+}
+
+// Identifier is a name a certificate is ordered for
+type Identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Problem is an error returned by the ACME server
+type Problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// Error returns the type and detail of the problem
+func (p *Problem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Type, p.Detail)
+}
+
+// Order is a request for a certificate
+type Order struct {
+	// URL is the URL of the order, it is not part of the ACME resource
+	URL string `json:"-"`
+
+	Status         string       `json:"status"`
+	Expires        string       `json:"expires,omitempty"`
+	Identifiers    []Identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate,omitempty"`
+	Error          *Problem     `json:"error,omitempty"`
+}
+
+// Authorization is the proof of control over an identifier
+type Authorization struct {
+	// URL is the URL of the authorization, it is not part of the ACME resource
+	URL string `json:"-"`
+
+	Status     string      `json:"status"`
+	Identifier Identifier  `json:"identifier"`
+	Challenges []Challenge `json:"challenges"`
+	Wildcard   bool        `json:"wildcard,omitempty"`
+}
+
+// Challenge is a way to prove control over an identifier
+type Challenge struct {
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Status string   `json:"status"`
+	Token  string   `json:"token"`
+	Error  *Problem `json:"error,omitempty"`
+}
+
+// Client is a minimal RFC 8555 ACME client that signs its requests with an ECDSA P-256 account key
+type Client struct {
+	// DirectoryURL is the URL of the directory of the ACME server
+	DirectoryURL string
+
+	// Key is the account key
+	Key *ecdsa.PrivateKey
+
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+
+	// AccountURL is the URL of the account, it is set by Register
+	AccountURL string
+
+	mu        sync.Mutex
+	directory *Directory
+	nonces    []string
+}
+
+// httpClient returns the HTTP client that sends the requests
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Discover returns the directory of the ACME server, it is fetched once
+func (c *Client) Discover(ctx context.Context) (*Directory, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.directory != nil {
+		return c.directory, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.DirectoryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, responseError(res)
+	}
+
+	directory := &Directory{}
+	if err := json.NewDecoder(res.Body).Decode(directory); err != nil {
+		return nil, err
+	}
+	c.directory = directory
+	return directory, nil
+}
+
+// KeyAuthorization returns the key authorization of the challenge token for the account key
+func (c *Client) KeyAuthorization(token string) (string, error) {
+	jwk, err := NewJWK(c.Key.Public())
+	if err != nil {
+		return "", err
+	}
+	return token + "." + jwk.Thumbprint(), nil
+}
+
+// DNS01Record returns the name of the TXT record of a dns-01 challenge for the domain
+func DNS01Record(domain string) string {
+	return "_acme-challenge." + strings.TrimPrefix(domain, "*.")
+}
+
+// DNS01Value returns the value of the TXT record of a dns-01 challenge for the key authorization
+func DNS01Value(keyAuthorization string) string {
+	sum := sha256.Sum256([]byte(keyAuthorization))
+	return encode(sum[:])
+}
+
+// Register creates the account of the account key, or looks up the existing one, and sets AccountURL
+// The terms of service of the server are agreed to
+func (c *Client) Register(ctx context.Context, email string) error {
+	directory, err := c.Discover(ctx)
+	if err != nil {
+		return err
+	}
+
+	account := map[string]interface{}{
+		"termsOfServiceAgreed": true,
+	}
+	if email != "" {
+		account["contact"] = []string{"mailto:" + email}
+	}
+
+	// Accounts are created and looked up with the key embedded in the request instead of its account URL
+	c.mu.Lock()
+	c.AccountURL = ""
+	c.mu.Unlock()
+	res, _, err := c.post(ctx, directory.NewAccount, account, nil)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.AccountURL = res.Header.Get("Location")
+	if c.AccountURL == "" {
+		return errors.New("ACME server did not return the account URL")
+	}
+	return nil
+}
+
+// NewOrder orders a certificate for the identifiers
+func (c *Client) NewOrder(ctx context.Context, identifiers []Identifier) (*Order, error) {
+	directory, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order := &Order{}
+	res, _, err := c.post(ctx, directory.NewOrder, map[string]interface{}{"identifiers": identifiers}, order)
+	if err != nil {
+		return nil, err
+	}
+	order.URL = res.Header.Get("Location")
+	return order, nil
+}
+
+// GetOrder returns the order at the URL
+func (c *Client) GetOrder(ctx context.Context, url string) (*Order, error) {
+	order := &Order{}
+	if _, _, err := c.post(ctx, url, nil, order); err != nil {
+		return nil, err
+	}
+	order.URL = url
+	return order, nil
+}
+
+// GetAuthorization returns the authorization at the URL
+func (c *Client) GetAuthorization(ctx context.Context, url string) (*Authorization, error) {
+	authorization := &Authorization{}
+	if _, _, err := c.post(ctx, url, nil, authorization); err != nil {
+		return nil, err
+	}
+	authorization.URL = url
+	return authorization, nil
+}
+
+// GetChallenge returns the challenge at the URL
+func (c *Client) GetChallenge(ctx context.Context, url string) (*Challenge, error) {
+	challenge := &Challenge{}
+	if _, _, err := c.post(ctx, url, nil, challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// Accept tells the server that the challenge is ready to be validated
+func (c *Client) Accept(ctx context.Context, challenge *Challenge) (*Challenge, error) {
+	accepted := &Challenge{}
+	if _, _, err := c.post(ctx, challenge.URL, struct{}{}, accepted); err != nil {
+		return nil, err
+	}
+	return accepted, nil
+}
+
+// Finalize requests the certificate of a ready order with the DER encoded certificate signing request
+func (c *Client) Finalize(ctx context.Context, order *Order, csr []byte) (*Order, error) {
+	finalized := &Order{}
+	if _, _, err := c.post(ctx, order.Finalize, map[string]string{"csr": encode(csr)}, finalized); err != nil {
+		return nil, err
+	}
+	finalized.URL = order.URL
+	return finalized, nil
+}
+
+// FetchCertificate returns the PEM encoded certificate chain at the URL
+func (c *Client) FetchCertificate(ctx context.Context, url string) ([]byte, error) {
+	_, body, err := c.post(ctx, url, nil, nil)
+	return body, err
+}
+
+// post sends a signed request with the JSON encoded payload to the URL and decodes the response into out
+// A nil payload sends a POST-as-GET request, a request rejected for a bad nonce is retried once
+func (c *Client) post(ctx context.Context, url string, payload interface{}, out interface{}) (*http.Response, []byte, error) {
+	var data []byte
+	if payload != nil {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, body, err := c.send(ctx, url, data)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if res.StatusCode >= http.StatusBadRequest {
+			err := problemError(res, body)
+			var problem *Problem
+			if attempt == 0 && errors.As(err, &problem) && problem.Type == "urn:ietf:params:acme:error:badNonce" {
+				continue
+			}
+			return nil, nil, err
+		}
+
+		if out != nil {
+			if err := json.Unmarshal(body, out); err != nil {
+				return nil, nil, err
+			}
+		}
+		return res, body, nil
+	}
+}
+
+// send signs the data with a fresh nonce and sends it to the URL, the nonce of the response is kept for the next request
+func (c *Client) send(ctx context.Context, url string, data []byte) (*http.Response, []byte, error) {
+	nonce, err := c.nonce(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.mu.Lock()
+	keyID := c.AccountURL
+	c.mu.Unlock()
+	signed, err := signJWS(c.Key, keyID, nonce, url, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(signed))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	c.addNonce(res)
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, body, nil
+}
+
+// nonce returns a replay nonce from the pool, or a new one from the server when the pool is empty
+func (c *Client) nonce(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	if len(c.nonces) > 0 {
+		nonce := c.nonces[len(c.nonces)-1]
+		c.nonces = c.nonces[:len(c.nonces)-1]
+		c.mu.Unlock()
+		return nonce, nil
+	}
+	c.mu.Unlock()
+
+	directory, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, directory.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	nonce := res.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("ACME server did not return a nonce")
+	}
+	return nonce, nil
+}
+
+// addNonce adds the replay nonce of the response to the pool
+func (c *Client) addNonce(res *http.Response) {
+	if nonce := res.Header.Get("Replay-Nonce"); nonce != "" {
+		c.mu.Lock()
+		c.nonces = append(c.nonces, nonce)
+		c.mu.Unlock()
+	}
+}
+
+// responseError returns the error of an unsuccessful response
+func responseError(res *http.Response) error {
+	body, _ := io.ReadAll(res.Body)
+	return problemError(res, body)
+}
+
+// problemError returns the problem document of an unsuccessful response, or a generic error if it has none
+func problemError(res *http.Response, body []byte) error {
+	problem := &Problem{}
+	if err := json.Unmarshal(body, problem); err != nil || problem.Type == "" {
+		return fmt.Errorf("unexpected ACME response %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	if problem.Status == 0 {
+		problem.Status = res.StatusCode
+	}
+	return problem
+}
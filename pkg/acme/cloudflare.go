@@ -0,0 +1,146 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// cloudflareAPI is the base URL of the Cloudflare API
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// CloudflareProvider manages dns-01 TXT records in Cloudflare zones
+type CloudflareProvider struct {
+	// APIToken is an API token with the Zone:Read and DNS:Edit permissions
+	APIToken string
+
+	// BaseURL is the base URL of the Cloudflare API
+	BaseURL string
+
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+// newCloudflareProvider builds a CloudflareProvider from the api-token key of its configuration Secret
+func newCloudflareProvider(config map[string][]byte) (DNSProvider, error) {
+	token := strings.TrimSpace(string(config["api-token"]))
+	if token == "" {
+		return nil, errors.New("cloudflare DNS provider requires an api-token")
+	}
+	return &CloudflareProvider{APIToken: token, BaseURL: cloudflareAPI}, nil
+}
+
+// cloudflareResponse is the envelope of all Cloudflare API responses
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+// cloudflareRecord is a DNS record of a Cloudflare zone
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+// Present creates the TXT record in the zone that contains it
+func (p *CloudflareProvider) Present(ctx context.Context, fqdn, value string) error {
+	zoneID, err := p.findZone(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+
+	record := cloudflareRecord{Type: "TXT", Name: fqdn, Content: value, TTL: 120}
+	return p.do(ctx, http.MethodPost, "/zones/"+zoneID+"/dns_records", record, nil)
+}
+
+// CleanUp deletes the TXT records with the value
+func (p *CloudflareProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	zoneID, err := p.findZone(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"type": {"TXT"}, "name": {fqdn}, "content": {value}}
+	var records []cloudflareRecord
+	if err := p.do(ctx, http.MethodGet, "/zones/"+zoneID+"/dns_records?"+query.Encode(), nil, &records); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := p.do(ctx, http.MethodDelete, "/zones/"+zoneID+"/dns_records/"+record.ID, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findZone returns the ID of the most specific zone that contains the fqdn
+func (p *CloudflareProvider) findZone(ctx context.Context, fqdn string) (string, error) {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		name := strings.Join(labels[i:], ".")
+		if err := p.do(ctx, http.MethodGet, "/zones?"+url.Values{"name": {name}}.Encode(), nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("no Cloudflare zone found for %s", fqdn)
+}
+
+// do sends a request to the Cloudflare API and decodes the result into out
+func (p *CloudflareProvider) do(ctx context.Context, method, path string, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.BaseURL+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	response := cloudflareResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return fmt.Errorf("unexpected Cloudflare response %s: %w", res.Status, err)
+	}
+	if !response.Success {
+		var messages []string
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("Cloudflare request failed: %s", strings.Join(messages, ", "))
+	}
+	if out != nil {
+		return json.Unmarshal(response.Result, out)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK is the JSON Web Key of an ECDSA P-256 account key
+type JWK struct {
+	Curve   string `json:"crv"`
+	KeyType string `json:"kty"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// jwsHeader is the protected header of a request signed with an account key
+// The key is embedded as jwk before the account exists and referenced by its account URL as kid afterwards
+type jwsHeader struct {
+	Algorithm string `json:"alg"`
+	JWK       *JWK   `json:"jwk,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Nonce     string `json:"nonce"`
+	URL       string `json:"url"`
+}
+
+// jws is a JSON Web Signature in the flattened JSON serialization used by ACME
+type jws struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// encode returns the unpadded base64url encoding used throughout ACME
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// NewJWK returns the JSON Web Key of the public key, only ECDSA P-256 keys are supported
+func NewJWK(publicKey crypto.PublicKey) (*JWK, error) {
+	key, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return nil, errors.New("account keys must be ECDSA P-256 keys")
+	}
+	return &JWK{
+		Curve:   "P-256",
+		KeyType: "EC",
+		X:       encode(key.X.FillBytes(make([]byte, 32))),
+		Y:       encode(key.Y.FillBytes(make([]byte, 32))),
+	}, nil
+}
+
+// PublicKey returns the ECDSA public key of the JSON Web Key
+func (k *JWK) PublicKey() (*ecdsa.PublicKey, error) {
+	if k.KeyType != "EC" || k.Curve != "P-256" {
+		return nil, fmt.Errorf("unsupported JWK %s %s", k.KeyType, k.Curve)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+// Thumbprint returns the RFC 7638 thumbprint of the JSON Web Key
+// The members are serialized in lexicographic order without whitespace, as the RFC requires
+func (k *JWK) Thumbprint() string {
+	data := fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, k.Curve, k.KeyType, k.X, k.Y)
+	sum := sha256.Sum256([]byte(data))
+	return encode(sum[:])
+}
+
+// signJWS signs the payload for the URL with the account key
+// The key is referenced by keyID when it is set and embedded otherwise, a nil payload signs a POST-as-GET request
+func signJWS(key *ecdsa.PrivateKey, keyID, nonce, url string, payload []byte) ([]byte, error) {
+	header := jwsHeader{
+		Algorithm: "ES256",
+		KeyID:     keyID,
+		Nonce:     nonce,
+		URL:       url,
+	}
+	if keyID == "" {
+		jwk, err := NewJWK(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		header.JWK = jwk
+	}
+
+	protected, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	message := jws{
+		Protected: encode(protected),
+		Payload:   encode(payload),
+	}
+	digest := sha256.Sum256([]byte(message.Protected + "." + message.Payload))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	// ES256 signatures are the fixed size concatenation of r and s
+	message.Signature = encode(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))
+
+	return json.Marshal(message)
+}
+
+// SignedRequest is a verified request signed with an account key
+type SignedRequest struct {
+	// JWK is the embedded account key, only set for requests that create an account
+	JWK *JWK
+
+	// KeyID is the account URL of the key that signed the request
+	KeyID string
+
+	// Nonce is the replay nonce of the request
+	Nonce string
+
+	// URL is the URL the request was signed for
+	URL string
+
+	// Payload is the payload of the request, empty for POST-as-GET requests
+	Payload []byte
+}
+
+// VerifyJWS verifies a request signed with an account key
+// The key is taken from the embedded jwk or looked up by kid with the given function
+func VerifyJWS(body []byte, lookup func(keyID string) (*ecdsa.PublicKey, error)) (*SignedRequest, error) {
+	var message jws
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, err
+	}
+
+	protected, err := base64.RawURLEncoding.DecodeString(message.Protected)
+	if err != nil {
+		return nil, err
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(protected, &header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm != "ES256" {
+		return nil, fmt.Errorf("unsupported algorithm %q", header.Algorithm)
+	}
+
+	var publicKey *ecdsa.PublicKey
+	switch {
+	case header.JWK != nil && header.KeyID == "":
+		publicKey, err = header.JWK.PublicKey()
+	case header.JWK == nil && header.KeyID != "":
+		publicKey, err = lookup(header.KeyID)
+	default:
+		err = errors.New("exactly one of jwk and kid must be set")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(message.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if len(signature) != 64 {
+		return nil, errors.New("invalid signature length")
+	}
+	digest := sha256.Sum256([]byte(message.Protected + "." + message.Payload))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(publicKey, digest[:], r, s) {
+		return nil, errors.New("invalid signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(message.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedRequest{
+		JWK:     header.JWK,
+		KeyID:   header.KeyID,
+		Nonce:   header.Nonce,
+		URL:     header.URL,
+		Payload: payload,
+	}, nil
+}
@@ -0,0 +1,93 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// selfCheckHTTPTimeout is how long the key authorization of a http-01 challenge is fetched for
+const selfCheckHTTPTimeout = 10 * time.Second
+
+// Resolver looks up the TXT records of dns-01 challenges
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// SelfCheck checks that a presented challenge can be validated, before the ACME server is asked to validate it
+type SelfCheck struct {
+	// HTTP01 fetches the key authorization of a http-01 challenge, FetchHTTP01 when nil
+	HTTP01 func(ctx context.Context, domain, token string) (string, error)
+
+	// Resolver looks up the TXT records of dns-01 challenges, net.DefaultResolver when nil
+	Resolver Resolver
+}
+
+// Check returns an error until the key authorization of the challenge is served for the domain
+func (c *SelfCheck) Check(ctx context.Context, domain string, challenge *Challenge, keyAuthorization string) error {
+	switch challenge.Type {
+	case ChallengeHTTP01:
+		return c.checkHTTP01(ctx, domain, challenge.Token, keyAuthorization)
+	case ChallengeDNS01:
+		return c.checkDNS01(ctx, domain, keyAuthorization)
+	}
+	return fmt.Errorf("unsupported challenge type %s", challenge.Type)
+}
+
+// checkHTTP01 checks that the key authorization is served for the token
+func (c *SelfCheck) checkHTTP01(ctx context.Context, domain, token, keyAuthorization string) error {
+	fetch := c.HTTP01
+	if fetch == nil {
+		fetch = FetchHTTP01
+	}
+	value, err := fetch(ctx, domain, token)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(value) != keyAuthorization {
+		return fmt.Errorf("key authorization %q served for %s does not match", value, domain)
+	}
+	return nil
+}
+
+// checkDNS01 checks that the TXT record of the domain holds the digest of the key authorization
+func (c *SelfCheck) checkDNS01(ctx context.Context, domain, keyAuthorization string) error {
+	var resolver Resolver = net.DefaultResolver
+	if c.Resolver != nil {
+		resolver = c.Resolver
+	}
+	record := DNS01Record(domain)
+	values, err := resolver.LookupTXT(ctx, record)
+	if err != nil {
+		return err
+	}
+	expected := DNS01Value(keyAuthorization)
+	for _, value := range values {
+		if value == expected {
+			return nil
+		}
+	}
+	return fmt.Errorf("no TXT record %s with the expected value found", record)
+}
+
+// FetchHTTP01 fetches the key authorization from the well-known path of the domain
+func FetchHTTP01(ctx context.Context, domain, token string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+domain+"/.well-known/acme-challenge/"+token, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := (&http.Client{Timeout: selfCheckHTTPTimeout}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s fetching the key authorization for %s", res.Status, domain)
+	}
+	body, err := io.ReadAll(res.Body)
+	return string(body), err
+}
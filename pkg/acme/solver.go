@@ -0,0 +1,73 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Solver fulfils the challenges of one challenge type
+type Solver interface {
+	// Present makes the key authorization of the challenge available to the ACME server
+	Present(ctx context.Context, domain string, challenge *Challenge, keyAuthorization string) error
+
+	// CleanUp removes everything Present created for the challenge
+	CleanUp(ctx context.Context, domain string, challenge *Challenge, keyAuthorization string) error
+}
+
+// DNSProvider creates and deletes the TXT records of dns-01 challenges
+type DNSProvider interface {
+	// Present creates the TXT record with the value
+	Present(ctx context.Context, fqdn, value string) error
+
+	// CleanUp deletes the TXT record with the value, other values of the record are kept
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// DNSProviderFactory builds a DNSProvider from the data of its configuration Secret
+type DNSProviderFactory func(config map[string][]byte) (DNSProvider, error)
+
+// dnsProviders maps the name of every DNS provider to its factory
+// Adding a provider only requires registering it here
+var dnsProviders = map[string]DNSProviderFactory{
+	"cloudflare": newCloudflareProvider,
+}
+
+// RegisterDNSProvider registers a DNS provider under the name, replacing any provider of the same name
+func RegisterDNSProvider(name string, factory DNSProviderFactory) {
+	dnsProviders[name] = factory
+}
+
+// DNSProviders returns the names of the registered DNS providers
+func DNSProviders() []string {
+	names := make([]string, 0, len(dnsProviders))
+	for name := range dnsProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewDNSProvider builds the DNS provider registered under the name
+func NewDNSProvider(name string, config map[string][]byte) (DNSProvider, error) {
+	factory, ok := dnsProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown DNS provider %q, registered providers are %v", name, DNSProviders())
+	}
+	return factory(config)
+}
+
+// DNS01Solver solves dns-01 challenges with the TXT records of a DNSProvider
+type DNS01Solver struct {
+	Provider DNSProvider
+}
+
+// Present creates the TXT record of the challenge
+func (s *DNS01Solver) Present(ctx context.Context, domain string, _ *Challenge, keyAuthorization string) error {
+	return s.Provider.Present(ctx, DNS01Record(domain), DNS01Value(keyAuthorization))
+}
+
+// CleanUp deletes the TXT record of the challenge
+func (s *DNS01Solver) CleanUp(ctx context.Context, domain string, _ *Challenge, keyAuthorization string) error {
+	return s.Provider.CleanUp(ctx, DNS01Record(domain), DNS01Value(keyAuthorization))
+}
@@ -0,0 +1,211 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNS01Record(t *testing.T) {
+	tests := []struct {
+		name     string
+		domain   string
+		expected string
+	}{
+		{
+			name:     "Domain",
+			domain:   "example.k8c.io",
+			expected: "_acme-challenge.example.k8c.io",
+		},
+		{
+			name:     "Wildcard domain shares the record of its base domain",
+			domain:   "*.example.k8c.io",
+			expected: "_acme-challenge.example.k8c.io",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DNS01Record(tt.domain))
+		})
+	}
+}
+
+func TestNewDNSProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		config   map[string][]byte
+		wantErr  bool
+	}{
+		{
+			name:     "Cloudflare provider",
+			provider: "cloudflare",
+			config:   map[string][]byte{"api-token": []byte("token\n")},
+		},
+		{
+			name:     "Cloudflare provider without token",
+			provider: "cloudflare",
+			wantErr:  true,
+		},
+		{
+			name:     "Unknown provider",
+			provider: "unknown",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := NewDNSProvider(tt.provider, tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, provider)
+		})
+	}
+}
+
+func TestCloudflareProvider(t *testing.T) {
+	// The fake API serves the k8c.io zone and keeps its records in memory
+	var mu sync.Mutex
+	records := map[string]cloudflareRecord{}
+	mux := http.NewServeMux()
+	respond := func(w http.ResponseWriter, result interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": result})
+	}
+	mux.HandleFunc("/zones", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") == "k8c.io" {
+			respond(w, []map[string]string{{"id": "zone"}})
+			return
+		}
+		respond(w, []map[string]string{})
+	})
+	mux.HandleFunc("/zones/zone/dns_records", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPost {
+			record := cloudflareRecord{}
+			_ = json.NewDecoder(r.Body).Decode(&record)
+			record.ID = record.Content
+			records[record.ID] = record
+			respond(w, record)
+			return
+		}
+		var matching []cloudflareRecord
+		for _, record := range records {
+			if record.Name == r.URL.Query().Get("name") && record.Content == r.URL.Query().Get("content") {
+				matching = append(matching, record)
+			}
+		}
+		respond(w, matching)
+	})
+	mux.HandleFunc("/zones/zone/dns_records/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, http.MethodDelete, r.Method)
+		delete(records, r.URL.Path[len("/zones/zone/dns_records/"):])
+		respond(w, nil)
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		mux.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	provider := &CloudflareProvider{APIToken: "token", BaseURL: server.URL}
+	ctx := context.Background()
+
+	assert.NoError(t, provider.Present(ctx, "_acme-challenge.www.k8c.io", "first"))
+	assert.NoError(t, provider.Present(ctx, "_acme-challenge.www.k8c.io", "second"))
+	assert.Len(t, records, 2)
+
+	// Only the record with the value is deleted
+	assert.NoError(t, provider.CleanUp(ctx, "_acme-challenge.www.k8c.io", "first"))
+	assert.Len(t, records, 1)
+	assert.Contains(t, records, "second")
+
+	assert.Error(t, provider.Present(ctx, "_acme-challenge.example.com", "value"), "Names outside the zones should fail")
+}
+
+// txtRecords resolves the TXT records of a map
+type txtRecords map[string][]string
+
+func (r txtRecords) LookupTXT(_ context.Context, name string) ([]string, error) {
+	return r[name], nil
+}
+
+func TestSelfCheck(t *testing.T) {
+	// The fake solver serves the key authorization of the token "served" only
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/acme-challenge/served" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("served.thumbprint\n"))
+	}))
+	defer server.Close()
+	domain := strings.TrimPrefix(server.URL, "http://")
+	check := &SelfCheck{Resolver: txtRecords{DNS01Record("www.k8c.io"): {"other", DNS01Value("dns.thumbprint")}}}
+
+	tests := []struct {
+		name             string
+		domain           string
+		challenge        Challenge
+		keyAuthorization string
+		wantErr          bool
+	}{
+		{
+			name:             "Served http-01 key authorization",
+			domain:           domain,
+			challenge:        Challenge{Type: ChallengeHTTP01, Token: "served"},
+			keyAuthorization: "served.thumbprint",
+		},
+		{
+			name:             "Wrong http-01 key authorization",
+			domain:           domain,
+			challenge:        Challenge{Type: ChallengeHTTP01, Token: "served"},
+			keyAuthorization: "served.other",
+			wantErr:          true,
+		},
+		{
+			name:             "Missing http-01 key authorization",
+			domain:           domain,
+			challenge:        Challenge{Type: ChallengeHTTP01, Token: "missing"},
+			keyAuthorization: "missing.thumbprint",
+			wantErr:          true,
+		},
+		{
+			name:             "Propagated TXT record of a wildcard domain",
+			domain:           "*.www.k8c.io",
+			challenge:        Challenge{Type: ChallengeDNS01},
+			keyAuthorization: "dns.thumbprint",
+		},
+		{
+			name:             "TXT record that has not propagated",
+			domain:           "api.k8c.io",
+			challenge:        Challenge{Type: ChallengeDNS01},
+			keyAuthorization: "dns.thumbprint",
+			wantErr:          true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := check.Check(context.Background(), tt.domain, &tt.challenge, tt.keyAuthorization)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
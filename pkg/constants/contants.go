@@ -2,30 +2,154 @@ package constants
 
 const (
 	// Certificate generation constants
-	TypeCertificate = "CERTIFICATE"
-	TypePrivateKey  = "RSA PRIVATE KEY"
+	TypeCertificate        = "CERTIFICATE"
+	TypeRSAPrivateKey      = "RSA PRIVATE KEY"
+	TypeECPrivateKey       = "EC PRIVATE KEY"
+	TypePKCS8PrivateKey    = "PRIVATE KEY"
+	TypeCertificateRequest = "CERTIFICATE REQUEST"
+
+	// Private key algorithms
+	KeyAlgorithmRSA     = "RSA"
+	KeyAlgorithmECDSA   = "ECDSA"
+	KeyAlgorithmEd25519 = "Ed25519"
+
+	// Private key encodings
+	KeyEncodingPKCS1 = "PKCS1"
+	KeyEncodingPKCS8 = "PKCS8"
+
+	// Issuer kinds
+	KindIssuer        = "Issuer"
+	KindClusterIssuer = "ClusterIssuer"
+
+	// Issuer types
+	IssuerTypeSelfSigned = "selfSigned"
+	IssuerTypeCA         = "ca"
+	IssuerTypeACME       = "acme"
+	IssuerTypeVault      = "vault"
+	IssuerTypeWebhook    = "webhook"
+
+	// Key usages
+	UsageDigitalSignature  = "digital signature"
+	UsageContentCommitment = "content commitment"
+	UsageKeyEncipherment   = "key encipherment"
+	UsageDataEncipherment  = "data encipherment"
+	UsageKeyAgreement      = "key agreement"
+	UsageCertSign          = "cert sign"
+	UsageCRLSign           = "crl sign"
+	UsageEncipherOnly      = "encipher only"
+	UsageDecipherOnly      = "decipher only"
+
+	// Extended key usages
+	UsageAny             = "any"
+	UsageServerAuth      = "server auth"
+	UsageClientAuth      = "client auth"
+	UsageCodeSigning     = "code signing"
+	UsageEmailProtection = "email protection"
+	UsageIPSecEndSystem  = "ipsec end system"
+	UsageIPSecTunnel     = "ipsec tunnel"
+	UsageIPSecUser       = "ipsec user"
+	UsageTimestamping    = "timestamping"
+	UsageOCSPSigning     = "ocsp signing"
+
+	// AnnotationSpecHash is the Secret annotation holding the hash of the spec the certificate was issued for
+	AnnotationSpecHash = "certs.k8c.io/spec-hash"
+
+	// AnnotationKeystoreHash is the Secret annotation holding the hash of the certificate and passwords the keystores were written for
+	AnnotationKeystoreHash = "certs.k8c.io/keystore-hash"
+
+	// AnnotationSecretTemplate is the Secret annotation listing the labels, annotations and key aliases set by the secret template
+	AnnotationSecretTemplate = "certs.k8c.io/secret-template"
+
+	// AnnotationChecksumPrefix prefixes the pod template annotation holding the checksum of a Secret used by a workload
+	AnnotationChecksumPrefix = "checksum.certs.k8c.io/"
+
+	// AnnotationReload set to "false" on a workload opts it out of reloads
+	AnnotationReload = "certs.k8c.io/reload"
+
+	// AnnotationReloadCertificates on a workload holds a comma separated list of Certificates it is reloaded for,
+	// even when they do not set ReloadOnChange
+	AnnotationReloadCertificates = "certs.k8c.io/reload-certificates"
+
+	// LabelCertificateName labels the CertificateRequests and Secret replicas of a Certificate with its name
+	LabelCertificateName = "certs.k8c.io/certificate-name"
+
+	// AnnotationCertificateRevision on a CertificateRequest is the revision of the Certificate it was created for
+	AnnotationCertificateRevision = "certs.k8c.io/certificate-revision"
+
+	// AnnotationPrivateKeySecretName on a CertificateRequest names the Secret holding the private key of the CSR in tls.key
+	// Only self-signed requests need it, no other issuer reads the private key
+	AnnotationPrivateKeySecretName = "certs.k8c.io/private-key-secret-name"
+
+	// LabelACMEHTTP01Solver labels the Pod, Service and Ingress that solve a http-01 challenge
+	LabelACMEHTTP01Solver = "certs.k8c.io/acme-http01-solver"
+
+	// LabelReplicaSourceNamespace labels the Secret replicas of a Certificate with the namespace of the Certificate
+	LabelReplicaSourceNamespace = "certs.k8c.io/replica-source-namespace"
+
+	// LabelBundleName labels the ConfigMaps a Bundle is written to with its name
+	LabelBundleName = "certs.k8c.io/bundle-name"
+
+	// AnnotationBundleHash is the ConfigMap annotation holding the hash of the certificates and formats the bundle was written for
+	AnnotationBundleHash = "certs.k8c.io/bundle-hash"
+
+	// Reload modes
+	ReloadModeAnnotation = "Annotation"
+	ReloadModeEnv        = "Env"
 
 	// Finalizer
 	Finalizer = "certs.k8c.io/certificate"
 
 	// Certificate status
 	StatusReconciling = "Reconciling"
+	StatusIssuing     = "Issuing"
 	StatusRotating    = "Rotating"
 	StatusDeleting    = "Deleting"
 	StatusExpired     = "Expired"
 	StatusDeployed    = "Deployed"
+	StatusInvalid     = "Invalid"
+	StatusFailed      = "Failed"
+	StatusConflict    = "Conflict"
 
 	// Certificate status message
 	StatusMessageReconciling = "Certificate is being processed"
-	StatusMessageRotating    = "Certificate is expired, Regenerating.."
+	StatusMessageIssuing     = "Certificate is being issued"
+	StatusMessageRotating    = "Certificate is due for renewal, Regenerating.."
 	StatusMessageDeleting    = "Certificate is being deleted"
 	StatusMessageExpired     = "Certificate is expired"
 	StatusMessageDeployed    = "Certificate deployed successfully"
 
+	// Certificate condition types
+	ConditionReady    = "Ready"
+	ConditionIssuing  = "Issuing"
+	ConditionExpiring = "Expiring"
+	ConditionExpired  = "Expired"
+
+	// Certificate condition reasons
+	ReasonIssued      = "Issued"
+	ReasonIssuing     = "Issuing"
+	ReasonRenewing    = "Renewing"
+	ReasonValid       = "Valid"
+	ReasonExpiring    = "Expiring"
+	ReasonExpired     = "Expired"
+	ReasonInvalidSpec = "InvalidSpec"
+	ReasonFailed      = "Failed"
+	ReasonConflict    = "Conflict"
+	ReasonDeleting    = "Deleting"
+
+	// CertificateRequest condition types
+	ConditionApproved = "Approved"
+	ConditionDenied   = "Denied"
+
+	// CertificateRequest condition reasons
+	ReasonApproved       = "Approved"
+	ReasonAutoApproved   = "AutoApproved"
+	ReasonDenied         = "Denied"
+	ReasonPending        = "Pending"
+	ReasonInvalidRequest = "InvalidRequest"
+
+	// Bundle condition reasons
+	ReasonSynced = "Synced"
+
 	// Certificate ENV
 	CertificateENVName = "CERTIFICATE_RESOURCE_VERSION"
-
-	// Event types
-	EventCreate = "CREATE"
-	EventUpdate = "UPDATE"
 )
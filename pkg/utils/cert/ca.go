@@ -0,0 +1,107 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+)
+
+// CASigner signs certificates with a CA key pair
+type CASigner struct {
+	// Certificate is the CA certificate that signs the certificates
+	Certificate *x509.Certificate
+
+	// PrivateKey is the private key of the CA certificate
+	PrivateKey crypto.Signer
+
+	// Chain is the PEM encoded CA certificate followed by any intermediates up to the root
+	Chain []byte
+
+	// Root is the PEM encoded root certificate of the chain
+	Root []byte
+}
+
+// NewCASigner returns a CASigner for the given PEM encoded CA key pair
+// The CA certificate may be followed by its intermediates, caPEM optionally holds the root certificate
+func NewCASigner(certPEM, keyPEM, caPEM []byte) (*CASigner, error) {
+	certificates, err := ParseCertificates(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	caCert := certificates[0]
+
+	if !caCert.IsCA {
+		return nil, errors.New("certificate is not a CA")
+	}
+	if caCert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, errors.New("CA certificate is not allowed to sign certificates")
+	}
+
+	privateKey, err := ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if !publicKeysEqual(caCert.PublicKey, privateKey.Public()) {
+		return nil, errors.New("private key does not match the CA certificate")
+	}
+
+	// The root of the chain is the last certificate unless it is given explicitly
+	root := caPEM
+	if len(bytes.TrimSpace(root)) == 0 {
+		root = pem.EncodeToMemory(&pem.Block{
+			Type:  constants.TypeCertificate,
+			Bytes: certificates[len(certificates)-1].Raw,
+		})
+	}
+
+	var chain []byte
+	for _, certificate := range certificates {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{
+			Type:  constants.TypeCertificate,
+			Bytes: certificate.Raw,
+		})...)
+	}
+
+	return &CASigner{
+		Certificate: caCert,
+		PrivateKey:  privateKey,
+		Chain:       chain,
+		Root:        root,
+	}, nil
+}
+
+// Sign issues a certificate signed by the CA for the given request
+// The certificate never outlives the CA certificate
+func (s *CASigner) Sign(_ context.Context, request *SigningRequest) (*SignedCertificate, error) {
+	template := *request.Template
+	if template.NotAfter.After(s.Certificate.NotAfter) {
+		template.NotAfter = s.Certificate.NotAfter
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, &template, s.Certificate, request.PublicKey, s.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  constants.TypeCertificate,
+		Bytes: certBytes,
+	})
+
+	return &SignedCertificate{
+		Certificate: append(certPEM, s.Chain...),
+		CA:          s.Root,
+	}, nil
+}
+
+// publicKeysEqual reports whether both public keys are the same
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
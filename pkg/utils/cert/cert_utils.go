@@ -2,77 +2,152 @@ package cert
 
 import (
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"math/big"
+	"net"
+	"net/url"
 	"time"
 
 	"github.com/sheryarbutt/certificate-manager/pkg/constants"
 )
 
-// GetTemplate returns a x509.Certificate template with the given DNS name and validity
-func GetTemplate(dnsName string, validity time.Duration) x509.Certificate {
-	return x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		Subject: pkix.Name{
-			CommonName: dnsName,
-		},
-		DNSNames:  []string{dnsName},
-		NotBefore: time.Now(),
-		NotAfter:  time.Now().Add(validity),
-		KeyUsage:  x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage: []x509.ExtKeyUsage{
-			x509.ExtKeyUsageServerAuth,
-		},
-		BasicConstraintsValid: true,
+// TemplateOptions holds the values a certificate template is built from
+type TemplateOptions struct {
+	// CommonName is the common name of the certificate subject
+	CommonName string
+
+	// Subject holds the remaining fields of the certificate subject, its CommonName is overridden
+	Subject pkix.Name
+
+	// DNSNames are the DNS subject alternative names
+	DNSNames []string
+
+	// IPAddresses are the IP address subject alternative names
+	IPAddresses []net.IP
+
+	// URIs are the URI subject alternative names
+	URIs []*url.URL
+
+	// EmailAddresses are the email subject alternative names
+	EmailAddresses []string
+
+	// Validity is the time until the certificate expires
+	Validity time.Duration
+
+	// Usages are the names of the key usages and extended key usages, DefaultUsages when empty
+	Usages []string
+
+	// IsCA marks the certificate as a CA that may sign certificates
+	IsCA bool
+
+	// MaxPathLen is the maximum number of intermediate CAs below a CA certificate, unlimited when nil
+	MaxPathLen *int
+}
+
+// serialNumberLimit is the exclusive upper bound of generated serial numbers, giving 128-bit serials
+var serialNumberLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+
+// NewSerialNumber returns a random, positive 128-bit certificate serial number
+func NewSerialNumber() (*big.Int, error) {
+	for {
+		serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+		if err != nil {
+			return nil, err
+		}
+		// Serial numbers must be positive
+		if serialNumber.Sign() > 0 {
+			return serialNumber, nil
+		}
 	}
 }
 
-// GenerateSelfSignedCertificate generates a self-signed certificate for the given DNS name
-func CreateSelfSignedCertificate(dnsName string, validity time.Duration) ([]byte, []byte, error) {
-	// Generate a new private key
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+// GetTemplate returns a x509.Certificate template with the given subject, names and validity and a random serial number
+func GetTemplate(opts TemplateOptions) (x509.Certificate, error) {
+	serialNumber, err := NewSerialNumber()
 	if err != nil {
-		return nil, nil, err
+		return x509.Certificate{}, err
 	}
 
-	// Create a template for the certificate
-	template := GetTemplate(dnsName, validity)
+	subject := opts.Subject
+	subject.CommonName = opts.CommonName
 
-	// Create the self-signed certificate
-	certBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	usages := opts.Usages
+	if len(usages) == 0 {
+		usages = DefaultUsages
+	}
+	keyUsage, extKeyUsage, err := ParseUsages(usages)
 	if err != nil {
-		return nil, nil, err
+		return x509.Certificate{}, err
 	}
 
-	// PEM encode the certificate
-	certPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  constants.TypeCertificate,
-		Bytes: certBytes,
-	})
+	// A CA certificate must be allowed to sign certificates
+	if opts.IsCA {
+		keyUsage |= x509.KeyUsageCertSign
+	}
 
-	// PEM encode the private key
-	keyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  constants.TypePrivateKey,
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	})
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject,
+		DNSNames:              opts.DNSNames,
+		IPAddresses:           opts.IPAddresses,
+		URIs:                  opts.URIs,
+		EmailAddresses:        opts.EmailAddresses,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(opts.Validity),
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           extKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  opts.IsCA,
+	}
+	if opts.MaxPathLen != nil {
+		template.MaxPathLen = *opts.MaxPathLen
+		template.MaxPathLenZero = *opts.MaxPathLen == 0
+	}
 
-	return certPEM, keyPEM, nil
+	return template, nil
 }
 
-// IsCertificateExpired checks if the given certificate is expired
-func IsCertificateExpired(cert []byte) (bool, error) {
-	pemBlock, _ := pem.Decode(cert)
-	if pemBlock == nil {
-		return false, nil
+// ParseCertificates parses all PEM encoded certificates in the given bytes
+func ParseCertificates(certPEM []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for {
+		var pemBlock *pem.Block
+		pemBlock, certPEM = pem.Decode(certPEM)
+		if pemBlock == nil {
+			break
+		}
+		if pemBlock.Type != constants.TypeCertificate {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(pemBlock.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
 	}
 
-	certificate, err := x509.ParseCertificate(pemBlock.Bytes)
-	if err != nil {
-		return false, err
+	if len(certificates) == 0 {
+		return nil, errors.New("no PEM encoded certificate found")
 	}
+	return certificates, nil
+}
 
-	return time.Now().After(certificate.NotAfter), nil
+// ChainCA returns the PEM encoded CA certificate at the top of the PEM encoded certificate chain
+// It is nil when the chain only holds the certificate itself
+func ChainCA(chainPEM []byte) ([]byte, error) {
+	certificates, err := ParseCertificates(chainPEM)
+	if err != nil {
+		return nil, err
+	}
+	if len(certificates) < 2 {
+		return nil, nil
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  constants.TypeCertificate,
+		Bytes: certificates[len(certificates)-1].Raw,
+	}), nil
 }
@@ -0,0 +1,70 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+)
+
+// Fingerprint returns the SHA-256 fingerprint of the certificate as colon separated hex bytes
+func Fingerprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return colonHex(sum[:])
+}
+
+// SerialNumber returns the serial number of the certificate as colon separated hex bytes
+func SerialNumber(certificate *x509.Certificate) string {
+	serial := certificate.SerialNumber.Bytes()
+	if len(serial) == 0 {
+		return "00"
+	}
+	return colonHex(serial)
+}
+
+// KeyAlgorithm returns the algorithm and size in bits of the public key of the certificate
+func KeyAlgorithm(certificate *x509.Certificate) (string, int) {
+	switch publicKey := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return constants.KeyAlgorithmRSA, publicKey.N.BitLen()
+	case *ecdsa.PublicKey:
+		return constants.KeyAlgorithmECDSA, publicKey.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return constants.KeyAlgorithmEd25519, 0
+	default:
+		return certificate.PublicKeyAlgorithm.String(), 0
+	}
+}
+
+// SubjectAlternativeNames returns the subject alternative names of the certificate
+// prefixed with their type in the form used by openssl, such as "DNS:example.k8c.io"
+func SubjectAlternativeNames(certificate *x509.Certificate) []string {
+	var names []string
+	for _, dnsName := range certificate.DNSNames {
+		names = append(names, "DNS:"+dnsName)
+	}
+	for _, ip := range certificate.IPAddresses {
+		names = append(names, "IP:"+ip.String())
+	}
+	for _, uri := range certificate.URIs {
+		names = append(names, "URI:"+uri.String())
+	}
+	for _, email := range certificate.EmailAddresses {
+		names = append(names, "email:"+email)
+	}
+	return names
+}
+
+// colonHex formats the bytes as upper case hex separated by colons
+func colonHex(data []byte) string {
+	hexBytes := make([]string, len(data))
+	for i, b := range data {
+		hexBytes[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hexBytes, ":")
+}
@@ -0,0 +1,125 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+)
+
+// KeyOptions holds the values a private key is generated and encoded with
+type KeyOptions struct {
+	// Algorithm is the private key algorithm, RSA if empty
+	Algorithm string
+
+	// Size is the key size in bits, 0 selects the default size of the algorithm
+	Size int
+
+	// Encoding is the private key encoding, PKCS1 if empty
+	Encoding string
+}
+
+// GeneratePrivateKey generates a private key with the given algorithm and size in bits
+// An empty algorithm selects RSA and a size of 0 selects the default size of the algorithm
+func GeneratePrivateKey(algorithm string, size int) (crypto.Signer, error) {
+	switch algorithm {
+	case constants.KeyAlgorithmRSA, "":
+		if size == 0 {
+			size = 2048
+		}
+		if size != 2048 && size != 3072 && size != 4096 {
+			return nil, fmt.Errorf("unsupported RSA key size %d, must be 2048, 3072 or 4096", size)
+		}
+		return rsa.GenerateKey(rand.Reader, size)
+	case constants.KeyAlgorithmECDSA:
+		var curve elliptic.Curve
+		switch size {
+		case 256, 0:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported ECDSA key size %d, must be 256 or 384", size)
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case constants.KeyAlgorithmEd25519:
+		if size != 0 {
+			return nil, errors.New("Ed25519 keys do not have a configurable size")
+		}
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	default:
+		return nil, fmt.Errorf("unsupported private key algorithm %q", algorithm)
+	}
+}
+
+// EncodePrivateKey PEM encodes the private key with the given encoding
+// PKCS1 encodes ECDSA keys as SEC 1, Ed25519 keys are always encoded as PKCS8
+func EncodePrivateKey(privateKey crypto.Signer, encoding string) ([]byte, error) {
+	var pemBlock *pem.Block
+	switch encoding {
+	case constants.KeyEncodingPKCS1, "":
+		switch key := privateKey.(type) {
+		case *rsa.PrivateKey:
+			pemBlock = &pem.Block{Type: constants.TypeRSAPrivateKey, Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		case *ecdsa.PrivateKey:
+			keyBytes, err := x509.MarshalECPrivateKey(key)
+			if err != nil {
+				return nil, err
+			}
+			pemBlock = &pem.Block{Type: constants.TypeECPrivateKey, Bytes: keyBytes}
+		case ed25519.PrivateKey:
+			return EncodePrivateKey(privateKey, constants.KeyEncodingPKCS8)
+		default:
+			return nil, fmt.Errorf("unsupported private key %T", privateKey)
+		}
+	case constants.KeyEncodingPKCS8:
+		keyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		pemBlock = &pem.Block{Type: constants.TypePKCS8PrivateKey, Bytes: keyBytes}
+	default:
+		return nil, fmt.Errorf("unsupported private key encoding %q", encoding)
+	}
+
+	return pem.EncodeToMemory(pemBlock), nil
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS#1, PKCS#8 or SEC 1 private key
+func ParsePrivateKey(keyPEM []byte) (crypto.Signer, error) {
+	pemBlock, _ := pem.Decode(keyPEM)
+	if pemBlock == nil {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+
+	var key interface{}
+	var err error
+	switch pemBlock.Type {
+	case constants.TypeRSAPrivateKey:
+		key, err = x509.ParsePKCS1PrivateKey(pemBlock.Bytes)
+	case constants.TypeECPrivateKey:
+		key, err = x509.ParseECPrivateKey(pemBlock.Bytes)
+	case constants.TypePKCS8PrivateKey:
+		key, err = x509.ParsePKCS8PrivateKey(pemBlock.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported private key type %q", pemBlock.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key %T", key)
+	}
+	return signer, nil
+}
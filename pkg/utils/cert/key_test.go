@@ -0,0 +1,115 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+)
+
+func TestGenerateAndEncodePrivateKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		algorithm   string
+		size        int
+		encoding    string
+		expectedPEM string
+		wantErr     bool
+	}{
+		{
+			name:        "Default RSA key",
+			expectedPEM: constants.TypeRSAPrivateKey,
+		},
+		{
+			name:        "RSA 3072 PKCS8 key",
+			algorithm:   constants.KeyAlgorithmRSA,
+			size:        3072,
+			encoding:    constants.KeyEncodingPKCS8,
+			expectedPEM: constants.TypePKCS8PrivateKey,
+		},
+		{
+			name:        "ECDSA P-256 PKCS1 key",
+			algorithm:   constants.KeyAlgorithmECDSA,
+			encoding:    constants.KeyEncodingPKCS1,
+			expectedPEM: constants.TypeECPrivateKey,
+		},
+		{
+			name:        "ECDSA P-384 PKCS8 key",
+			algorithm:   constants.KeyAlgorithmECDSA,
+			size:        384,
+			encoding:    constants.KeyEncodingPKCS8,
+			expectedPEM: constants.TypePKCS8PrivateKey,
+		},
+		{
+			name:        "Ed25519 key is always PKCS8",
+			algorithm:   constants.KeyAlgorithmEd25519,
+			encoding:    constants.KeyEncodingPKCS1,
+			expectedPEM: constants.TypePKCS8PrivateKey,
+		},
+		{
+			name:      "Invalid RSA key size",
+			algorithm: constants.KeyAlgorithmRSA,
+			size:      1024,
+			wantErr:   true,
+		},
+		{
+			name:      "Invalid ECDSA key size",
+			algorithm: constants.KeyAlgorithmECDSA,
+			size:      521,
+			wantErr:   true,
+		},
+		{
+			name:      "Ed25519 key with size",
+			algorithm: constants.KeyAlgorithmEd25519,
+			size:      256,
+			wantErr:   true,
+		},
+		{
+			name:      "Unknown algorithm",
+			algorithm: "DSA",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			privateKey, err := GeneratePrivateKey(tt.algorithm, tt.size)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			keyPEM, err := EncodePrivateKey(privateKey, tt.encoding)
+			assert.NoError(t, err)
+
+			pemBlock, _ := pem.Decode(keyPEM)
+			assert.NotNil(t, pemBlock)
+			assert.Equal(t, tt.expectedPEM, pemBlock.Type)
+
+			// The encoded key should parse back into the same key
+			parsed, err := ParsePrivateKey(keyPEM)
+			assert.NoError(t, err)
+			assert.True(t, publicKeysEqual(privateKey.Public(), parsed.Public()))
+		})
+	}
+}
+
+func TestGeneratePrivateKeySizes(t *testing.T) {
+	rsaKey, err := GeneratePrivateKey(constants.KeyAlgorithmRSA, 4096)
+	assert.NoError(t, err)
+	assert.Equal(t, 4096, rsaKey.(*rsa.PrivateKey).N.BitLen())
+
+	ecdsaKey, err := GeneratePrivateKey(constants.KeyAlgorithmECDSA, 384)
+	assert.NoError(t, err)
+	assert.Equal(t, "P-384", ecdsaKey.(*ecdsa.PrivateKey).Curve.Params().Name)
+
+	ed25519Key, err := GeneratePrivateKey(constants.KeyAlgorithmEd25519, 0)
+	assert.NoError(t, err)
+	assert.IsType(t, ed25519.PrivateKey{}, ed25519Key)
+}
@@ -0,0 +1,89 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+)
+
+// CreateCertificateRequest returns a PEM encoded CSR for the subject and names of the template options
+// signed by the private key, the remaining options are left to the signer of the CSR
+func CreateCertificateRequest(privateKey crypto.Signer, opts TemplateOptions) ([]byte, error) {
+	subject := opts.Subject
+	subject.CommonName = opts.CommonName
+
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        subject,
+		DNSNames:       opts.DNSNames,
+		IPAddresses:    opts.IPAddresses,
+		URIs:           opts.URIs,
+		EmailAddresses: opts.EmailAddresses,
+	}, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  constants.TypeCertificateRequest,
+		Bytes: csrBytes,
+	}), nil
+}
+
+// ParseCertificateRequest parses a PEM encoded CSR and checks that it is signed by the key it requests a certificate for
+func ParseCertificateRequest(csrPEM []byte) (*x509.CertificateRequest, error) {
+	pemBlock, _ := pem.Decode(csrPEM)
+	if pemBlock == nil || pemBlock.Type != constants.TypeCertificateRequest {
+		return nil, errors.New("no PEM encoded certificate request found")
+	}
+
+	csr, err := x509.ParseCertificateRequest(pemBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+	return csr, nil
+}
+
+// GetRequestTemplate returns a certificate template for the subject and names of the CSR
+// The validity, usages and CA fields are taken from the options, their subject and names are ignored
+func GetRequestTemplate(csr *x509.CertificateRequest, opts TemplateOptions) (x509.Certificate, error) {
+	opts.CommonName = csr.Subject.CommonName
+	opts.Subject = csr.Subject
+	opts.DNSNames = csr.DNSNames
+	opts.IPAddresses = csr.IPAddresses
+	opts.URIs = csr.URIs
+	opts.EmailAddresses = csr.EmailAddresses
+
+	template, err := GetTemplate(opts)
+	if err != nil {
+		return x509.Certificate{}, err
+	}
+	restrictKeyUsage(&template, csr.PublicKey)
+	return template, nil
+}
+
+// KeyMatches reports whether the public key belongs to the private key
+func KeyMatches(privateKey crypto.Signer, publicKey crypto.PublicKey) bool {
+	return publicKeysEqual(privateKey.Public(), publicKey)
+}
+
+// CertificateMatches reports whether the certificate is issued for the public key
+func CertificateMatches(certificate *x509.Certificate, publicKey crypto.PublicKey) bool {
+	return publicKeysEqual(certificate.PublicKey, publicKey)
+}
+
+// restrictKeyUsage removes the key usages that do not apply to the public key of the certificate
+// Key encipherment only applies to RSA keys
+func restrictKeyUsage(template *x509.Certificate, publicKey crypto.PublicKey) {
+	if _, ok := publicKey.(*rsa.PublicKey); !ok {
+		template.KeyUsage &^= x509.KeyUsageKeyEncipherment
+	}
+}
@@ -0,0 +1,73 @@
+package cert
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+)
+
+// SigningRequest holds everything a Signer needs to issue a certificate
+type SigningRequest struct {
+	// Template is the certificate to be signed
+	Template *x509.Certificate
+
+	// PublicKey is the public key the certificate is issued for
+	PublicKey crypto.PublicKey
+
+	// PrivateKey is the private key matching PublicKey, it is only known to self-signed requests
+	// Only signers that sign with the certificate's own key make use of it
+	PrivateKey crypto.Signer
+
+	// CSR is the certificate signing request the template was built from
+	// Signers that forward the request to another authority send it instead of the template
+	CSR *x509.CertificateRequest
+}
+
+// SignedCertificate is the result of signing a certificate
+type SignedCertificate struct {
+	// Certificate is the PEM encoded certificate followed by any intermediates
+	Certificate []byte
+
+	// CA is the PEM encoded certificate of the issuing CA, if known
+	CA []byte
+}
+
+// ErrIssuancePending is returned by signers that issue certificates asynchronously while the issuance is in progress
+// The certificate is requested again later, signers keep track of the issuance themselves
+var ErrIssuancePending = errors.New("certificate issuance is pending")
+
+// Signer issues certificates for a particular issuer backend
+type Signer interface {
+	// Sign issues a certificate for the given request
+	Sign(ctx context.Context, request *SigningRequest) (*SignedCertificate, error)
+}
+
+// SelfSignedSigner signs certificates with their own private key
+type SelfSignedSigner struct{}
+
+// Sign issues a self-signed certificate for the given request
+func (SelfSignedSigner) Sign(_ context.Context, request *SigningRequest) (*SignedCertificate, error) {
+	if request.PrivateKey == nil {
+		return nil, errors.New("self-signed certificates require the private key")
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, request.Template, request.Template, request.PublicKey, request.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  constants.TypeCertificate,
+		Bytes: certBytes,
+	})
+
+	return &SignedCertificate{
+		Certificate: certPEM,
+		CA:          certPEM,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package cert
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sort"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+)
+
+// DefaultUsages are the usages of a certificate that does not configure any
+var DefaultUsages = []string{
+	constants.UsageDigitalSignature,
+	constants.UsageKeyEncipherment,
+	constants.UsageServerAuth,
+}
+
+// keyUsages maps the key usage names to their x509 key usage
+var keyUsages = map[string]x509.KeyUsage{
+	constants.UsageDigitalSignature:  x509.KeyUsageDigitalSignature,
+	constants.UsageContentCommitment: x509.KeyUsageContentCommitment,
+	constants.UsageKeyEncipherment:   x509.KeyUsageKeyEncipherment,
+	constants.UsageDataEncipherment:  x509.KeyUsageDataEncipherment,
+	constants.UsageKeyAgreement:      x509.KeyUsageKeyAgreement,
+	constants.UsageCertSign:          x509.KeyUsageCertSign,
+	constants.UsageCRLSign:           x509.KeyUsageCRLSign,
+	constants.UsageEncipherOnly:      x509.KeyUsageEncipherOnly,
+	constants.UsageDecipherOnly:      x509.KeyUsageDecipherOnly,
+}
+
+// extKeyUsages maps the extended key usage names to their x509 extended key usage
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	constants.UsageAny:             x509.ExtKeyUsageAny,
+	constants.UsageServerAuth:      x509.ExtKeyUsageServerAuth,
+	constants.UsageClientAuth:      x509.ExtKeyUsageClientAuth,
+	constants.UsageCodeSigning:     x509.ExtKeyUsageCodeSigning,
+	constants.UsageEmailProtection: x509.ExtKeyUsageEmailProtection,
+	constants.UsageIPSecEndSystem:  x509.ExtKeyUsageIPSECEndSystem,
+	constants.UsageIPSecTunnel:     x509.ExtKeyUsageIPSECTunnel,
+	constants.UsageIPSecUser:       x509.ExtKeyUsageIPSECUser,
+	constants.UsageTimestamping:    x509.ExtKeyUsageTimeStamping,
+	constants.UsageOCSPSigning:     x509.ExtKeyUsageOCSPSigning,
+}
+
+// ParseUsages returns the x509 key usage and extended key usages for the given usage names
+func ParseUsages(usages []string) (x509.KeyUsage, []x509.ExtKeyUsage, error) {
+	var keyUsage x509.KeyUsage
+	var extKeyUsage []x509.ExtKeyUsage
+	for _, usage := range usages {
+		if ku, ok := keyUsages[usage]; ok {
+			keyUsage |= ku
+			continue
+		}
+		if eku, ok := extKeyUsages[usage]; ok {
+			extKeyUsage = append(extKeyUsage, eku)
+			continue
+		}
+		return 0, nil, fmt.Errorf("unknown usage %q", usage)
+	}
+	return keyUsage, extKeyUsage, nil
+}
+
+// UsageNames returns the sorted names of the x509 key usage and extended key usages
+func UsageNames(keyUsage x509.KeyUsage, extKeyUsage []x509.ExtKeyUsage) []string {
+	var names []string
+	for name, ku := range keyUsages {
+		if keyUsage&ku != 0 {
+			names = append(names, name)
+		}
+	}
+	for name, eku := range extKeyUsages {
+		for _, usage := range extKeyUsage {
+			if usage == eku {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,156 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	jksMagic   = 0xfeedfeed
+	jksVersion = 2
+
+	jksPrivateKeyEntry  = 1
+	jksTrustedCertEntry = 2
+)
+
+// oidJKSKeyProtector is the proprietary algorithm of Sun that protects the private keys of a JKS
+var oidJKSKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// jksWhitener is mixed into the integrity digest of every JKS
+var jksWhitener = []byte("Mighty Aphrodite")
+
+// TrustStoreAlias returns the alias of the certificate at the index of a truststore
+// The first certificate is named ca, the others ca-<index>
+func TrustStoreAlias(index int) string {
+	if index == 0 {
+		return "ca"
+	}
+	return fmt.Sprintf("ca-%d", index)
+}
+
+// EncodeJKS encodes the private key and its certificate chain as a Java KeyStore protected by the password
+// The key entry is dated with the start of the validity of the certificate, so the keystore only changes with the certificate
+func EncodeJKS(privateKey crypto.Signer, chain []*x509.Certificate, alias, password string) ([]byte, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("certificate chain must not be empty")
+	}
+	if password == "" {
+		return nil, errEmptyPassword
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	protected, err := protectJKSKey(pkcs8, utf16BE(password))
+	if err != nil {
+		return nil, err
+	}
+
+	w := &jksWriter{}
+	w.header(1)
+	w.uint32(jksPrivateKeyEntry)
+	w.entryHeader(alias, chain[0].NotBefore)
+	w.bytes(protected)
+	w.uint32(uint32(len(chain)))
+	for _, certificate := range chain {
+		w.certificate(certificate)
+	}
+	return w.sign(password), nil
+}
+
+// EncodeJKSTrustStore encodes the certificates as a Java KeyStore of trusted certificates protected by the password
+// The aliases are TrustStoreAlias of their index, the keystore only changes with the certificates
+func EncodeJKSTrustStore(certificates []*x509.Certificate, password string) ([]byte, error) {
+	if password == "" {
+		return nil, errEmptyPassword
+	}
+
+	w := &jksWriter{}
+	w.header(len(certificates))
+	for i, certificate := range certificates {
+		w.uint32(jksTrustedCertEntry)
+		w.entryHeader(TrustStoreAlias(i), certificate.NotBefore)
+		w.certificate(certificate)
+	}
+	return w.sign(password), nil
+}
+
+// protectJKSKey encrypts the PKCS#8 encoded private key with the key protector of Sun
+// The key is XORed with a SHA-1 based keystream of the password and a random salt, followed by a SHA-1 checksum
+func protectJKSKey(pkcs8, password []byte) ([]byte, error) {
+	salt, err := randomBytes(sha1.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	protected := append([]byte{}, salt...)
+	digest := salt
+	for offset := 0; offset < len(pkcs8); offset += sha1.Size {
+		sum := sha1.Sum(append(append([]byte{}, password...), digest...))
+		digest = sum[:]
+		for i := 0; i < sha1.Size && offset+i < len(pkcs8); i++ {
+			protected = append(protected, pkcs8[offset+i]^digest[i])
+		}
+	}
+	checksum := sha1.Sum(append(append([]byte{}, password...), pkcs8...))
+	protected = append(protected, checksum[:]...)
+
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidJKSKeyProtector, Parameters: asn1.NullRawValue},
+		EncryptedData: protected,
+	})
+}
+
+// jksWriter writes the big-endian encoding of the Java DataOutputStream a JKS is made of
+type jksWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *jksWriter) uint32(value uint32) {
+	_ = binary.Write(&w.buf, binary.BigEndian, value)
+}
+
+func (w *jksWriter) bytes(data []byte) {
+	w.uint32(uint32(len(data)))
+	w.buf.Write(data)
+}
+
+// utf writes the string like DataOutputStream.writeUTF, which matches UTF-8 for the aliases this package writes
+func (w *jksWriter) utf(s string) {
+	_ = binary.Write(&w.buf, binary.BigEndian, uint16(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *jksWriter) header(entries int) {
+	w.uint32(jksMagic)
+	w.uint32(jksVersion)
+	w.uint32(uint32(entries))
+}
+
+func (w *jksWriter) entryHeader(alias string, date time.Time) {
+	w.utf(alias)
+	_ = binary.Write(&w.buf, binary.BigEndian, date.UnixMilli())
+}
+
+func (w *jksWriter) certificate(certificate *x509.Certificate) {
+	w.utf("X.509")
+	w.bytes(certificate.Raw)
+}
+
+// sign appends the SHA-1 digest of the password, the whitener and the keystore that protects its integrity
+func (w *jksWriter) sign(password string) []byte {
+	hash := sha1.New()
+	hash.Write(utf16BE(password))
+	hash.Write(jksWhitener)
+	hash.Write(w.buf.Bytes())
+	return append(w.buf.Bytes(), hash.Sum(nil)...)
+}
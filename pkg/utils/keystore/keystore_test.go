@@ -0,0 +1,305 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodePKCS12(t *testing.T) {
+	key, chain := getTestChain(t)
+
+	data, err := EncodePKCS12(key, chain, "certificate", "changeit")
+	assert.NoError(t, err)
+
+	bags := decodePKCS12(t, data, "changeit")
+	if assert.Len(t, bags, 3, "Keystore should contain the chain and the key") {
+		assert.Equal(t, chain[0].Raw, bags[0].certificate, "Leaf certificate should come first")
+		assert.Equal(t, chain[1].Raw, bags[1].certificate, "CA certificate should follow")
+		assert.Equal(t, "certificate", bags[0].alias, "Leaf certificate should have the alias")
+
+		pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+		assert.NoError(t, err)
+		assert.Equal(t, pkcs8, bags[2].key, "Key should decrypt with the password")
+		assert.Equal(t, "certificate", bags[2].alias, "Key should have the alias")
+	}
+
+	_, err = EncodePKCS12(key, chain, "certificate", "")
+	assert.ErrorIs(t, err, errEmptyPassword)
+}
+
+func TestEncodePKCS12TrustStore(t *testing.T) {
+	_, chain := getTestChain(t)
+
+	data, err := EncodePKCS12TrustStore([]*x509.Certificate{chain[1], chain[0]}, "changeit")
+	assert.NoError(t, err)
+
+	bags := decodePKCS12(t, data, "changeit")
+	if assert.Len(t, bags, 2, "Truststore should contain the certificates") {
+		assert.Equal(t, chain[1].Raw, bags[0].certificate)
+		assert.Equal(t, "ca", bags[0].alias)
+		assert.True(t, bags[0].trusted, "Certificates should be trusted for Java")
+		assert.Equal(t, "ca-1", bags[1].alias)
+	}
+}
+
+func TestEncodeJKS(t *testing.T) {
+	key, chain := getTestChain(t)
+
+	data, err := EncodeJKS(key, chain, "certificate", "changeit")
+	assert.NoError(t, err)
+
+	entries := decodeJKS(t, data, "changeit")
+	if assert.Len(t, entries, 1, "Keystore should contain the key entry") {
+		assert.Equal(t, "certificate", entries[0].alias)
+		assert.Equal(t, [][]byte{chain[0].Raw, chain[1].Raw}, entries[0].certificates, "Entry should contain the chain")
+
+		pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+		assert.NoError(t, err)
+		assert.Equal(t, pkcs8, entries[0].key, "Key should decrypt with the password")
+	}
+
+	// Truststores are deterministic, so they only change with their certificates
+	truststore, err := EncodeJKSTrustStore([]*x509.Certificate{chain[1]}, "changeit")
+	assert.NoError(t, err)
+	again, err := EncodeJKSTrustStore([]*x509.Certificate{chain[1]}, "changeit")
+	assert.NoError(t, err)
+	assert.Equal(t, truststore, again)
+
+	entries = decodeJKS(t, truststore, "changeit")
+	if assert.Len(t, entries, 1, "Truststore should contain the certificate") {
+		assert.Equal(t, "ca", entries[0].alias)
+		assert.Equal(t, [][]byte{chain[1].Raw}, entries[0].certificates)
+		assert.Nil(t, entries[0].key, "Trusted certificate entries have no key")
+	}
+}
+
+// getTestChain returns a private key with its certificate signed by a CA followed by the CA certificate
+func getTestChain(t *testing.T) (crypto.Signer, []*x509.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	assert.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	assert.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.k8c.io"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	assert.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return key, []*x509.Certificate{certificate, ca}
+}
+
+// decodedBag is a certificate or decrypted PKCS#8 key of a PKCS#12 file with its attributes
+type decodedBag struct {
+	certificate []byte
+	key         []byte
+	alias       string
+	trusted     bool
+}
+
+// decodePKCS12 verifies the MAC of the PKCS#12 file and returns its bags
+func decodePKCS12(t *testing.T, data []byte, password string) []decodedBag {
+	encodedPassword, err := bmpString(password)
+	assert.NoError(t, err)
+
+	pfx := pfxPdu{}
+	_, err = asn1.Unmarshal(data, &pfx)
+	assert.NoError(t, err, "PFX should be DER encoded")
+	var authenticatedSafeBytes []byte
+	_, err = asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authenticatedSafeBytes)
+	assert.NoError(t, err)
+
+	mac := hmac.New(sha1.New, pbkdf(sha1.Size, pfx.MacData.MacSalt, encodedPassword, pfx.MacData.Iterations, 3))
+	mac.Write(authenticatedSafeBytes)
+	assert.Equal(t, mac.Sum(nil), pfx.MacData.Mac.Digest, "MAC should match the password")
+
+	var authenticatedSafe []contentInfo
+	_, err = asn1.Unmarshal(authenticatedSafeBytes, &authenticatedSafe)
+	assert.NoError(t, err)
+
+	var decoded []decodedBag
+	for _, content := range authenticatedSafe {
+		var safeContents []byte
+		if content.ContentType.Equal(oidEncryptedDataContentType) {
+			encrypted := encryptedData{}
+			_, err = asn1.Unmarshal(content.Content.Bytes, &encrypted)
+			assert.NoError(t, err)
+			safeContents = pbDecrypt(t, encrypted.EncryptedContentInfo.ContentEncryptionAlgorithm, encrypted.EncryptedContentInfo.EncryptedContent, encodedPassword)
+		} else {
+			_, err = asn1.Unmarshal(content.Content.Bytes, &safeContents)
+			assert.NoError(t, err)
+		}
+
+		var bags []safeBag
+		_, err = asn1.Unmarshal(safeContents, &bags)
+		assert.NoError(t, err)
+		for _, bag := range bags {
+			decoded = append(decoded, decodeBag(t, bag, encodedPassword))
+		}
+	}
+	return decoded
+}
+
+// decodeBag returns the certificate or decrypted key of the bag with its attributes
+func decodeBag(t *testing.T, bag safeBag, password []byte) decodedBag {
+	decoded := decodedBag{}
+	switch {
+	case bag.ID.Equal(oidCertBag):
+		certificate := certBag{}
+		_, err := asn1.Unmarshal(bag.Value.Bytes, &certificate)
+		assert.NoError(t, err)
+		decoded.certificate = certificate.Data
+	case bag.ID.Equal(oidPKCS8ShroudedKeyBag):
+		info := encryptedPrivateKeyInfo{}
+		_, err := asn1.Unmarshal(bag.Value.Bytes, &info)
+		assert.NoError(t, err)
+		decoded.key = pbDecrypt(t, info.Algorithm, info.EncryptedData, password)
+	}
+
+	for _, attribute := range bag.Attributes {
+		switch {
+		case attribute.ID.Equal(oidFriendlyName):
+			name := asn1.RawValue{}
+			_, err := asn1.Unmarshal(attribute.Value.Bytes, &name)
+			assert.NoError(t, err)
+			for i := 0; i+1 < len(name.Bytes); i += 2 {
+				decoded.alias += string(rune(binary.BigEndian.Uint16(name.Bytes[i:])))
+			}
+		case attribute.ID.Equal(oidJavaTrustedKeyUsage):
+			decoded.trusted = true
+		}
+	}
+	return decoded
+}
+
+// pbDecrypt decrypts data encrypted with pbeWithSHAAnd3-KeyTripleDES-CBC and removes the padding
+func pbDecrypt(t *testing.T, algorithm pkix.AlgorithmIdentifier, encrypted, password []byte) []byte {
+	assert.True(t, algorithm.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC), "Data should be encrypted with 3DES")
+	params := pbeParams{}
+	_, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params)
+	assert.NoError(t, err)
+
+	block, err := des.NewTripleDESCipher(pbkdf(24, params.Salt, password, params.Iterations, 1))
+	assert.NoError(t, err)
+	decrypted := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, pbkdf(8, params.Salt, password, params.Iterations, 2)).CryptBlocks(decrypted, encrypted)
+	return decrypted[:len(decrypted)-int(decrypted[len(decrypted)-1])]
+}
+
+// decodedEntry is an entry of a JKS with its decrypted PKCS#8 key, if any
+type decodedEntry struct {
+	alias        string
+	key          []byte
+	certificates [][]byte
+}
+
+// decodeJKS verifies the integrity digest of the JKS and returns its entries
+func decodeJKS(t *testing.T, data []byte, password string) []decodedEntry {
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	hash := sha1.New()
+	hash.Write(utf16BE(password))
+	hash.Write(jksWhitener)
+	hash.Write(body)
+	assert.Equal(t, hash.Sum(nil), digest, "Digest should match the password")
+
+	r := bytes.NewReader(body)
+	readUint32 := func() uint32 {
+		var value uint32
+		assert.NoError(t, binary.Read(r, binary.BigEndian, &value))
+		return value
+	}
+	readBytes := func(n int) []byte {
+		data := make([]byte, n)
+		_, err := r.Read(data)
+		assert.NoError(t, err)
+		return data
+	}
+	readUTF := func() string {
+		var length uint16
+		assert.NoError(t, binary.Read(r, binary.BigEndian, &length))
+		return string(readBytes(int(length)))
+	}
+	readCertificate := func() []byte {
+		assert.Equal(t, "X.509", readUTF())
+		return readBytes(int(readUint32()))
+	}
+
+	assert.Equal(t, uint32(jksMagic), readUint32())
+	assert.Equal(t, uint32(jksVersion), readUint32())
+	count := readUint32()
+
+	var entries []decodedEntry
+	for i := uint32(0); i < count; i++ {
+		tag := readUint32()
+		entry := decodedEntry{alias: readUTF()}
+		readBytes(8)
+
+		if tag == jksPrivateKeyEntry {
+			info := encryptedPrivateKeyInfo{}
+			_, err := asn1.Unmarshal(readBytes(int(readUint32())), &info)
+			assert.NoError(t, err)
+			entry.key = unprotectJKSKey(t, info.EncryptedData, utf16BE(password))
+			for j := readUint32(); j > 0; j-- {
+				entry.certificates = append(entry.certificates, readCertificate())
+			}
+		} else {
+			entry.certificates = append(entry.certificates, readCertificate())
+		}
+		entries = append(entries, entry)
+	}
+	assert.Zero(t, r.Len(), "JKS should not contain trailing data")
+	return entries
+}
+
+// unprotectJKSKey decrypts a key protected with the key protector of Sun and verifies its checksum
+func unprotectJKSKey(t *testing.T, protected, password []byte) []byte {
+	salt, encrypted, checksum := protected[:sha1.Size], protected[sha1.Size:len(protected)-sha1.Size], protected[len(protected)-sha1.Size:]
+
+	key := make([]byte, len(encrypted))
+	digest := salt
+	for offset := 0; offset < len(encrypted); offset += sha1.Size {
+		sum := sha1.Sum(append(append([]byte{}, password...), digest...))
+		digest = sum[:]
+		for i := 0; i < sha1.Size && offset+i < len(encrypted); i++ {
+			key[offset+i] = encrypted[offset+i] ^ digest[i]
+		}
+	}
+
+	sum := sha1.Sum(append(append([]byte{}, password...), key...))
+	assert.Equal(t, sum[:], checksum, "Checksum should match the decrypted key")
+	return key
+}
@@ -0,0 +1,389 @@
+// Package keystore encodes certificates and private keys as PKCS#12 and Java KeyStore (JKS) files
+package keystore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"unicode/utf16"
+)
+
+// pkcs12Iterations is the iteration count of the key derivations, the default of OpenSSL
+const pkcs12Iterations = 2048
+
+var (
+	oidDataContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidPBEWithSHAAnd3KeyTripleDESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidSHA1                          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+
+	oidFriendlyName = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+
+	// oidJavaTrustedKeyUsage marks a certificate bag as a trusted certificate entry for Java
+	oidJavaTrustedKeyUsage = asn1.ObjectIdentifier{2, 16, 840, 1, 113894, 746875, 1, 1}
+	oidAnyExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+)
+
+// errEmptyPassword is returned for empty passwords, Java can not open keystores without a password
+var errEmptyPassword = errors.New("keystore password must not be empty")
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+// EncodePKCS12 encodes the private key and its certificate chain as a PKCS#12 keystore protected by the password
+// The key and the first certificate share the alias, the keys and certificates are encrypted with 3DES,
+// which every PKCS#12 implementation including Java and Windows reads
+func EncodePKCS12(privateKey crypto.Signer, chain []*x509.Certificate, alias, password string) ([]byte, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("certificate chain must not be empty")
+	}
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID := sha1.Sum(chain[0].Raw)
+	leafAttributes, err := keyAttributes(alias, keyID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var certBags []safeBag
+	for i, certificate := range chain {
+		bag, err := makeCertBag(certificate)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			bag.Attributes = leafAttributes
+		}
+		certBags = append(certBags, bag)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	shroudedKey, err := encryptPKCS8(pkcs8, encodedPassword)
+	if err != nil {
+		return nil, err
+	}
+	keyBag := safeBag{ID: oidPKCS8ShroudedKeyBag, Value: explicitContent(shroudedKey), Attributes: leafAttributes}
+
+	return encodePFX([][]safeBag{certBags, {keyBag}}, encodedPassword)
+}
+
+// EncodePKCS12TrustStore encodes the certificates as a PKCS#12 truststore protected by the password
+// The certificates are marked as trusted for Java, their aliases are TrustStoreAlias of their index
+func EncodePKCS12TrustStore(certificates []*x509.Certificate, password string) ([]byte, error) {
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+	trusted, err := asn1.Marshal(oidAnyExtendedKeyUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	var bags []safeBag
+	for i, certificate := range certificates {
+		bag, err := makeCertBag(certificate)
+		if err != nil {
+			return nil, err
+		}
+		friendlyName, err := friendlyNameAttribute(TrustStoreAlias(i))
+		if err != nil {
+			return nil, err
+		}
+		bag.Attributes = []pkcs12Attribute{friendlyName, {ID: oidJavaTrustedKeyUsage, Value: setOf(trusted)}}
+		bags = append(bags, bag)
+	}
+	return encodePFX([][]safeBag{bags}, encodedPassword)
+}
+
+// encodePFX encodes the safe contents as a PFX, the first is encrypted, the others hold bags that are encrypted themselves
+// The PFX is integrity protected with a HMAC-SHA1 of the password
+func encodePFX(safeContents [][]safeBag, password []byte) ([]byte, error) {
+	var authenticatedSafe []contentInfo
+	for i, bags := range safeContents {
+		data, err := asn1.Marshal(bags)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			content, err := asn1.Marshal(data)
+			if err != nil {
+				return nil, err
+			}
+			authenticatedSafe = append(authenticatedSafe, contentInfo{ContentType: oidDataContentType, Content: explicitContent(content)})
+			continue
+		}
+
+		algorithm, encrypted, err := pbEncrypt(data, password)
+		if err != nil {
+			return nil, err
+		}
+		content, err := asn1.Marshal(encryptedData{
+			EncryptedContentInfo: encryptedContentInfo{
+				ContentType:                oidDataContentType,
+				ContentEncryptionAlgorithm: algorithm,
+				EncryptedContent:           encrypted,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		authenticatedSafe = append(authenticatedSafe, contentInfo{ContentType: oidEncryptedDataContentType, Content: explicitContent(content)})
+	}
+
+	authenticatedSafeBytes, err := asn1.Marshal(authenticatedSafe)
+	if err != nil {
+		return nil, err
+	}
+	content, err := asn1.Marshal(authenticatedSafeBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	macSalt, err := randomBytes(8)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha1.New, pbkdf(sha1.Size, macSalt, password, pkcs12Iterations, 3))
+	mac.Write(authenticatedSafeBytes)
+
+	return asn1.Marshal(pfxPdu{
+		Version:  3,
+		AuthSafe: contentInfo{ContentType: oidDataContentType, Content: explicitContent(content)},
+		MacData: macData{
+			Mac:        digestInfo{Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1}, Digest: mac.Sum(nil)},
+			MacSalt:    macSalt,
+			Iterations: pkcs12Iterations,
+		},
+	})
+}
+
+// makeCertBag returns a bag holding the certificate
+func makeCertBag(certificate *x509.Certificate) (safeBag, error) {
+	data, err := asn1.Marshal(certBag{ID: oidCertTypeX509, Data: certificate.Raw})
+	if err != nil {
+		return safeBag{}, err
+	}
+	return safeBag{ID: oidCertBag, Value: explicitContent(data)}, nil
+}
+
+// keyAttributes returns the attributes that tie the private key to its certificate
+func keyAttributes(alias string, keyID []byte) ([]pkcs12Attribute, error) {
+	friendlyName, err := friendlyNameAttribute(alias)
+	if err != nil {
+		return nil, err
+	}
+	localKeyID, err := asn1.Marshal(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return []pkcs12Attribute{friendlyName, {ID: oidLocalKeyID, Value: setOf(localKeyID)}}, nil
+}
+
+// friendlyNameAttribute returns the attribute naming a bag, Java uses it as the alias of the entry
+func friendlyNameAttribute(alias string) (pkcs12Attribute, error) {
+	name, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: utf16BE(alias)})
+	if err != nil {
+		return pkcs12Attribute{}, err
+	}
+	return pkcs12Attribute{ID: oidFriendlyName, Value: setOf(name)}, nil
+}
+
+// encryptPKCS8 encrypts the PKCS#8 encoded private key for a shrouded key bag
+func encryptPKCS8(pkcs8, password []byte) ([]byte, error) {
+	algorithm, encrypted, err := pbEncrypt(pkcs8, password)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{Algorithm: algorithm, EncryptedData: encrypted})
+}
+
+// pbEncrypt encrypts the data with pbeWithSHAAnd3-KeyTripleDES-CBC and a random salt
+func pbEncrypt(data, password []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	salt, err := randomBytes(8)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	params, err := asn1.Marshal(pbeParams{Salt: salt, Iterations: pkcs12Iterations})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+
+	block, err := des.NewTripleDESCipher(pbkdf(24, salt, password, pkcs12Iterations, 1))
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	iv := pbkdf(block.BlockSize(), salt, password, pkcs12Iterations, 2)
+
+	// PKCS#7 padding always adds at least one byte
+	padding := block.BlockSize() - len(data)%block.BlockSize()
+	encrypted := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	return pkix.AlgorithmIdentifier{Algorithm: oidPBEWithSHAAnd3KeyTripleDESCBC, Parameters: asn1.RawValue{FullBytes: params}}, encrypted, nil
+}
+
+// pbkdf derives size bytes from the salt and the BMP encoded password as described in RFC 7292 Appendix B.2 with SHA-1
+// The id selects the purpose of the bytes: 1 for keys, 2 for IVs and 3 for MAC keys
+func pbkdf(size int, salt, password []byte, iterations int, id byte) []byte {
+	const v = 64
+
+	d := bytes.Repeat([]byte{id}, v)
+	s := fill(salt, v)
+	p := fill(password, v)
+	i := append(s, p...)
+
+	var derived []byte
+	one := big.NewInt(1)
+	for len(derived) < size {
+		hash := sha1.New()
+		hash.Write(d)
+		hash.Write(i)
+		a := hash.Sum(nil)
+		for r := 1; r < iterations; r++ {
+			sum := sha1.Sum(a)
+			a = sum[:]
+		}
+		derived = append(derived, a...)
+
+		// Every block of I is set to (I_j + B + 1) mod 2^(v*8), where B repeats A to v bytes
+		b := new(big.Int).SetBytes(fill(a, v))
+		b.Add(b, one)
+		for j := 0; j < len(i); j += v {
+			block := new(big.Int).SetBytes(i[j : j+v])
+			block.Add(block, b)
+			sum := block.Bytes()
+			if len(sum) > v {
+				sum = sum[len(sum)-v:]
+			}
+			copy(i[j:j+v], make([]byte, v-len(sum)))
+			copy(i[j+v-len(sum):j+v], sum)
+		}
+	}
+	return derived[:size]
+}
+
+// fill repeats the data to the next multiple of v bytes, empty data stays empty
+func fill(data []byte, v int) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	filled := make([]byte, v*((len(data)+v-1)/v))
+	for i := range filled {
+		filled[i] = data[i%len(data)]
+	}
+	return filled
+}
+
+// bmpString returns the password as a null terminated big-endian UTF-16 string like PKCS#12 expects
+func bmpString(password string) ([]byte, error) {
+	if password == "" {
+		return nil, errEmptyPassword
+	}
+	return append(utf16BE(password), 0, 0), nil
+}
+
+// utf16BE returns the string as big-endian UTF-16
+func utf16BE(s string) []byte {
+	var encoded []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		encoded = append(encoded, byte(unit>>8), byte(unit))
+	}
+	return encoded
+}
+
+// explicitContent wraps the DER encoded value in a [0] EXPLICIT tag
+func explicitContent(data []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: data}
+}
+
+// setOf wraps the DER encoded value in a SET
+func setOf(data []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: data}
+}
+
+// randomBytes returns n random bytes
+func randomBytes(n int) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,171 @@
+// Package vault provides a minimal client for the Kubernetes auth method and the PKI secrets engine of HashiCorp Vault
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultKubernetesMountPath is the path the Kubernetes auth method is mounted at by default
+const DefaultKubernetesMountPath = "kubernetes"
+
+// Error is an error returned by the Vault API
+type Error struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int `json:"-"`
+
+	// Errors are the error messages of the response
+	Errors []string `json:"errors"`
+}
+
+// Error returns the status code and the messages of the error
+func (e *Error) Error() string {
+	return fmt.Sprintf("vault returned %d: %s", e.StatusCode, strings.Join(e.Errors, ", "))
+}
+
+// SignRequest is the request of the sign endpoint of a PKI role
+type SignRequest struct {
+	// CSR is the PEM encoded certificate signing request
+	CSR string `json:"csr"`
+
+	// CommonName is the common name of the certificate
+	CommonName string `json:"common_name,omitempty"`
+
+	// AltNames are the comma separated DNS names and email addresses of the certificate
+	AltNames string `json:"alt_names,omitempty"`
+
+	// IPSANs are the comma separated IP addresses of the certificate
+	IPSANs string `json:"ip_sans,omitempty"`
+
+	// URISANs are the comma separated URIs of the certificate
+	URISANs string `json:"uri_sans,omitempty"`
+
+	// TTL is the requested lifetime of the certificate, the role caps it at its max_ttl
+	TTL string `json:"ttl,omitempty"`
+
+	// Format is the encoding of the returned certificates, always pem
+	Format string `json:"format"`
+}
+
+// SignResponse is the data returned by the sign endpoint of a PKI role
+type SignResponse struct {
+	// Certificate is the PEM encoded signed certificate
+	Certificate string `json:"certificate"`
+
+	// IssuingCA is the PEM encoded certificate of the CA that signed the certificate
+	IssuingCA string `json:"issuing_ca"`
+
+	// CAChain are the PEM encoded certificates of the issuing CA and the CAs above it
+	CAChain []string `json:"ca_chain,omitempty"`
+
+	// SerialNumber is the serial number of the certificate
+	SerialNumber string `json:"serial_number"`
+}
+
+// Client calls the Vault API
+type Client struct {
+	// Address is the URL of the Vault server, such as https://vault.example.com:8200
+	Address string
+
+	// Namespace is the Vault Enterprise namespace the requests are sent to, if any
+	Namespace string
+
+	// Token authenticates the requests, it is set by LoginKubernetes
+	Token string
+
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+// LoginKubernetes logs in with the Kubernetes auth method mounted at the path and sets the Token of the client
+// The JWT is a service account token that the role of the auth method accepts
+func (c *Client) LoginKubernetes(ctx context.Context, mountPath, role, jwt string) error {
+	if mountPath == "" {
+		mountPath = DefaultKubernetesMountPath
+	}
+
+	var response struct {
+		Auth *struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	request := map[string]string{"role": role, "jwt": jwt}
+	if err := c.do(ctx, "auth/"+strings.Trim(mountPath, "/")+"/login", request, &response); err != nil {
+		return err
+	}
+	if response.Auth == nil || response.Auth.ClientToken == "" {
+		return fmt.Errorf("vault did not return a token for role %s", role)
+	}
+	c.Token = response.Auth.ClientToken
+	return nil
+}
+
+// Sign has the PKI role at the path, such as pki/sign/example-dot-com, sign the CSR of the request
+func (c *Client) Sign(ctx context.Context, path string, request *SignRequest) (*SignResponse, error) {
+	request.Format = "pem"
+
+	var response struct {
+		Data *SignResponse `json:"data"`
+	}
+	if err := c.do(ctx, strings.Trim(path, "/"), request, &response); err != nil {
+		return nil, err
+	}
+	if response.Data == nil || response.Data.Certificate == "" {
+		return nil, fmt.Errorf("vault did not return a certificate from %s", path)
+	}
+	return response.Data, nil
+}
+
+// TTL formats the duration as a Vault TTL in seconds
+func TTL(duration time.Duration) string {
+	return fmt.Sprintf("%ds", int64(duration/time.Second))
+}
+
+// do sends the JSON encoded request to the API path and decodes the response into out
+func (c *Client) do(ctx context.Context, path string, request interface{}, out interface{}) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.Address, "/")+"/v1/"+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("X-Vault-Token", c.Token)
+	}
+	if c.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.Namespace)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		vaultErr := &Error{StatusCode: res.StatusCode}
+		if err := json.Unmarshal(body, vaultErr); err != nil || len(vaultErr.Errors) == 0 {
+			vaultErr.Errors = []string{strings.TrimSpace(string(body))}
+		}
+		return vaultErr
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,96 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+		expected string
+	}{
+		{
+			name:     "Hours",
+			duration: 2 * time.Hour,
+			expected: "7200s",
+		},
+		{
+			name:     "Fractions of a second are dropped",
+			duration: 1500 * time.Millisecond,
+			expected: "1s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, TTL(tt.duration))
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	// The fake API logs in the test role and signs for the test-role PKI role in the team namespace
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("no handler for route"))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/auth/k8s/login":
+			request := map[string]string{}
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			if request["role"] != "test" || request["jwt"] != "jwt" {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"token"}}`))
+		case "/v1/pki/sign/test-role":
+			assert.Equal(t, "token", r.Header.Get("X-Vault-Token"))
+			request := SignRequest{}
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			assert.Equal(t, "pem", request.Format)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": SignResponse{Certificate: request.CSR, IssuingCA: "ca"}})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["unknown role"]}`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := &Client{Address: server.URL + "/", Namespace: "team"}
+
+	err := client.LoginKubernetes(ctx, "/k8s/", "test", "wrong")
+	var vaultErr *Error
+	if assert.ErrorAs(t, err, &vaultErr, "Login with a wrong token should fail") {
+		assert.Equal(t, http.StatusForbidden, vaultErr.StatusCode)
+		assert.Equal(t, []string{"permission denied"}, vaultErr.Errors)
+	}
+
+	assert.NoError(t, client.LoginKubernetes(ctx, "/k8s/", "test", "jwt"))
+	assert.Equal(t, "token", client.Token, "Login should set the token")
+
+	response, err := client.Sign(ctx, "pki/sign/test-role", &SignRequest{CSR: "csr"})
+	assert.NoError(t, err)
+	assert.Equal(t, "csr", response.Certificate)
+	assert.Equal(t, "ca", response.IssuingCA)
+
+	_, err = client.Sign(ctx, "pki/sign/other-role", &SignRequest{CSR: "csr"})
+	assert.ErrorContains(t, err, "unknown role")
+
+	// Responses that are not Vault errors keep their body as the message
+	client.Namespace = ""
+	_, err = client.Sign(ctx, "pki/sign/test-role", &SignRequest{CSR: "csr"})
+	assert.ErrorContains(t, err, "no handler for route")
+}
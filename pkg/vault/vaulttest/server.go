@@ -0,0 +1,266 @@
+// Package vaulttest provides an in-process stand-in for the Vault API with the Kubernetes auth method and a PKI secrets engine
+package vaulttest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/vault"
+)
+
+// Server is an in-process Vault server whose PKI secrets engine is mounted at pki and signs with its own intermediate CA
+// The Kubernetes auth method is mounted at kubernetes
+type Server struct {
+	*httptest.Server
+
+	// RootToken is a token that is always accepted
+	RootToken string
+
+	// KubernetesRoles maps the roles of the Kubernetes auth method to the service account token they accept
+	KubernetesRoles map[string]string
+
+	// Roles are the PKI roles that sign certificates at pki/sign/<role>
+	Roles map[string]bool
+
+	// MaxTTL caps the lifetime of the signed certificates like the max_ttl of a role
+	MaxTTL time.Duration
+
+	mu           sync.Mutex
+	tokens       map[string]bool
+	signRequests []vault.SignRequest
+
+	rootPEM         []byte
+	intermediate    *x509.Certificate
+	intermediatePEM []byte
+	intermediateKey *ecdsa.PrivateKey
+}
+
+// NewServer starts a Server with a freshly generated root and intermediate CA
+// The server uses TLS, its certificate is returned by TLSCertificatePEM
+func NewServer() (*Server, error) {
+	s := &Server{
+		RootToken:       newToken(),
+		KubernetesRoles: map[string]string{},
+		Roles:           map[string]bool{},
+		MaxTTL:          24 * time.Hour,
+		tokens:          map[string]bool{},
+	}
+	if err := s.generateCA(); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/auth/kubernetes/login", s.handleLogin)
+	mux.HandleFunc("/v1/pki/sign/", s.handleSign)
+	s.Server = httptest.NewTLSServer(mux)
+	return s, nil
+}
+
+// TLSCertificatePEM returns the PEM encoded certificate the server uses for TLS
+func (s *Server) TLSCertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: s.Certificate().Raw})
+}
+
+// RootPEM returns the PEM encoded root certificate of the signed certificates
+func (s *Server) RootPEM() []byte {
+	return s.rootPEM
+}
+
+// SignRequests returns the requests the sign endpoint received
+func (s *Server) SignRequests() []vault.SignRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]vault.SignRequest(nil), s.signRequests...)
+}
+
+// generateCA generates the root CA and the intermediate CA that signs the certificates
+func (s *Server) generateCA() error {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	root := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "vaulttest root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, root, root, rootKey.Public(), rootKey)
+	if err != nil {
+		return err
+	}
+	root, err = x509.ParseCertificate(rootDER)
+	if err != nil {
+		return err
+	}
+
+	s.intermediateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	intermediate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "vaulttest intermediate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	intermediateDER, err := x509.CreateCertificate(rand.Reader, intermediate, root, s.intermediateKey.Public(), rootKey)
+	if err != nil {
+		return err
+	}
+	s.intermediate, err = x509.ParseCertificate(intermediateDER)
+	if err != nil {
+		return err
+	}
+
+	s.rootPEM = pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: rootDER})
+	s.intermediatePEM = pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: intermediateDER})
+	return nil
+}
+
+// newToken returns a new random token
+func newToken() string {
+	data := make([]byte, 16)
+	_, _ = rand.Read(data)
+	return "hvs." + hex.EncodeToString(data)
+}
+
+// writeJSON writes the value as JSON
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes a Vault error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string][]string{"errors": {message}})
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Role string `json:"role"`
+		JWT  string `json:"jwt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jwt, ok := s.KubernetesRoles[request.Role]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid role name %q", request.Role))
+		return
+	}
+	if request.JWT != jwt {
+		writeError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	token := newToken()
+	s.tokens[token] = true
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"auth": map[string]interface{}{"client_token": token, "policies": []string{"default"}},
+	})
+}
+
+func (s *Server) handleSign(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := r.Header.Get("X-Vault-Token")
+	if token != s.RootToken && !s.tokens[token] {
+		writeError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	role := strings.TrimPrefix(r.URL.Path, "/v1/pki/sign/")
+	if !s.Roles[role] {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown role: %s", role))
+		return
+	}
+
+	request := vault.SignRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.signRequests = append(s.signRequests, request)
+
+	block, _ := pem.Decode([]byte(request.CSR))
+	if block == nil {
+		writeError(w, http.StatusBadRequest, "no CSR found in the request")
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil || csr.CheckSignature() != nil {
+		writeError(w, http.StatusBadRequest, "invalid CSR")
+		return
+	}
+
+	ttl := s.MaxTTL
+	if requested, err := time.ParseDuration(request.TTL); err == nil && requested < ttl {
+		ttl = requested
+	}
+	certificatePEM, serialNumber, err := s.sign(csr, ttl)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": vault.SignResponse{
+			Certificate:  string(certificatePEM),
+			IssuingCA:    string(s.intermediatePEM),
+			CAChain:      []string{string(s.intermediatePEM), string(s.rootPEM)},
+			SerialNumber: serialNumber,
+		},
+	})
+}
+
+// sign issues a certificate for the subject and names of the CSR from the intermediate CA, the lock must be held
+func (s *Server) sign(csr *x509.CertificateRequest, ttl time.Duration) ([]byte, string, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber:   serialNumber,
+		Subject:        csr.Subject,
+		NotBefore:      time.Now().Add(-30 * time.Second),
+		NotAfter:       time.Now().Add(ttl),
+		DNSNames:       csr.DNSNames,
+		IPAddresses:    csr.IPAddresses,
+		URIs:           csr.URIs,
+		EmailAddresses: csr.EmailAddresses,
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, s.intermediate, csr.PublicKey, s.intermediateKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: der}), serialNumber.Text(16), nil
+}
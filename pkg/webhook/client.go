@@ -0,0 +1,154 @@
+// Package webhook implements the protocol of external issuers, signing services that are called over HTTPS with JSON
+//
+// The controller POSTs a SignRequest to the URL of the issuer and the service answers with a SignResponse
+// Both carry the APIVersion of the protocol, services reject versions they do not know with 400 Bad Request
+// A service answers with the status Issued and the certificate chain, Pending when it issues the certificate asynchronously,
+// or Failed and a message when it refuses to sign; the request is sent again with the same UID while it is pending
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// APIVersion is the version of the protocol
+const APIVersion = "signer.certs.k8c.io/v1"
+
+const (
+	// StatusIssued means the certificate is signed and included in the response
+	StatusIssued = "Issued"
+
+	// StatusPending means the certificate is being issued, the request is sent again later
+	StatusPending = "Pending"
+
+	// StatusFailed means the service refuses to sign the certificate, the response carries the reason
+	StatusFailed = "Failed"
+)
+
+// SignRequest is the request sent to an external issuer
+type SignRequest struct {
+	// APIVersion is the version of the protocol, always APIVersion
+	APIVersion string `json:"apiVersion"`
+
+	// UID identifies the CertificateRequest, it is the same for every attempt to sign it
+	UID string `json:"uid"`
+
+	// Namespace and Name are the namespace and name of the CertificateRequest
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	// CSR is the PEM encoded certificate signing request with the subject and names of the certificate
+	CSR string `json:"csr"`
+
+	// Usages are the requested key usages and extended key usages, such as digital signature and server auth
+	Usages []string `json:"usages"`
+
+	// DurationSeconds is the requested lifetime of the certificate
+	DurationSeconds int64 `json:"durationSeconds"`
+
+	// IsCA requests a CA certificate
+	IsCA bool `json:"isCA,omitempty"`
+}
+
+// SignResponse is the response of an external issuer
+type SignResponse struct {
+	// APIVersion is the version of the protocol, it must match the version of the request
+	APIVersion string `json:"apiVersion"`
+
+	// Status is one of Issued, Pending and Failed
+	Status string `json:"status"`
+
+	// Certificate is the PEM encoded certificate followed by its intermediates, set when the status is Issued
+	Certificate string `json:"certificate,omitempty"`
+
+	// CA is the PEM encoded root certificate of the chain, if known
+	CA string `json:"ca,omitempty"`
+
+	// Message explains a Failed or Pending status
+	Message string `json:"message,omitempty"`
+}
+
+// Error is a request an external issuer did not sign
+type Error struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+
+	// Message is the reason given by the issuer
+	Message string
+}
+
+// Error returns the status code and the message of the error
+func (e *Error) Error() string {
+	return fmt.Sprintf("external issuer returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Client calls an external issuer
+type Client struct {
+	// URL is the endpoint of the issuer, such as https://signer.example.com/sign
+	URL string
+
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+// Sign sends the request to the issuer and returns its response
+// A response with the status Failed is returned as an Error
+func (c *Client) Sign(ctx context.Context, request *SignRequest) (*SignResponse, error) {
+	request.APIVersion = APIVersion
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SignResponse{}
+	if err := json.Unmarshal(body, response); err != nil || response.APIVersion == "" {
+		// Responses that are not part of the protocol keep their body as the message
+		if res.StatusCode >= http.StatusBadRequest {
+			return nil, &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(body))}
+		}
+		return nil, fmt.Errorf("invalid response from external issuer: %s", strings.TrimSpace(string(body)))
+	}
+	if response.APIVersion != APIVersion {
+		return nil, fmt.Errorf("external issuer returned unsupported apiVersion %q", response.APIVersion)
+	}
+
+	if res.StatusCode >= http.StatusBadRequest || response.Status == StatusFailed {
+		return nil, &Error{StatusCode: res.StatusCode, Message: response.Message}
+	}
+	switch response.Status {
+	case StatusIssued:
+		if response.Certificate == "" {
+			return nil, fmt.Errorf("external issuer did not return a certificate")
+		}
+	case StatusPending:
+	default:
+		return nil, fmt.Errorf("external issuer returned unknown status %q", response.Status)
+	}
+	return response, nil
+}
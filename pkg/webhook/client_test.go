@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	// The fake issuer answers according to the UID of the request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := SignRequest{}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		assert.Equal(t, APIVersion, request.APIVersion)
+
+		switch request.UID {
+		case "issued":
+			_ = json.NewEncoder(w).Encode(SignResponse{APIVersion: APIVersion, Status: StatusIssued, Certificate: request.CSR, CA: "ca"})
+		case "pending":
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(SignResponse{APIVersion: APIVersion, Status: StatusPending})
+		case "failed":
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(SignResponse{APIVersion: APIVersion, Status: StatusFailed, Message: "names are not allowed"})
+		case "other-version":
+			_ = json.NewEncoder(w).Encode(SignResponse{APIVersion: "signer.certs.k8c.io/v2", Status: StatusIssued, Certificate: "certificate"})
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("bad gateway"))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := &Client{URL: server.URL}
+
+	response, err := client.Sign(ctx, &SignRequest{UID: "issued", CSR: "csr"})
+	assert.NoError(t, err)
+	assert.Equal(t, "csr", response.Certificate)
+	assert.Equal(t, "ca", response.CA)
+
+	response, err = client.Sign(ctx, &SignRequest{UID: "pending"})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusPending, response.Status)
+
+	_, err = client.Sign(ctx, &SignRequest{UID: "failed"})
+	var webhookErr *Error
+	if assert.ErrorAs(t, err, &webhookErr, "Failed responses should be returned as errors") {
+		assert.Equal(t, http.StatusForbidden, webhookErr.StatusCode)
+		assert.Equal(t, "names are not allowed", webhookErr.Message)
+	}
+
+	_, err = client.Sign(ctx, &SignRequest{UID: "other-version"})
+	assert.ErrorContains(t, err, "unsupported apiVersion")
+
+	// Responses that are not part of the protocol keep their body as the message
+	_, err = client.Sign(ctx, &SignRequest{UID: "unknown"})
+	assert.ErrorContains(t, err, "bad gateway")
+}
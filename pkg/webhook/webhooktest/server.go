@@ -0,0 +1,230 @@
+// Package webhooktest provides an in-process external issuer that speaks the webhook protocol over mutual TLS
+package webhooktest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/sheryarbutt/certificate-manager/pkg/constants"
+	"github.com/sheryarbutt/certificate-manager/pkg/utils/cert"
+	"github.com/sheryarbutt/certificate-manager/pkg/webhook"
+)
+
+// Server is an in-process external issuer that signs certificates with its own CA
+// It only accepts clients presenting a certificate issued by ClientCertificate
+type Server struct {
+	*httptest.Server
+
+	// PendingAttempts is the number of attempts a request is answered with Pending before it is signed
+	PendingAttempts int
+
+	// Authorize refuses to sign a request when it returns an error, every request is signed when nil
+	Authorize func(request *webhook.SignRequest) error
+
+	mu           sync.Mutex
+	attempts     map[string]int
+	signRequests []webhook.SignRequest
+
+	ca          *x509.Certificate
+	caPEM       []byte
+	caKey       *ecdsa.PrivateKey
+	clientCA    *x509.Certificate
+	clientCAKey *ecdsa.PrivateKey
+}
+
+// NewServer starts a Server with a freshly generated signing CA and client CA
+// The server uses TLS, its certificate is returned by TLSCertificatePEM
+func NewServer() (*Server, error) {
+	s := &Server{attempts: map[string]int{}}
+
+	var err error
+	if s.ca, s.caKey, err = newCA("webhooktest ca"); err != nil {
+		return nil, err
+	}
+	s.caPEM = pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: s.ca.Raw})
+	if s.clientCA, s.clientCAKey, err = newCA("webhooktest client ca"); err != nil {
+		return nil, err
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(s.clientCA)
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.handleSign))
+	s.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MinVersion: tls.VersionTLS12}
+	s.StartTLS()
+	return s, nil
+}
+
+// TLSCertificatePEM returns the PEM encoded certificate the server uses for TLS
+func (s *Server) TLSCertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: s.Certificate().Raw})
+}
+
+// CAPEM returns the PEM encoded CA certificate of the signed certificates
+func (s *Server) CAPEM() []byte {
+	return s.caPEM
+}
+
+// ClientCertificate issues a client certificate and returns it with its private key, both PEM encoded
+func (s *Server) ClientCertificate(commonName string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.clientCA, key.Public(), s.clientCAKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: constants.TypeECPrivateKey, Bytes: keyDER}), nil
+}
+
+// SignRequests returns the requests the server received
+func (s *Server) SignRequests() []webhook.SignRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]webhook.SignRequest(nil), s.signRequests...)
+}
+
+// newCA generates a self-signed CA
+func newCA(commonName string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	return certificate, key, err
+}
+
+// writeResponse writes a response of the protocol
+func writeResponse(w http.ResponseWriter, status int, response webhook.SignResponse) {
+	response.APIVersion = webhook.APIVersion
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// writeFailed writes a response with the status Failed
+func writeFailed(w http.ResponseWriter, status int, message string) {
+	writeResponse(w, status, webhook.SignResponse{Status: webhook.StatusFailed, Message: message})
+}
+
+func (s *Server) handleSign(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeFailed(w, http.StatusMethodNotAllowed, "only POST is supported")
+		return
+	}
+
+	request := webhook.SignRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeFailed(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if request.APIVersion != webhook.APIVersion {
+		writeFailed(w, http.StatusBadRequest, fmt.Sprintf("unsupported apiVersion %q", request.APIVersion))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signRequests = append(s.signRequests, request)
+
+	if s.Authorize != nil {
+		if err := s.Authorize(&request); err != nil {
+			writeFailed(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+	if s.attempts[request.UID] < s.PendingAttempts {
+		s.attempts[request.UID]++
+		writeResponse(w, http.StatusAccepted, webhook.SignResponse{Status: webhook.StatusPending, Message: "waiting for the signing backend"})
+		return
+	}
+
+	certificatePEM, err := s.sign(&request)
+	if err != nil {
+		writeFailed(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeResponse(w, http.StatusOK, webhook.SignResponse{
+		Status:      webhook.StatusIssued,
+		Certificate: string(certificatePEM),
+		CA:          string(s.caPEM),
+	})
+}
+
+// sign issues a certificate for the subject and names of the CSR with the requested usages and duration
+func (s *Server) sign(request *webhook.SignRequest) ([]byte, error) {
+	csr, err := cert.ParseCertificateRequest([]byte(request.CSR))
+	if err != nil {
+		return nil, err
+	}
+	keyUsage, extKeyUsage, err := cert.ParseUsages(request.Usages)
+	if err != nil {
+		return nil, err
+	}
+	if request.DurationSeconds <= 0 {
+		return nil, fmt.Errorf("invalid durationSeconds %d", request.DurationSeconds)
+	}
+
+	serialNumber, err := cert.NewSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               csr.Subject,
+		NotBefore:             time.Now().Add(-30 * time.Second),
+		NotAfter:              time.Now().Add(time.Duration(request.DurationSeconds) * time.Second),
+		DNSNames:              csr.DNSNames,
+		IPAddresses:           csr.IPAddresses,
+		URIs:                  csr.URIs,
+		EmailAddresses:        csr.EmailAddresses,
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           extKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  request.IsCA,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, s.ca, csr.PublicKey, s.caKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: constants.TypeCertificate, Bytes: der}), nil
+}